@@ -161,6 +161,30 @@ var (
 		utils.GpoPercentileFlag,
 		utils.LegacyGpoPercentileFlag,
 		utils.GpoMaxGasPriceFlag,
+		utils.TraceSyncFlag,
+		utils.TraceRealtimeFlag,
+		utils.TraceRollingFlag,
+		utils.TraceStateFlag,
+		utils.TraceSinkFlag,
+		utils.TraceDatabaseFlag,
+		utils.TraceHistoryFlag,
+		utils.TracePendingFlag,
+		utils.TraceBatchSizeFlag,
+		utils.TraceErrorLogFlag,
+		utils.TracePauseLagFlag,
+		utils.TraceResumeLagFlag,
+		utils.TraceKindsFlag,
+		utils.TraceWorkersFlag,
+		utils.TraceQueueFlag,
+		utils.TracePoolJournalFlag,
+		utils.TracePoolRejournalFlag,
+		utils.TracePoolQueueFlag,
+		utils.TracePoolExecutedFlag,
+		utils.TracePoolLifetimeFlag,
+		utils.TraceCoinbaseFlag,
+		utils.TraceBlockIntervalFlag,
+		utils.TraceProbeFlag,
+		utils.TraceCorrelateFlag,
 		utils.EWASMInterpreterFlag,
 		utils.EVMInterpreterFlag,
 		configFileFlag,
@@ -198,6 +222,7 @@ var (
 		utils.InsecureUnlockAllowedFlag,
 		utils.RPCGlobalGasCapFlag,
 		utils.RPCGlobalTxFeeCapFlag,
+		utils.RPCGlobalTraceFilterRangeFlag,
 	}
 
 	whisperFlags = []cli.Flag{
@@ -238,6 +263,7 @@ func init() {
 		dumpCommand,
 		dumpGenesisCommand,
 		inspectCommand,
+		traceCommand,
 		// See accountcmd.go:
 		accountCommand,
 		walletCommand,
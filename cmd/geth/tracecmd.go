@@ -0,0 +1,161 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/ethereum/go-ethereum/cmd/utils"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/trace"
+	"gopkg.in/urfave/cli.v1"
+)
+
+var (
+	traceExportFromFlag = cli.Uint64Flag{
+		Name:  "from",
+		Usage: "First block to export the transaction traces of",
+		Value: 1,
+	}
+	traceExportToFlag = cli.Uint64Flag{
+		Name:  "to",
+		Usage: "Last block to export the transaction traces of (required)",
+	}
+	traceExportWorkersFlag = cli.IntFlag{
+		Name:  "workers",
+		Usage: "Number of block chunks re-executed in parallel",
+		Value: core.DefaultTraceExportConfig.Workers,
+	}
+	traceExportChunkFlag = cli.Uint64Flag{
+		Name:  "chunk",
+		Usage: "Number of consecutive blocks re-executed and checkpointed together",
+		Value: core.DefaultTraceExportConfig.ChunkSize,
+	}
+	traceExportReexecFlag = cli.Uint64Flag{
+		Name:  "reexec",
+		Usage: "Maximum number of blocks re-executed to regenerate a missing historical state",
+		Value: core.DefaultTraceExportConfig.Reexec,
+	}
+	traceExportCheckpointFlag = cli.StringFlag{
+		Name:  "checkpoint",
+		Usage: "File recording the exported chunks, to resume an interrupted export (relative to the data directory)",
+		Value: "trace-export.json",
+	}
+
+	traceCommand = cli.Command{
+		Name:     "trace",
+		Usage:    "Manage the recorded transaction traces",
+		Category: "BLOCKCHAIN COMMANDS",
+		Description: `
+The trace command manages the transaction traces recorded with --trace.sync.`,
+		Subcommands: []cli.Command{
+			{
+				Name:      "export",
+				Usage:     "Re-execute a block range and record the traces of its transactions",
+				ArgsUsage: "",
+				Action:    utils.MigrateFlags(exportTraces),
+				Category:  "BLOCKCHAIN COMMANDS",
+				Flags: []cli.Flag{
+					utils.DataDirFlag,
+					utils.CacheFlag,
+					utils.SyncModeFlag,
+					utils.GCModeFlag,
+					utils.TraceStateFlag,
+					utils.TraceSinkFlag,
+					utils.TraceDatabaseFlag,
+					utils.TraceHistoryFlag,
+					utils.TraceBatchSizeFlag,
+					utils.TraceErrorLogFlag,
+					traceExportFromFlag,
+					traceExportToFlag,
+					traceExportWorkersFlag,
+					traceExportChunkFlag,
+					traceExportReexecFlag,
+					traceExportCheckpointFlag,
+				},
+				Description: `
+    geth trace export --from N --to M --workers K
+
+re-executes the canonical blocks N to M and writes the traces of their
+transactions to the history record set of the trace sink, without syncing
+them again. This regenerates the records after the record format changed or
+records were lost.
+
+The range is split into chunks re-executed in parallel, each from the state of
+its parent block. On a non-archive node, the missing states are regenerated
+from an older state, re-executing at most --reexec blocks.
+
+Every exported chunk is recorded in the checkpoint file once its records are
+stored, so running the same export again resumes where it was interrupted.
+Records are added to the sink, not replaced: the records of the chunks being
+exported when the export was interrupted are written again on resume.`,
+			},
+		},
+	}
+)
+
+// exportTraces re-executes a block range and writes the trace records of its
+// transactions to the configured trace sink.
+func exportTraces(ctx *cli.Context) error {
+	if !ctx.GlobalIsSet(traceExportToFlag.Name) {
+		utils.Fatalf("The last block to export must be given with --%s", traceExportToFlag.Name)
+	}
+	stack, cfg := makeConfigNode(ctx)
+	defer stack.Close()
+
+	chain, db := utils.MakeChain(ctx, stack, true)
+	defer db.Close()
+
+	config := &core.TraceExportConfig{
+		From:       ctx.GlobalUint64(traceExportFromFlag.Name),
+		To:         ctx.GlobalUint64(traceExportToFlag.Name),
+		Workers:    ctx.GlobalInt(traceExportWorkersFlag.Name),
+		ChunkSize:  ctx.GlobalUint64(traceExportChunkFlag.Name),
+		Reexec:     ctx.GlobalUint64(traceExportReexecFlag.Name),
+		State:      cfg.Eth.Trace.State,
+		Checkpoint: stack.ResolvePath(ctx.GlobalString(traceExportCheckpointFlag.Name)),
+	}
+	sink, err := trace.OpenSink(&cfg.Eth.Trace, cfg.Eth.Trace.History)
+	if err != nil {
+		utils.Fatalf("Failed to open trace sink: %v", err)
+	}
+	defer sink.Close()
+	trace.SetWETHTokens(cfg.Eth.Trace.WETH)
+
+	// Watch for Ctrl-C while the export is running, it stops before the next
+	// block and leaves the unfinished chunks to a later run
+	var (
+		interrupt = make(chan os.Signal, 1)
+		stop      = make(chan struct{})
+		done      = make(chan struct{})
+	)
+	signal.Notify(interrupt, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(interrupt)
+	defer close(done)
+	go func() {
+		select {
+		case <-interrupt:
+			log.Info("Interrupted during trace export, stopping at next block")
+			close(stop)
+		case <-done:
+		}
+	}()
+	return core.ExportTraces(chain, sink, config, stop)
+}
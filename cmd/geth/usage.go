@@ -152,6 +152,7 @@ var AppHelpFlagGroups = []flags.FlagGroup{
 			utils.GraphQLVirtualHostsFlag,
 			utils.RPCGlobalGasCapFlag,
 			utils.RPCGlobalTxFeeCapFlag,
+			utils.RPCGlobalTraceFilterRangeFlag,
 			utils.JSpathFlag,
 			utils.ExecFlag,
 			utils.PreloadJSFlag,
@@ -198,6 +199,35 @@ var AppHelpFlagGroups = []flags.FlagGroup{
 			utils.GpoMaxGasPriceFlag,
 		},
 	},
+	{
+		Name: "TRACE RECORDER",
+		Flags: []cli.Flag{
+			utils.TraceSyncFlag,
+			utils.TraceRealtimeFlag,
+			utils.TraceRollingFlag,
+			utils.TraceStateFlag,
+			utils.TraceSinkFlag,
+			utils.TraceDatabaseFlag,
+			utils.TraceHistoryFlag,
+			utils.TracePendingFlag,
+			utils.TraceBatchSizeFlag,
+			utils.TraceErrorLogFlag,
+			utils.TracePauseLagFlag,
+			utils.TraceResumeLagFlag,
+			utils.TraceKindsFlag,
+			utils.TraceWorkersFlag,
+			utils.TraceQueueFlag,
+			utils.TracePoolJournalFlag,
+			utils.TracePoolRejournalFlag,
+			utils.TracePoolQueueFlag,
+			utils.TracePoolExecutedFlag,
+			utils.TracePoolLifetimeFlag,
+			utils.TraceCoinbaseFlag,
+			utils.TraceBlockIntervalFlag,
+			utils.TraceProbeFlag,
+			utils.TraceCorrelateFlag,
+		},
+	},
 	{
 		Name: "VIRTUAL MACHINE",
 		Flags: []cli.Flag{
@@ -0,0 +1,146 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+// tracemigrate converts trace records written in the legacy string-encoded
+// format into the current typed schema.
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/trace"
+	"gopkg.in/mgo.v2"
+)
+
+var (
+	srcColl  = flag.String("collection", "history", "MongoDB collection to read legacy records from")
+	dstSink  = flag.String("sink", "", "trace sink url to write upgraded records to")
+	dstDB    = flag.String("db", "", "MongoDB database of the destination sink")
+	dstName  = flag.String("name", "", "record set to write to (defaults to the source collection)")
+	batch    = flag.Int("batch", trace.DefaultConfig.BatchSize, "number of records per write batch")
+	errorLog = flag.String("errorlog", trace.DefaultConfig.ErrorLog, "file logging records the destination failed to store")
+)
+
+func init() {
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage:", os.Args[0], "-sink <url> [options] <source>")
+		flag.PrintDefaults()
+		fmt.Fprintln(os.Stderr, `
+Reads legacy trace records from source, which is either a mongodb:// url
+(with the collection given by -collection) or a newline-delimited JSON file,
+and writes them in the current schema to the destination sink.`)
+	}
+}
+
+func main() {
+	flag.Parse()
+	if flag.NArg() != 1 || *dstSink == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+	name := *dstName
+	if name == "" {
+		name = *srcColl
+	}
+	sink, err := trace.OpenSink(&trace.Config{
+		Sink:      *dstSink,
+		Database:  *dstDB,
+		BatchSize: *batch,
+		ErrorLog:  *errorLog,
+	}, name)
+	if err != nil {
+		die(err)
+	}
+	var (
+		src    = flag.Arg(0)
+		count  int
+		upload = func(legacy *trace.LegacyRecord) error {
+			tx, err := legacy.Upgrade()
+			if err != nil {
+				return err
+			}
+			count++
+			return sink.Write(*tx)
+		}
+	)
+	if strings.HasPrefix(src, "mongodb://") {
+		err = readMongo(src, *srcColl, upload)
+	} else {
+		err = readFile(src, upload)
+	}
+	if closeErr := sink.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		die(err)
+	}
+	fmt.Fprintf(os.Stderr, "Migrated %d records\n", count)
+}
+
+// readMongo iterates over all legacy records in the given MongoDB collection.
+func readMongo(rawurl string, collection string, fn func(*trace.LegacyRecord) error) error {
+	session, err := mgo.Dial(rawurl)
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	var (
+		iter   = session.DB("").C(collection).Find(nil).Iter()
+		legacy trace.LegacyRecord
+	)
+	for iter.Next(&legacy) {
+		if err := fn(&legacy); err != nil {
+			iter.Close()
+			return err
+		}
+		legacy = trace.LegacyRecord{}
+	}
+	return iter.Close()
+}
+
+// readFile iterates over all legacy records in a newline-delimited JSON file.
+func readFile(path string, fn func(*trace.LegacyRecord) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	dec := json.NewDecoder(bufio.NewReader(file))
+	for {
+		var legacy trace.LegacyRecord
+		if err := dec.Decode(&legacy); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if err := fn(&legacy); err != nil {
+			return err
+		}
+	}
+}
+
+func die(args ...interface{}) {
+	fmt.Fprintln(os.Stderr, args...)
+	os.Exit(1)
+}
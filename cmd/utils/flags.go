@@ -63,6 +63,7 @@ import (
 	"github.com/ethereum/go-ethereum/p2p/nat"
 	"github.com/ethereum/go-ethereum/p2p/netutil"
 	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/trace"
 	pcsclite "github.com/gballet/go-libpcsclite"
 	"gopkg.in/urfave/cli.v1"
 )
@@ -480,6 +481,11 @@ var (
 		Usage: "Sets a cap on transaction fee (in ether) that can be sent via the RPC APIs (0 = no cap)",
 		Value: eth.DefaultConfig.RPCTxFeeCap,
 	}
+	RPCGlobalTraceFilterRangeFlag = cli.Uint64Flag{
+		Name:  "rpc.tracefilterrange",
+		Usage: "Sets a cap on the number of blocks a trace_filter request can span (0 = no cap)",
+		Value: eth.DefaultConfig.RPCTraceFilterRange,
+	}
 	// Logging and debug settings
 	EthStatsURLFlag = cli.StringFlag{
 		Name:  "ethstats",
@@ -662,6 +668,121 @@ var (
 		Usage: "Maximum gas price will be recommended by gpo",
 		Value: eth.DefaultConfig.GPO.MaxPrice.Int64(),
 	}
+
+	// Trace recorder settings
+	TraceSyncFlag = cli.BoolFlag{
+		Name:  "trace.sync",
+		Usage: "Record the traces of the transactions in imported blocks",
+	}
+	TraceRealtimeFlag = cli.BoolFlag{
+		Name:  "trace.realtime",
+		Usage: "Simulate pending transactions and record their traces",
+	}
+	TraceRollingFlag = cli.BoolFlag{
+		Name:  "trace.rolling",
+		Usage: "Stack simulated pending transactions on a shared pending state, ordered like the miner would",
+	}
+	TraceStateFlag = cli.BoolFlag{
+		Name:  "trace.state",
+		Usage: "Record the state read and write sets of traced transactions",
+	}
+	TraceSinkFlag = cli.StringFlag{
+		Name:  "trace.sink",
+		Usage: "Backend to record transaction traces to (mongodb://host, file:///dir, leveldb:///dir, memory://)",
+		Value: eth.DefaultConfig.Trace.Sink,
+	}
+	TraceDatabaseFlag = cli.StringFlag{
+		Name:  "trace.db",
+		Usage: "MongoDB database to record transaction traces to",
+		Value: eth.DefaultConfig.Trace.Database,
+	}
+	TraceHistoryFlag = cli.StringFlag{
+		Name:  "trace.history",
+		Usage: "Collection (or file) name for the traces of imported transactions",
+		Value: eth.DefaultConfig.Trace.History,
+	}
+	TracePendingFlag = cli.StringFlag{
+		Name:  "trace.pending",
+		Usage: "Collection (or file) name for the traces of simulated transactions",
+		Value: eth.DefaultConfig.Trace.Pending,
+	}
+	TraceBatchSizeFlag = cli.IntFlag{
+		Name:  "trace.batch",
+		Usage: "Number of trace records inserted into the database at once",
+		Value: eth.DefaultConfig.Trace.BatchSize,
+	}
+	TraceErrorLogFlag = cli.StringFlag{
+		Name:  "trace.errorlog",
+		Usage: "File to log the trace records which could not be stored to",
+		Value: eth.DefaultConfig.Trace.ErrorLog,
+	}
+	TracePauseLagFlag = cli.Uint64Flag{
+		Name:  "trace.lag.pause",
+		Usage: "Number of blocks behind the network after which tracing and simulation pause",
+		Value: eth.DefaultConfig.Trace.PauseLag,
+	}
+	TraceResumeLagFlag = cli.Uint64Flag{
+		Name:  "trace.lag.resume",
+		Usage: "Number of blocks behind the network within which tracing and simulation resume",
+		Value: eth.DefaultConfig.Trace.ResumeLag,
+	}
+	TraceKindsFlag = cli.StringFlag{
+		Name:  "trace.kinds",
+		Usage: "Comma separated kinds of pending transactions to simulate (call, create, transfer, unprotected)",
+		Value: strings.Join(eth.DefaultConfig.Trace.Kinds, ","),
+	}
+	TraceWorkersFlag = cli.IntFlag{
+		Name:  "trace.workers",
+		Usage: "Number of pending transactions simulated in parallel",
+		Value: eth.DefaultConfig.Trace.Workers,
+	}
+	TraceQueueFlag = cli.IntFlag{
+		Name:  "trace.queue",
+		Usage: "Maximum number of pending transactions waiting for simulation, excess ones are dropped",
+		Value: eth.DefaultConfig.Trace.QueueSize,
+	}
+	TracePoolJournalFlag = cli.StringFlag{
+		Name:  "trace.pool.journal",
+		Usage: "Disk journal for queued and simulated transactions to survive node restarts",
+		Value: eth.DefaultConfig.Trace.PoolJournal,
+	}
+	TracePoolRejournalFlag = cli.DurationFlag{
+		Name:  "trace.pool.rejournal",
+		Usage: "Time interval to regenerate the simulation journal",
+		Value: eth.DefaultConfig.Trace.PoolRejournal,
+	}
+	TracePoolQueueFlag = cli.IntFlag{
+		Name:  "trace.pool.queue",
+		Usage: "Maximum number of transactions waiting for a nonce gap to be filled before simulation",
+		Value: eth.DefaultConfig.Trace.PoolQueue,
+	}
+	TracePoolExecutedFlag = cli.IntFlag{
+		Name:  "trace.pool.executed",
+		Usage: "Maximum number of simulated transactions remembered to avoid simulating them again",
+		Value: eth.DefaultConfig.Trace.PoolExecuted,
+	}
+	TracePoolLifetimeFlag = cli.DurationFlag{
+		Name:  "trace.pool.lifetime",
+		Usage: "Maximum amount of time transactions are queued or remembered by the simulator",
+		Value: eth.DefaultConfig.Trace.PoolLifetime,
+	}
+	TraceCoinbaseFlag = cli.StringFlag{
+		Name:  "trace.coinbase",
+		Usage: "Coinbase of the blocks pending transactions are simulated in (default = miner etherbase)",
+	}
+	TraceBlockIntervalFlag = cli.DurationFlag{
+		Name:  "trace.interval",
+		Usage: "Expected time between blocks, simulated blocks are timestamped that long after their parent",
+		Value: eth.DefaultConfig.Trace.BlockInterval,
+	}
+	TraceProbeFlag = cli.BoolFlag{
+		Name:  "trace.probe",
+		Usage: "Simulate pending transactions again with another coinbase and timestamp to flag context sensitive ones",
+	}
+	TraceCorrelateFlag = cli.BoolFlag{
+		Name:  "trace.correlate",
+		Usage: "Trace imported blocks to compare simulations with the mined executions, not only with their receipts (implied by --trace.sync)",
+	}
 	WhisperEnabledFlag = cli.BoolFlag{
 		Name:  "shh",
 		Usage: "Enable Whisper",
@@ -1329,6 +1450,85 @@ func setGPO(ctx *cli.Context, cfg *gasprice.Config, light bool) {
 	}
 }
 
+func setTrace(ctx *cli.Context, cfg *trace.Config) {
+	if ctx.GlobalIsSet(TraceSyncFlag.Name) {
+		cfg.Sync = ctx.GlobalBool(TraceSyncFlag.Name)
+	}
+	if ctx.GlobalIsSet(TraceRealtimeFlag.Name) {
+		cfg.Realtime = ctx.GlobalBool(TraceRealtimeFlag.Name)
+	}
+	if ctx.GlobalIsSet(TraceRollingFlag.Name) {
+		cfg.Rolling = ctx.GlobalBool(TraceRollingFlag.Name)
+	}
+	if ctx.GlobalIsSet(TraceStateFlag.Name) {
+		cfg.State = ctx.GlobalBool(TraceStateFlag.Name)
+	}
+	if ctx.GlobalIsSet(TraceSinkFlag.Name) {
+		cfg.Sink = ctx.GlobalString(TraceSinkFlag.Name)
+	}
+	if ctx.GlobalIsSet(TraceDatabaseFlag.Name) {
+		cfg.Database = ctx.GlobalString(TraceDatabaseFlag.Name)
+	}
+	if ctx.GlobalIsSet(TraceHistoryFlag.Name) {
+		cfg.History = ctx.GlobalString(TraceHistoryFlag.Name)
+	}
+	if ctx.GlobalIsSet(TracePendingFlag.Name) {
+		cfg.Pending = ctx.GlobalString(TracePendingFlag.Name)
+	}
+	if ctx.GlobalIsSet(TraceBatchSizeFlag.Name) {
+		cfg.BatchSize = ctx.GlobalInt(TraceBatchSizeFlag.Name)
+	}
+	if ctx.GlobalIsSet(TraceErrorLogFlag.Name) {
+		cfg.ErrorLog = ctx.GlobalString(TraceErrorLogFlag.Name)
+	}
+	if ctx.GlobalIsSet(TracePauseLagFlag.Name) {
+		cfg.PauseLag = ctx.GlobalUint64(TracePauseLagFlag.Name)
+	}
+	if ctx.GlobalIsSet(TraceResumeLagFlag.Name) {
+		cfg.ResumeLag = ctx.GlobalUint64(TraceResumeLagFlag.Name)
+	}
+	if ctx.GlobalIsSet(TraceKindsFlag.Name) {
+		cfg.Kinds = strings.Split(ctx.GlobalString(TraceKindsFlag.Name), ",")
+	}
+	if ctx.GlobalIsSet(TraceWorkersFlag.Name) {
+		cfg.Workers = ctx.GlobalInt(TraceWorkersFlag.Name)
+	}
+	if ctx.GlobalIsSet(TraceQueueFlag.Name) {
+		cfg.QueueSize = ctx.GlobalInt(TraceQueueFlag.Name)
+	}
+	if ctx.GlobalIsSet(TracePoolJournalFlag.Name) {
+		cfg.PoolJournal = ctx.GlobalString(TracePoolJournalFlag.Name)
+	}
+	if ctx.GlobalIsSet(TracePoolRejournalFlag.Name) {
+		cfg.PoolRejournal = ctx.GlobalDuration(TracePoolRejournalFlag.Name)
+	}
+	if ctx.GlobalIsSet(TracePoolQueueFlag.Name) {
+		cfg.PoolQueue = ctx.GlobalInt(TracePoolQueueFlag.Name)
+	}
+	if ctx.GlobalIsSet(TracePoolExecutedFlag.Name) {
+		cfg.PoolExecuted = ctx.GlobalInt(TracePoolExecutedFlag.Name)
+	}
+	if ctx.GlobalIsSet(TracePoolLifetimeFlag.Name) {
+		cfg.PoolLifetime = ctx.GlobalDuration(TracePoolLifetimeFlag.Name)
+	}
+	if ctx.GlobalIsSet(TraceCoinbaseFlag.Name) {
+		coinbase := ctx.GlobalString(TraceCoinbaseFlag.Name)
+		if !common.IsHexAddress(coinbase) {
+			Fatalf("Invalid trace coinbase: %s", coinbase)
+		}
+		cfg.Coinbase = common.HexToAddress(coinbase)
+	}
+	if ctx.GlobalIsSet(TraceBlockIntervalFlag.Name) {
+		cfg.BlockInterval = ctx.GlobalDuration(TraceBlockIntervalFlag.Name)
+	}
+	if ctx.GlobalIsSet(TraceProbeFlag.Name) {
+		cfg.Probe = ctx.GlobalBool(TraceProbeFlag.Name)
+	}
+	if ctx.GlobalIsSet(TraceCorrelateFlag.Name) {
+		cfg.Correlate = ctx.GlobalBool(TraceCorrelateFlag.Name)
+	}
+}
+
 func setTxPool(ctx *cli.Context, cfg *core.TxPoolConfig) {
 	if ctx.GlobalIsSet(TxPoolLocalsFlag.Name) {
 		locals := strings.Split(ctx.GlobalString(TxPoolLocalsFlag.Name), ",")
@@ -1526,6 +1726,7 @@ func SetEthConfig(ctx *cli.Context, stack *node.Node, cfg *eth.Config) {
 	setEtherbase(ctx, ks, cfg)
 	setGPO(ctx, &cfg.GPO, ctx.GlobalString(SyncModeFlag.Name) == "light")
 	setTxPool(ctx, &cfg.TxPool)
+	setTrace(ctx, &cfg.Trace)
 	setEthash(ctx, cfg)
 	setMiner(ctx, &cfg.Miner)
 	setWhitelist(ctx, cfg)
@@ -1613,6 +1814,9 @@ func SetEthConfig(ctx *cli.Context, stack *node.Node, cfg *eth.Config) {
 	if ctx.GlobalIsSet(RPCGlobalTxFeeCapFlag.Name) {
 		cfg.RPCTxFeeCap = ctx.GlobalFloat64(RPCGlobalTxFeeCapFlag.Name)
 	}
+	if ctx.GlobalIsSet(RPCGlobalTraceFilterRangeFlag.Name) {
+		cfg.RPCTraceFilterRange = ctx.GlobalUint64(RPCGlobalTraceFilterRangeFlag.Name)
+	}
 	if ctx.GlobalIsSet(NoDiscoverFlag.Name) {
 		cfg.EthDiscoveryURLs, cfg.SnapDiscoveryURLs = []string{}, []string{}
 	} else if ctx.GlobalIsSet(DNSDiscoveryFlag.Name) {
@@ -47,7 +47,6 @@ import (
 	lru "github.com/hashicorp/golang-lru"
 
 	"github.com/ethereum/go-ethereum/trace"
-	"encoding/json"
 )
 
 var (
@@ -209,6 +208,8 @@ type BlockChain struct {
 	prefetcher Prefetcher
 	processor  Processor // Block transaction processor interface
 	vmConfig   vm.Config
+	traceSink  trace.Sink       // Destination of the trace records of imported transactions (nil = disabled)
+	traceSync  trace.SyncStatus // Gates the trace recording to when the node is synced (nil = always record)
 
 	shouldPreserve     func(*types.Block) bool        // Function used to determine whether should preserve the given block.
 	terminateInsert    func(common.Hash, uint64) bool // Testing hook used to terminate ancient receipt chain insertion.
@@ -219,9 +220,6 @@ type BlockChain struct {
 // available in the database. It initialises the default Ethereum Validator and
 // Processor.
 func NewBlockChain(db ethdb.Database, cacheConfig *CacheConfig, chainConfig *params.ChainConfig, engine consensus.Engine, vmConfig vm.Config, shouldPreserve func(block *types.Block) bool, txLookupLimit *uint64) (*BlockChain, error) {
-	// // Start Mongodb
-	// trace.InitMongoDb()
-	
 	if cacheConfig == nil {
 		cacheConfig = defaultCacheConfig
 	}
@@ -409,6 +407,27 @@ func (bc *BlockChain) GetVMConfig() *vm.Config {
 	return &bc.vmConfig
 }
 
+// SetTraceSink sets the destination of the trace records of the transactions
+// in imported blocks. The sink is closed when the chain is stopped.
+func (bc *BlockChain) SetTraceSink(sink trace.Sink) {
+	bc.traceSink = sink
+}
+
+// SetTraceSyncStatus restricts recording the traces of imported transactions
+// to when the given status reports the node as synced.
+func (bc *BlockChain) SetTraceSyncStatus(status trace.SyncStatus) {
+	bc.traceSync = status
+}
+
+// traceSinkIfSynced returns the trace sink of the imported transactions if the
+// traces are to be recorded, or nil otherwise.
+func (bc *BlockChain) traceSinkIfSynced() trace.Sink {
+	if bc.traceSync != nil && !bc.traceSync.Synced() {
+		return nil
+	}
+	return bc.traceSink
+}
+
 // empty returns an indicator whether the blockchain is empty.
 // Note, it's a special case that we connect a non-empty ancient
 // database with an empty node, so that we can plugin the ancient
@@ -1056,28 +1075,12 @@ func (bc *BlockChain) Stop() {
 		triedb.SaveCache(bc.cacheConfig.TrieCleanJournal)
 	}
 
-	log.Info("Closing the node ")
-	log.Info("lef number ", trace.CurrentNum)
-	// fmt.Println("before closing, current remaining txs ", trace.CurrentNum)
-	log.Info("deal with the left txs")
-	session_err := trace.DBAll.Insert(trace.BashTxs[0:trace.CurrentNum+1]) 
-	if session_err != nil {
-		trace.SessionGlobal.Refresh()
-		for i := 0; i < trace.CurrentNum + 1; i++ {
-			 session_err = trace.DBAll.Insert(&trace.BashTxs[i]) 
-			 if session_err != nil {
-				json_tx, json_err := json.Marshal(&trace.BashTxs[i])
-				if json_err != nil {
-					trace.ErrorFile.WriteString(fmt.Sprintf("Transaction;%s;%s\n", trace.BashTxs[i].(trace.TransactionAll).TxHash, json_err))
-				}
-				trace.ErrorFile.WriteString(fmt.Sprintf("Transaction|%s|%s\n", json_tx, session_err))
-		      }
-		 }
-	}
-	log.Info("deal ok")
-	log.Info("Close mongodb and error file in the blockchain.go")
-	trace.SessionGlobal.Close()
-	trace.ErrorFile.Close()
+	// Write out the trace records still waiting in the current batch
+	if bc.traceSink != nil {
+		if err := bc.traceSink.Close(); err != nil {
+			log.Error("Failed to close trace sink", "err", err)
+		}
+	}
 
 	log.Info("Blockchain stopped")
 
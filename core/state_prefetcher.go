@@ -94,8 +94,7 @@ func precacheTransaction(config *params.ChainConfig, bc ChainContext, author *co
 	// Create the EVM and execute the transaction
 	context := NewEVMBlockContext(header, bc, author)
 	txContext := NewEVMTxContext(msg)
-	// vm := vm.NewEVM(context, txContext, statedb, config, cfg)
-	vm := vm.NewEVMWithFlag(context, txContext, statedb, config, cfg, true, true)
+	vm := vm.NewEVM(context, txContext, statedb, config, cfg)
 
 
 	// fmt.Printf("precacheTransaction.go precacheTransaction\n")
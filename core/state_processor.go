@@ -17,7 +17,9 @@
 package core
 
 import (
+	"errors"
 	"fmt"
+	"math/big"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/consensus"
@@ -26,14 +28,10 @@ import (
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/core/vm"
 	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/params"
 
 	"github.com/ethereum/go-ethereum/trace"
-	"encoding/json"
-	"encoding/hex"
-	"strconv"
-	// "os"
-
 )
 
 // StateProcessor is a basic Processor, which takes care of transitioning
@@ -63,7 +61,19 @@ func NewStateProcessor(config *params.ChainConfig, bc *BlockChain, engine consen
 // returns the amount of gas that was used in the process. If any of the
 // transactions failed to execute due to insufficient gas it will return an error.
 func (p *StateProcessor) Process(block *types.Block, statedb *state.StateDB, cfg vm.Config) (types.Receipts, []*types.Log, uint64, error) {
-	// trace.SyncFlag = true
+	// Record the traces of the transactions only if they are going to be stored
+	sink := p.bc.traceSinkIfSynced()
+
+	receipts, allLogs, usedGas, err := p.process(block, statedb, cfg, sink)
+	if err == nil && sink != nil {
+		log.Debug("Recorded block traces", "number", block.Number(), "txs", len(block.Transactions()))
+	}
+	return receipts, allLogs, usedGas, err
+}
+
+// process is Process writing the trace record of every transaction to the
+// given sink, unless it is nil.
+func (p *StateProcessor) process(block *types.Block, statedb *state.StateDB, cfg vm.Config, sink trace.Sink) (types.Receipts, []*types.Log, uint64, error) {
 	var (
 		receipts types.Receipts
 		usedGas  = new(uint64)
@@ -75,10 +85,11 @@ func (p *StateProcessor) Process(block *types.Block, statedb *state.StateDB, cfg
 	if p.config.DAOForkSupport && p.config.DAOForkBlock != nil && p.config.DAOForkBlock.Cmp(block.Number()) == 0 {
 		misc.ApplyDAOHardFork(statedb)
 	}
+	if sink != nil {
+		cfg = vm.WithTraceRecorder(cfg)
+	}
 	blockContext := NewEVMBlockContext(header, p.bc, nil)
-
-	// vmenv := vm.NewEVM(blockContext, vm.TxContext{}, statedb, p.config, cfg)
-	vmenv := vm.NewEVMWithFlag(blockContext, vm.TxContext{}, statedb, p.config, cfg, false, true)
+	vmenv := vm.NewEVM(blockContext, vm.TxContext{}, statedb, p.config, cfg)
 
 	// Iterate over and process the individual transactions
 	for i, tx := range block.Transactions() {
@@ -88,35 +99,29 @@ func (p *StateProcessor) Process(block *types.Block, statedb *state.StateDB, cfg
 		}
 		statedb.Prepare(tx.Hash(), block.Hash(), i)
 
-		receipt, err := applyTransaction(msg, p.config, p.bc, nil, gp, statedb, header, tx, usedGas, vmenv)
+		receipt, collector, err := applyTransaction(msg, p.config, p.bc, nil, gp, statedb, header, tx, usedGas, vmenv)
 		if err != nil {
 			return nil, nil, 0, fmt.Errorf("could not apply tx %d [%v]: %w", i, tx.Hash().Hex(), err)
 		}
+		if sink != nil {
+			if err := sink.Write(collector.Record(receipt.TxHash)); err != nil {
+				log.Warn("Failed to write trace record", "hash", receipt.TxHash, "err", err)
+			}
+		}
 		receipts = append(receipts, receipt)
 		allLogs = append(allLogs, receipt.Logs...)
 	}
 
-	if trace.SyncedDone == true {
-		fmt.Printf("Process: block number %d transaction number %d\n", block.Number(), len(block.Transactions()))
-	}
-
 	// Finalize the block, applying any consensus engine specific extras (e.g. block rewards)
 	p.engine.Finalize(p.bc, header, statedb, block.Transactions(), block.Uncles())
-	
+
 	return receipts, allLogs, *usedGas, nil
 }
 
-func applyTransaction(msg types.Message, config *params.ChainConfig, bc ChainContext, author *common.Address, gp *GasPool, statedb *state.StateDB, header *types.Header, tx *types.Transaction, usedGas *uint64, evm *vm.EVM) (*types.Receipt, error) {
-	trace.CurrentTxIndex += 1
-	// # step prep: ensure the currentIndex is 1	
-	trace.CurrentTraceIndex = 0
-	trace.Traces = []trace.TraceN{}
-	trace.TransferLogs = []trace.TransferLog{}
-	trace.GTxReceipt = &trace.TxReceipt{}
-	trace.CreatedSC = []string{}
-	trace.CallDepth = 0
-	trace.CallNum = -1
-
+// applyTransaction runs the transaction on the given EVM. If the EVM records
+// traces, the collector holding the trace of the transaction is returned
+// alongside the receipt, otherwise the collector is nil.
+func applyTransaction(msg types.Message, config *params.ChainConfig, bc ChainContext, author *common.Address, gp *GasPool, statedb *state.StateDB, header *types.Header, tx *types.Transaction, usedGas *uint64, evm *vm.EVM) (*types.Receipt, *trace.TraceCollector, error) {
 	// Create a new context to be used in the EVM environment
 	txContext := NewEVMTxContext(msg)
 	// Add addresses to access list if applicable
@@ -133,10 +138,14 @@ func applyTransaction(msg types.Message, config *params.ChainConfig, bc ChainCon
 
 	// Update the evm with the new transaction context.
 	evm.Reset(txContext, statedb)
-	// Apply the transaction to the current state (included in the env)	
+	// Apply the transaction to the current state (included in the env)
 	result, err := ApplyMessage(evm, msg, gp)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+	collector := evm.TraceCollector()
+	if collector != nil {
+		collector.FinaliseState(statedb)
 	}
 	// Update the state with pending changes
 	var root []byte
@@ -163,70 +172,10 @@ func applyTransaction(msg types.Message, config *params.ChainConfig, bc ChainCon
 	receipt.BlockNumber = header.Number
 	receipt.TransactionIndex = uint(statedb.TxIndex())
 
-	// Test for the mining process
-	trace.GTxReceipt.BlockNum = receipt.BlockNumber.String()
-	trace.GTxReceipt.FromAddr = msg.From().String()
-	if msg.To() == nil {
-		trace.GTxReceipt.ToAddr = "0x"
-	} else {
-		trace.GTxReceipt.ToAddr = msg.To().String()
-	}
-	trace.GTxReceipt.Gas = strconv.FormatUint(msg.Gas(), 10)
-	trace.GTxReceipt.GasUsed = strconv.FormatUint(receipt.GasUsed, 10)
-	trace.GTxReceipt.GasPrice = msg.GasPrice().String()
-	// trace.GTxReceipt.TxHash = receipt.TxHash.String() 
-	trace.GTxReceipt.TxIndex = receipt.TransactionIndex
-	trace.GTxReceipt.Value = msg.Value().String()
-	trace.GTxReceipt.Input = hex.EncodeToString(msg.Data())
-	trace.GTxReceipt.Status = strconv.FormatUint(receipt.Status, 10)
-	if result.Err == nil {
-		trace.GTxReceipt.Err = ""	
-	} else {
-		trace.GTxReceipt.Err = result.Err.Error()
-	}
-
-
-	json_receipt, _ := json.Marshal(trace.GTxReceipt)
-	json_transferlogs, _ := json.Marshal(trace.TransferLogs)
-	json_traces, _ := json.Marshal(trace.Traces)
-	json_createdsc, _ := json.Marshal(trace.CreatedSC)
-
-	current_tx := trace.TransactionAll{
-		TxHash: receipt.TxHash.String(),
-		TxReceipt: string(json_receipt),
-		TxTransferLogs: string(json_transferlogs),
-		TxTraces: string(json_traces),
-		TxCreatedSC: string(json_createdsc),
+	if collector != nil {
+		fillTraceReceipt(collector.Receipt, msg, receipt, result, evm.Context.Coinbase)
 	}
-
-
-	if trace.SyncedDone == true {
-		// bash insert
-		trace.BashTxs[trace.CurrentNum] = current_tx
-		if trace.CurrentNum != trace.BashNum - 1 {
-			trace.CurrentNum = trace.CurrentNum + 1
-		} else {
-			// fmt.Println("Bash insert 100 tx")
-			session_err := trace.DBAll.Insert(trace.BashTxs...) 
-			if session_err != nil {
-				trace.SessionGlobal.Refresh()
-				for i := 0; i < trace.BashNum; i++ {
-					 session_err = trace.DBAll.Insert(&trace.BashTxs[i]) 
-					 if session_err != nil {
-						json_tx, json_err := json.Marshal(&trace.BashTxs[i])
-						if json_err != nil {
-							trace.ErrorFile.WriteString(fmt.Sprintf("Transaction;%s;%s\n", trace.BashTxs[i].(trace.TransactionAll).TxHash, json_err))
-						}
-						trace.ErrorFile.WriteString(fmt.Sprintf("Transaction|%s|%s\n", json_tx, session_err))
-				      }
-				 }
-			}
-			trace.CurrentNum = 0
-			// trace.Round += 1
-		}	
-	}
-	
-	return receipt, err
+	return receipt, collector, err
 }
 
 // ApplyTransaction attempts to apply a transaction to the given state database
@@ -240,25 +189,20 @@ func ApplyTransaction(config *params.ChainConfig, bc ChainContext, author *commo
 	}
 	// Create a new context to be used in the EVM environment
 	blockContext := NewEVMBlockContext(header, bc, author)
-	// vmenv := vm.NewEVM(blockContext, vm.TxContext{}, statedb, config, cfg)
-	vmenv := vm.NewEVMWithFlag(blockContext, vm.TxContext{}, statedb, config, cfg, false, true)
-	return applyTransaction(msg, config, bc, author, gp, statedb, header, tx, usedGas, vmenv)
+	vmenv := vm.NewEVM(blockContext, vm.TxContext{}, statedb, config, cfg)
+	receipt, _, err := applyTransaction(msg, config, bc, author, gp, statedb, header, tx, usedGas, vmenv)
+	return receipt, err
 }
 
+// errNoTraceRecorder is returned when simulating a transaction on an EVM not
+// configured to record its trace.
+var errNoTraceRecorder = errors.New("trace recorder not configured")
 
-func rtapplyTransaction(msg types.Message, config *params.ChainConfig, bc ChainContext, author *common.Address, gp *GasPool, statedb *state.StateDB, header *types.Header, tx *types.Transaction, usedGas *uint64, evm *vm.EVM) (*types.Receipt, error) {
-	// borrow the settings from the trace for now, 
-	// assuming the replay does not work
-	trace.SimCurrentTxIndex += 1
-	trace.SimCurrentTraceIndex = 0
-	trace.SimTraces = []trace.TraceN{}
-	trace.SimTransferLogs = []trace.TransferLog{}
-	trace.SimGTxReceipt = &trace.TxReceipt{}
-	trace.SimCreatedSC = []string{}
-	trace.SimCallDepth = 0
-	trace.SimCallNum = -1
-
-	// fmt.Println("test1")
+// rtapplyTransaction runs a pending transaction on top of the given state for
+// simulation purposes. Unlike applyTransaction it leaves the state unfinalised,
+// so the caller can revert it afterwards. The EVM must record traces, see
+// vm.WithTraceRecorder.
+func rtapplyTransaction(msg types.Message, config *params.ChainConfig, bc ChainContext, author *common.Address, gp *GasPool, statedb *state.StateDB, header *types.Header, tx *types.Transaction, usedGas *uint64, evm *vm.EVM) (*types.Receipt, *trace.TraceCollector, error) {
 	// Create a new context to be used in the EVM environment
 	txContext := NewEVMTxContext(msg)
 	// Add addresses to access list if applicable
@@ -273,38 +217,22 @@ func rtapplyTransaction(msg types.Message, config *params.ChainConfig, bc ChainC
 		}
 	}
 
-	// fmt.Println("test2")
 	// Update the evm with the new transaction context.
 	evm.Reset(txContext, statedb)
-	// Apply the transaction to the current state (included in the env)	
+	// Apply the transaction to the current state (included in the env)
 	result, err := ApplyMessage(evm, msg, gp)
 	if err != nil {
-		// fmt.Printf("before test3, err %s\n", err.Error())
-		return nil, err
+		return nil, nil, err
 	}
-	
-	// ignore this step so far
+	collector := evm.TraceCollector()
+	if collector == nil {
+		return nil, nil, errNoTraceRecorder
+	}
+	collector.FinaliseState(statedb)
+	// The simulated state is thrown away, so there is no intermediate root
 	var root []byte
-	// if config.IsByzantium(header.Number) {
-	// 	fmt.Println("IsByzantium")
-	// } else {
-	// 	fmt.Println("IsByzantium not")
-	// }
-	// Update the state with pending changes
-	// var root []byte
-	// if config.IsByzantium(header.Number) {
-	// 	fmt.Println("IsByzantium")
-	// 	statedb.Finalise(true)
-	// } else {
-	// 	fmt.Println("IsByzantium not")
-	// 	root = statedb.IntermediateRoot(config.IsEIP158(header.Number)).Bytes()
-	// }
-
-
 	*usedGas += result.UsedGas
 
-
-	// fmt.Println("test3")
 	// Create a new receipt for the transaction, storing the intermediate root and gas used by the tx
 	// based on the eip phase, we're passing whether the root touch-delete accounts.
 	receipt := types.NewReceipt(root, result.Failed(), *usedGas)
@@ -321,96 +249,46 @@ func rtapplyTransaction(msg types.Message, config *params.ChainConfig, bc ChainC
 	receipt.BlockNumber = header.Number
 	receipt.TransactionIndex = uint(statedb.TxIndex())
 
-	// Test for the mining process
-	trace.SimGTxReceipt.BlockNum = receipt.BlockNumber.String()
-	// fmt.Printf("block number %d\n", header.Number)
-	trace.SimGTxReceipt.FromAddr = msg.From().String()
-	// fmt.Printf("from address %s\n", msg.From().String())
-	if msg.To() == nil {
-		trace.SimGTxReceipt.ToAddr = "0x"
-	} else {
-		trace.SimGTxReceipt.ToAddr = trace.SimGTxReceipt.ToAddr
-	}
-	// fmt.Printf("to address %s\n", msg.From().String())
-
-	trace.SimGTxReceipt.Gas = strconv.FormatUint(msg.Gas(), 10)
-	trace.SimGTxReceipt.GasUsed = strconv.FormatUint(receipt.GasUsed, 10)
-	trace.SimGTxReceipt.GasPrice = msg.GasPrice().String()
-	trace.SimGTxReceipt.TxIndex = receipt.TransactionIndex
-	trace.SimGTxReceipt.Value = msg.Value().String()
-	trace.SimGTxReceipt.Input = hex.EncodeToString(msg.Data())
-	trace.SimGTxReceipt.Status = strconv.FormatUint(receipt.Status, 10)
-	if result.Err == nil {
-		trace.SimGTxReceipt.Err = ""	
-	} else {
-		trace.SimGTxReceipt.Err = result.Err.Error()
-	}
-
-	// fmt.Println("test4")
-	json_receipt, _ := json.Marshal(trace.SimGTxReceipt)
-	json_transferlogs, _ := json.Marshal(trace.SimTransferLogs)
-	json_traces, _ := json.Marshal(trace.SimTraces)
-	json_createdsc, _ := json.Marshal(trace.SimCreatedSC)
-
-	current_tx := trace.TransactionAll{
-		TxHash: receipt.TxHash.String(),
-		TxReceipt: string(json_receipt),
-		TxTransferLogs: string(json_transferlogs),
-		TxTraces: string(json_traces),
-		TxCreatedSC: string(json_createdsc),
-	}
-
-	// // Does not insert for now
-	// bash insert
-	trace.SimBashTxs[trace.SimCurrentNum] = current_tx
-	if trace.SimCurrentNum != trace.SimBashNum - 1 {
-		trace.SimCurrentNum = trace.SimCurrentNum + 1
-	} else {
-		session_err := trace.Realtime.Insert(trace.SimBashTxs...) 
-		if session_err != nil {
-			trace.SessionGlobal.Refresh()
-			for i := 0; i < trace.SimBashNum; i++ {
-				 session_err = trace.Realtime.Insert(&trace.SimBashTxs[i]) 
-				 if session_err != nil {
-					json_tx, json_err := json.Marshal(&trace.SimBashTxs[i])
-					if json_err != nil {
-						trace.SimErrorFile.WriteString(fmt.Sprintf("Transaction;%s;%s\n", trace.SimBashTxs[i].(trace.TransactionAll).TxHash, json_err))
-					}
-					trace.SimErrorFile.WriteString(fmt.Sprintf("Transaction|%s|%s\n", json_tx, session_err))
-			      }
-			 }
-		}
-		trace.SimCurrentNum = 0
-		// trace.SimRound += 1
-	}
-
-
-	return receipt, err
+	fillTraceReceipt(collector.Receipt, msg, receipt, result, evm.Context.Coinbase)
+	return receipt, collector, err
 }
 
-
 // RTApplyTransaction attempts to apply a transaction realtime to the given state database
 // and uses the input parameters for its environment. It returns the receipt
-// for the transaction, gas used and an error if the transaction failed,
-// indicating the block was invalid.
-func RTApplyTransaction(config *params.ChainConfig, bc ChainContext, author *common.Address, gp *GasPool, statedb *state.StateDB, header *types.Header, tx *types.Transaction, usedGas *uint64, cfg vm.Config) (*types.Receipt, error) {
-	// fmt.Println("RTApplyTransaction function")
+// for the transaction and the trace collected while executing it, or an error
+// if the transaction could not be applied. The trace is recorded alongside
+// the tracer configured in cfg, if any.
+func RTApplyTransaction(config *params.ChainConfig, bc ChainContext, author *common.Address, gp *GasPool, statedb *state.StateDB, header *types.Header, tx *types.Transaction, usedGas *uint64, cfg vm.Config) (*types.Receipt, *trace.TraceCollector, error) {
 	msg, err := tx.AsMessage(types.MakeSigner(config, header.Number))
-	// fmt.Println("*")
-	// fmt.Println(msg.From())
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
-	// fmt.Println("**")
+	cfg = vm.WithTraceRecorder(cfg)
 	// Create a new context to be used in the EVM environment
 	blockContext := NewEVMBlockContext(header, bc, author)
-	// fmt.Println("***")
-	// vmenv := vm.NewEVM(blockContext, vm.TxContext{}, statedb, config, cfg)
-	vmenv := vm.NewEVMWithFlag(blockContext, vm.TxContext{}, statedb, config, cfg, false, false)
-	// fmt.Println("*****")
+	vmenv := vm.NewEVM(blockContext, vm.TxContext{}, statedb, config, cfg)
 	return rtapplyTransaction(msg, config, bc, author, gp, statedb, header, tx, usedGas, vmenv)
 }
 
-
-
-
+// fillTraceReceipt copies the outcome of an executed transaction into the
+// receipt section of its trace record, including the gas fee paid to coinbase.
+func fillTraceReceipt(r *trace.TxReceipt, msg types.Message, receipt *types.Receipt, result *ExecutionResult, coinbase common.Address) {
+	r.BlockNum = new(big.Int).Set(receipt.BlockNumber)
+	r.FromAddr = msg.From()
+	if to := msg.To(); to != nil {
+		addr := *to
+		r.ToAddr = &addr
+	}
+	r.Gas = msg.Gas()
+	r.GasUsed = receipt.GasUsed
+	r.GasPrice = new(big.Int).Set(msg.GasPrice())
+	r.GasFee = new(big.Int).Mul(new(big.Int).SetUint64(receipt.GasUsed), msg.GasPrice())
+	r.Coinbase = coinbase
+	r.TxIndex = uint64(receipt.TransactionIndex)
+	r.Value = new(big.Int).Set(msg.Value())
+	r.Input = common.CopyBytes(msg.Data())
+	r.Status = receipt.Status
+	if result.Err != nil {
+		r.Err = result.Err.Error()
+	}
+}
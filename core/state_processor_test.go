@@ -28,6 +28,7 @@ import (
 	"github.com/ethereum/go-ethereum/core/vm"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/trace"
 	"github.com/ethereum/go-ethereum/trie"
 	"golang.org/x/crypto/sha3"
 )
@@ -111,6 +112,147 @@ func TestStateProcessorErrors(t *testing.T) {
 	}
 }
 
+// TestRTApplyTransactionTrace tests that simulating a transaction records its
+// value transfers, their net balance changes and the gas fee paid separately.
+func TestRTApplyTransactionTrace(t *testing.T) {
+	var (
+		signer     = types.HomesteadSigner{}
+		testKey, _ = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		sender     = crypto.PubkeyToAddress(testKey.PublicKey)
+		recipient  = common.Address{0xbb}
+		coinbase   = common.Address{0xcc}
+		db         = rawdb.NewMemoryDatabase()
+		gspec      = &Genesis{
+			Config: params.TestChainConfig,
+			Alloc:  GenesisAlloc{sender: {Balance: big.NewInt(params.Ether)}},
+		}
+		genesis       = gspec.MustCommit(db)
+		blockchain, _ = NewBlockChain(db, nil, gspec.Config, ethash.NewFaker(), vm.Config{}, nil, nil)
+	)
+	defer blockchain.Stop()
+
+	statedb, err := blockchain.StateAt(genesis.Root())
+	if err != nil {
+		t.Fatalf("failed to load genesis state: %v", err)
+	}
+	header := &types.Header{
+		ParentHash: genesis.Hash(),
+		Number:     big.NewInt(1),
+		GasLimit:   genesis.GasLimit(),
+		Difficulty: genesis.Difficulty(),
+		Coinbase:   coinbase,
+	}
+	tx, _ := types.SignTx(types.NewTransaction(0, recipient, big.NewInt(1000), params.TxGas, big.NewInt(2), nil), signer, testKey)
+	statedb.Prepare(tx.Hash(), common.Hash{}, 0)
+
+	gp := new(GasPool).AddGas(header.GasLimit)
+	receipt, collector, err := RTApplyTransaction(gspec.Config, blockchain, nil, gp, statedb, header, tx, &header.GasUsed, vm.Config{})
+	if err != nil {
+		t.Fatalf("failed to apply transaction: %v", err)
+	}
+	record := collector.Record(receipt.TxHash)
+	if fee := record.TxReceipt.GasFee; fee == nil || fee.Uint64() != 2*params.TxGas {
+		t.Errorf("gas fee mismatch: have %v, want %d", fee, 2*params.TxGas)
+	}
+	if record.TxReceipt.Coinbase != coinbase {
+		t.Errorf("coinbase mismatch: have %x, want %x", record.TxReceipt.Coinbase, coinbase)
+	}
+	if len(record.TxBalances) != 2 {
+		t.Fatalf("balance delta count mismatch: have %d, want 2", len(record.TxBalances))
+	}
+	for i, want := range []struct {
+		addr common.Address
+		net  int64
+	}{{sender, -1000}, {recipient, 1000}} {
+		have := record.TxBalances[i]
+		if have.Address != want.addr || have.Standard != "ETH" || have.Net().Int64() != want.net {
+			t.Errorf("balance delta %d mismatch: have %x %s %v, want %x ETH %d", i, have.Address, have.Standard, have.Net(), want.addr, want.net)
+		}
+	}
+}
+
+func TestRTApplyTransactionStateAccess(t *testing.T) {
+	var (
+		signer     = types.HomesteadSigner{}
+		testKey, _ = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		sender     = crypto.PubkeyToAddress(testKey.PublicKey)
+		counter    = common.Address{0xcc}
+		db         = rawdb.NewMemoryDatabase()
+		gspec      = &Genesis{
+			Config: params.TestChainConfig,
+			Alloc: GenesisAlloc{
+				sender: {Balance: big.NewInt(params.Ether)},
+				// sstore(0, add(sload(0), 1))
+				counter: {
+					Code:    common.FromHex("0x60005460010160005500"),
+					Storage: map[common.Hash]common.Hash{{}: common.BigToHash(big.NewInt(5))},
+					Balance: new(big.Int),
+				},
+			},
+		}
+		genesis       = gspec.MustCommit(db)
+		vmConfig      = vm.Config{TraceStateAccess: true}
+		blockchain, _ = NewBlockChain(db, nil, gspec.Config, ethash.NewFaker(), vmConfig, nil, nil)
+	)
+	defer blockchain.Stop()
+
+	statedb, err := blockchain.StateAt(genesis.Root())
+	if err != nil {
+		t.Fatalf("failed to load genesis state: %v", err)
+	}
+	header := &types.Header{
+		ParentHash: genesis.Hash(),
+		Number:     big.NewInt(1),
+		GasLimit:   genesis.GasLimit(),
+		Difficulty: genesis.Difficulty(),
+	}
+	tx, _ := types.SignTx(types.NewTransaction(0, counter, new(big.Int), 100000, big.NewInt(1), nil), signer, testKey)
+	statedb.Prepare(tx.Hash(), common.Hash{}, 0)
+
+	gp := new(GasPool).AddGas(header.GasLimit)
+	receipt, collector, err := RTApplyTransaction(gspec.Config, blockchain, nil, gp, statedb, header, tx, &header.GasUsed, vmConfig)
+	if err != nil {
+		t.Fatalf("failed to apply transaction: %v", err)
+	}
+	access := collector.Record(receipt.TxHash).TxState
+	if access == nil {
+		t.Fatal("state access not recorded")
+	}
+	find := func(list []trace.StateAccess, addr common.Address, kind string) *trace.StateAccess {
+		for i := range list {
+			if list[i].Address == addr && list[i].Kind == kind {
+				return &list[i]
+			}
+		}
+		return nil
+	}
+	if read := find(access.Reads, counter, trace.StateStorage); read == nil || read.Value != common.BigToHash(big.NewInt(5)) {
+		t.Errorf("storage read mismatch: have %+v", read)
+	}
+	if read := find(access.Reads, counter, trace.StateCode); read == nil || read.Value != crypto.Keccak256Hash(common.FromHex("0x60005460010160005500")) {
+		t.Errorf("code read mismatch: have %+v", read)
+	}
+	if write := find(access.Writes, counter, trace.StateStorage); write == nil || write.Original != common.BigToHash(big.NewInt(5)) || write.Value != common.BigToHash(big.NewInt(6)) {
+		t.Errorf("storage write mismatch: have %+v", write)
+	}
+	if write := find(access.Writes, sender, trace.StateNonce); write == nil || write.Original != (common.Hash{}) || write.Value != common.BigToHash(common.Big1) {
+		t.Errorf("nonce write mismatch: have %+v", write)
+	}
+	if write := find(access.Writes, counter, trace.StateBalance); write != nil {
+		t.Errorf("unchanged balance recorded as written: %+v", write)
+	}
+	// Without the vm config flag nothing is recorded
+	tx, _ = types.SignTx(types.NewTransaction(1, counter, new(big.Int), 100000, big.NewInt(1), nil), signer, testKey)
+	statedb.Prepare(tx.Hash(), common.Hash{}, 1)
+	receipt, collector, err = RTApplyTransaction(gspec.Config, blockchain, nil, gp, statedb, header, tx, &header.GasUsed, vm.Config{})
+	if err != nil {
+		t.Fatalf("failed to apply transaction: %v", err)
+	}
+	if access := collector.Record(receipt.TxHash).TxState; access != nil {
+		t.Errorf("state access recorded while disabled: %+v", access)
+	}
+}
+
 // GenerateBadBlock constructs a "block" which contains the transactions. The transactions are not expected to be
 // valid, and no proper post-state can be made. But from the perspective of the blockchain, the block is sufficiently
 // valid to be considered for import:
@@ -0,0 +1,384 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/trace"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+// errTraceExportInterrupted is returned if a trace export is aborted before
+// all blocks were re-executed.
+var errTraceExportInterrupted = errors.New("trace export interrupted")
+
+// TraceExportConfig are the parameters of a trace export.
+type TraceExportConfig struct {
+	From uint64 // First block whose transactions are exported
+	To   uint64 // Last block whose transactions are exported
+
+	Workers   int    // Number of chunks re-executed in parallel
+	ChunkSize uint64 // Number of consecutive blocks re-executed and checkpointed together
+	Reexec    uint64 // Maximum number of blocks re-executed to regenerate a missing state
+	State     bool   // Whether to record the state read and write sets of the transactions
+
+	// Checkpoint is the file recording the exported chunks, so an interrupted
+	// export resumes where it stopped. Empty disables checkpointing.
+	Checkpoint string
+}
+
+// DefaultTraceExportConfig contains the default trace export settings.
+var DefaultTraceExportConfig = TraceExportConfig{
+	Workers:   4,
+	ChunkSize: 1000,
+	Reexec:    128,
+}
+
+// traceCheckpoint is the progress of a trace export, as persisted between runs.
+type traceCheckpoint struct {
+	From      uint64   `json:"from"`
+	To        uint64   `json:"to"`
+	ChunkSize uint64   `json:"chunkSize"`
+	Done      []uint64 `json:"done"` // First block of every exported chunk
+
+	path string
+	lock sync.Mutex
+}
+
+// loadTraceCheckpoint reads the checkpoint of the configured export, starting a
+// new one if the file does not exist yet. A checkpoint of another export is
+// rejected rather than overwritten.
+func loadTraceCheckpoint(config *TraceExportConfig) (*traceCheckpoint, error) {
+	checkpoint := &traceCheckpoint{
+		From:      config.From,
+		To:        config.To,
+		ChunkSize: config.ChunkSize,
+		path:      config.Checkpoint,
+	}
+	if config.Checkpoint == "" {
+		return checkpoint, nil
+	}
+	blob, err := ioutil.ReadFile(config.Checkpoint)
+	if os.IsNotExist(err) {
+		return checkpoint, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var stored traceCheckpoint
+	if err := json.Unmarshal(blob, &stored); err != nil {
+		return nil, fmt.Errorf("invalid trace export checkpoint %s: %v", config.Checkpoint, err)
+	}
+	if stored.From != config.From || stored.To != config.To || stored.ChunkSize != config.ChunkSize {
+		return nil, fmt.Errorf("trace export checkpoint %s belongs to blocks %d-%d in chunks of %d", config.Checkpoint, stored.From, stored.To, stored.ChunkSize)
+	}
+	checkpoint.Done = stored.Done
+	return checkpoint, nil
+}
+
+// exported reports whether the chunk starting at the given block was exported.
+func (c *traceCheckpoint) exported(start uint64) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	for _, done := range c.Done {
+		if done == start {
+			return true
+		}
+	}
+	return false
+}
+
+// markExported records the chunk starting at the given block as exported and
+// persists the checkpoint. The file is replaced atomically, so a crash leaves
+// either the previous or the updated checkpoint behind.
+func (c *traceCheckpoint) markExported(start uint64) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.Done = append(c.Done, start)
+	sort.Slice(c.Done, func(i, j int) bool { return c.Done[i] < c.Done[j] })
+
+	if c.path == "" {
+		return nil
+	}
+	blob, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(c.path+".tmp", blob, 0644); err != nil {
+		return err
+	}
+	return os.Rename(c.path+".tmp", c.path)
+}
+
+// ExportTraces re-executes the configured range of canonical blocks and writes
+// the trace record of every transaction to the sink, the way they are recorded
+// while the blocks are imported. The range is split into chunks re-executed in
+// parallel, each starting from the state of its parent block, which is
+// regenerated from an older state if not available. Exported chunks are
+// checkpointed once their records are flushed, and skipped when the export is
+// run again.
+//
+// The export stops early once the interrupt channel is closed.
+func ExportTraces(bc *BlockChain, sink trace.Sink, config *TraceExportConfig, interrupt <-chan struct{}) error {
+	if config.From == 0 {
+		return errors.New("genesis block has no transactions to export")
+	}
+	if config.To < config.From {
+		return fmt.Errorf("invalid trace export range %d-%d", config.From, config.To)
+	}
+	if head := bc.CurrentBlock().NumberU64(); config.To > head {
+		return fmt.Errorf("trace export beyond the chain head #%d", head)
+	}
+	sanitized := *config
+	config = &sanitized
+	if config.ChunkSize == 0 {
+		config.ChunkSize = DefaultTraceExportConfig.ChunkSize
+	}
+	if config.Workers <= 0 {
+		config.Workers = DefaultTraceExportConfig.Workers
+	}
+	checkpoint, err := loadTraceCheckpoint(config)
+	if err != nil {
+		return err
+	}
+	// Queue the chunks not exported yet and start the workers on them
+	chunks := make(chan uint64, (config.To-config.From)/config.ChunkSize+1)
+	for start := config.From; start <= config.To; start += config.ChunkSize {
+		if !checkpoint.exported(start) {
+			chunks <- start
+		}
+		if start+config.ChunkSize < start {
+			break // overflow
+		}
+	}
+	close(chunks)
+	log.Info("Exporting traces", "from", config.From, "to", config.To, "chunks", len(chunks), "workers", config.Workers)
+
+	var (
+		start    = time.Now()
+		exporter = &traceExporter{
+			chain:     bc,
+			processor: NewStateProcessor(bc.chainConfig, bc, bc.engine),
+			sink:      sink,
+			vmConfig:  vm.Config{TraceStateAccess: config.State},
+			reexec:    config.Reexec,
+			interrupt: interrupt,
+		}
+		errs = make(chan error, config.Workers)
+	)
+	for i := 0; i < config.Workers; i++ {
+		go func() {
+			for first := range chunks {
+				last := first + config.ChunkSize - 1
+				if last > config.To || last < first {
+					last = config.To
+				}
+				err := exporter.exportChunk(first, last)
+				if err == nil {
+					// Only checkpoint the chunk once its records are stored
+					if err = sink.Flush(); err == nil {
+						err = checkpoint.markExported(first)
+					}
+				}
+				if err != nil {
+					if err != errTraceExportInterrupted {
+						exporter.abort()
+						err = fmt.Errorf("chunk %d-%d: %v", first, last, err)
+					}
+					errs <- err
+					return
+				}
+			}
+			errs <- nil
+		}()
+	}
+	var failure error
+	for i := 0; i < config.Workers; i++ {
+		if err := <-errs; err != nil && (failure == nil || failure == errTraceExportInterrupted) {
+			failure = err
+		}
+	}
+	if failure != nil {
+		return failure
+	}
+	log.Info("Exported traces", "blocks", atomic.LoadUint64(&exporter.blocks), "txs", atomic.LoadUint64(&exporter.txs), "elapsed", common.PrettyDuration(time.Since(start)))
+	return nil
+}
+
+// traceExporter re-executes blocks for ExportTraces.
+type traceExporter struct {
+	chain     *BlockChain
+	processor *StateProcessor
+	sink      trace.Sink
+	vmConfig  vm.Config
+	reexec    uint64
+
+	interrupt <-chan struct{} // Closed by the caller to stop the export
+	aborted   int32           // Set once a worker failed, to stop the others
+
+	blocks uint64 // Number of blocks exported so far
+	txs    uint64 // Number of transactions exported so far
+	logged int64  // Unix time of the last progress log
+}
+
+// abort stops the other workers after one of them failed.
+func (e *traceExporter) abort() {
+	atomic.StoreInt32(&e.aborted, 1)
+}
+
+// stopped reports whether the export was interrupted or aborted.
+func (e *traceExporter) stopped() bool {
+	select {
+	case <-e.interrupt:
+		return true
+	default:
+		return atomic.LoadInt32(&e.aborted) == 1
+	}
+}
+
+// exportChunk re-executes the blocks first to last, writing the records of
+// their transactions to the sink. Every block is checked to reproduce the state
+// root it was mined with, so no records of a diverging execution go unnoticed.
+func (e *traceExporter) exportChunk(first, last uint64) error {
+	parent := e.chain.GetBlockByNumber(first - 1)
+	if parent == nil {
+		return fmt.Errorf("block #%d not found", first-1)
+	}
+	database := state.NewDatabaseWithConfig(e.chain.db, &trie.Config{Cache: 16})
+	statedb, err := e.stateAt(database, parent)
+	if err != nil {
+		return err
+	}
+	root := parent.Root()
+	database.TrieDB().Reference(root, common.Hash{})
+	defer func() { database.TrieDB().Dereference(root) }()
+
+	for number := first; number <= last; number++ {
+		if e.stopped() {
+			return errTraceExportInterrupted
+		}
+		block := e.chain.GetBlockByNumber(number)
+		if block == nil {
+			return fmt.Errorf("block #%d not found", number)
+		}
+		if _, _, _, err := e.processor.process(block, statedb, e.vmConfig, e.sink); err != nil {
+			return fmt.Errorf("processing block %d failed: %v", number, err)
+		}
+		next, err := statedb.Commit(e.chain.chainConfig.IsEIP158(block.Number()))
+		if err != nil {
+			return err
+		}
+		if next != block.Root() {
+			return fmt.Errorf("state root mismatch in block %d: have %x, want %x", number, next, block.Root())
+		}
+		if statedb, err = state.New(next, database, nil); err != nil {
+			return fmt.Errorf("state reset after block %d failed: %v", number, err)
+		}
+		database.TrieDB().Reference(next, common.Hash{})
+		database.TrieDB().Dereference(root)
+		root = next
+
+		e.progress(len(block.Transactions()))
+	}
+	return nil
+}
+
+// stateAt returns the state of the given block, from the database if available
+// or otherwise regenerated by re-executing at most reexec blocks on top of an
+// older state, like eth's stateAtBlock does. Blocks re-executed here do not
+// have their transactions recorded.
+func (e *traceExporter) stateAt(database state.Database, block *types.Block) (*state.StateDB, error) {
+	statedb, err := state.New(block.Root(), database, nil)
+	if err == nil {
+		return statedb, nil
+	}
+	origin := block.NumberU64()
+	for i := uint64(0); i < e.reexec; i++ {
+		if block.NumberU64() == 0 {
+			return nil, errors.New("genesis state is missing")
+		}
+		parent := e.chain.GetBlock(block.ParentHash(), block.NumberU64()-1)
+		if parent == nil {
+			return nil, fmt.Errorf("missing block %v %d", block.ParentHash(), block.NumberU64()-1)
+		}
+		block = parent
+
+		if statedb, err = state.New(block.Root(), database, nil); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		if _, ok := err.(*trie.MissingNodeError); ok {
+			return nil, fmt.Errorf("required historical state unavailable (reexec=%d)", e.reexec)
+		}
+		return nil, err
+	}
+	var parent common.Hash
+	for number := block.NumberU64() + 1; number <= origin; number++ {
+		if e.stopped() {
+			return nil, errTraceExportInterrupted
+		}
+		if block = e.chain.GetBlockByNumber(number); block == nil {
+			return nil, fmt.Errorf("block #%d not found", number)
+		}
+		if _, _, _, err := e.processor.process(block, statedb, vm.Config{}, nil); err != nil {
+			return nil, fmt.Errorf("processing block %d failed: %v", number, err)
+		}
+		root, err := statedb.Commit(e.chain.chainConfig.IsEIP158(block.Number()))
+		if err != nil {
+			return nil, err
+		}
+		if statedb, err = state.New(root, database, nil); err != nil {
+			return nil, fmt.Errorf("state reset after block %d failed: %v", number, err)
+		}
+		// Only keep the latest regenerated state in memory
+		database.TrieDB().Reference(root, common.Hash{})
+		if parent != (common.Hash{}) {
+			database.TrieDB().Dereference(parent)
+		}
+		parent = root
+	}
+	log.Debug("Regenerated historical state", "block", origin)
+	return statedb, nil
+}
+
+// progress accounts an exported block, logging the progress every few seconds.
+func (e *traceExporter) progress(txs int) {
+	blocks := atomic.AddUint64(&e.blocks, 1)
+	total := atomic.AddUint64(&e.txs, uint64(txs))
+
+	now, logged := time.Now().Unix(), atomic.LoadInt64(&e.logged)
+	if now-logged >= 8 && atomic.CompareAndSwapInt64(&e.logged, logged, now) {
+		log.Info("Exporting traces", "blocks", blocks, "txs", total)
+	}
+}
@@ -0,0 +1,175 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/trace"
+)
+
+// newTraceExportChain creates a chain of the given length with a transfer in
+// every block. Archive chains have the state of every block on disk, others
+// only the genesis state.
+func newTraceExportChain(t *testing.T, blocks int, archive bool) (*BlockChain, []*types.Block) {
+	var (
+		key, _  = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		address = crypto.PubkeyToAddress(key.PublicKey)
+		signer  = types.HomesteadSigner{}
+		db      = rawdb.NewMemoryDatabase()
+		gspec   = &Genesis{
+			Config: params.TestChainConfig,
+			Alloc:  GenesisAlloc{address: {Balance: big.NewInt(params.Ether)}},
+		}
+		// Generate the blocks on a separate database, as it stores their states
+		gendb   = rawdb.NewMemoryDatabase()
+		genesis = gspec.MustCommit(gendb)
+	)
+	gspec.MustCommit(db)
+	chain, _ := GenerateChain(gspec.Config, genesis, ethash.NewFaker(), gendb, blocks, func(i int, gen *BlockGen) {
+		tx, _ := types.SignTx(types.NewTransaction(gen.TxNonce(address), common.Address{byte(i)}, big.NewInt(1000), params.TxGas, big.NewInt(1), nil), signer, key)
+		gen.AddTx(tx)
+	})
+	var cacheConfig *CacheConfig
+	if archive {
+		archiveConfig := *defaultCacheConfig
+		archiveConfig.TrieDirtyDisabled = true
+		cacheConfig = &archiveConfig
+	}
+	blockchain, _ := NewBlockChain(db, cacheConfig, gspec.Config, ethash.NewFaker(), vm.Config{}, nil, nil)
+	if n, err := blockchain.InsertChain(chain); err != nil {
+		t.Fatalf("failed to insert block %d: %v", n, err)
+	}
+	return blockchain, chain
+}
+
+// checkExportedTraces checks that the sink holds exactly one record for the
+// transaction of every block in the range.
+func checkExportedTraces(t *testing.T, sink *trace.MemorySink, blocks []*types.Block, from, to uint64) {
+	t.Helper()
+
+	records := make(map[common.Hash]trace.TransactionAll)
+	for _, record := range sink.Records() {
+		if _, ok := records[record.TxHash]; ok {
+			t.Errorf("transaction %x exported twice", record.TxHash)
+		}
+		records[record.TxHash] = record
+	}
+	if len(records) != int(to-from+1) {
+		t.Errorf("record count mismatch: have %d, want %d", len(records), to-from+1)
+	}
+	for number := from; number <= to; number++ {
+		tx := blocks[number-1].Transactions()[0]
+		record, ok := records[tx.Hash()]
+		if !ok {
+			t.Errorf("block %d: transaction not exported", number)
+			continue
+		}
+		if record.TxReceipt.BlockNum.Uint64() != number || len(record.TxTransfers) != 1 {
+			t.Errorf("block %d: record mismatch: have block %v with %d transfers", number, record.TxReceipt.BlockNum, len(record.TxTransfers))
+		}
+	}
+}
+
+func TestExportTraces(t *testing.T) {
+	chain, blocks := newTraceExportChain(t, 10, true)
+	defer chain.Stop()
+
+	sink := trace.NewMemorySink()
+	if err := ExportTraces(chain, sink, &TraceExportConfig{From: 2, To: 9, Workers: 3, ChunkSize: 3}, nil); err != nil {
+		t.Fatalf("failed to export traces: %v", err)
+	}
+	checkExportedTraces(t, sink, blocks, 2, 9)
+}
+
+// Tests that the export regenerates the state of the chunks if it is not on disk.
+func TestExportTracesReexec(t *testing.T) {
+	chain, blocks := newTraceExportChain(t, 10, false)
+	defer chain.Stop()
+
+	sink := trace.NewMemorySink()
+	if err := ExportTraces(chain, sink, &TraceExportConfig{From: 5, To: 10, Workers: 2, ChunkSize: 4, Reexec: 4}, nil); err == nil {
+		t.Fatal("exported traces beyond the reexec limit")
+	}
+	sink = trace.NewMemorySink()
+	if err := ExportTraces(chain, sink, &TraceExportConfig{From: 5, To: 10, Workers: 2, ChunkSize: 4, Reexec: 16}, nil); err != nil {
+		t.Fatalf("failed to export traces: %v", err)
+	}
+	checkExportedTraces(t, sink, blocks, 5, 10)
+}
+
+// Tests that an interrupted export resumes with the chunks not exported yet.
+func TestExportTracesCheckpoint(t *testing.T) {
+	chain, blocks := newTraceExportChain(t, 10, true)
+	defer chain.Stop()
+
+	dir, err := ioutil.TempDir("", "trace-export")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	config := &TraceExportConfig{From: 1, To: 10, Workers: 1, ChunkSize: 4, Checkpoint: filepath.Join(dir, "checkpoint.json")}
+
+	// Pretend the first chunk was exported by an earlier run
+	checkpoint, err := loadTraceCheckpoint(config)
+	if err != nil {
+		t.Fatalf("failed to create checkpoint: %v", err)
+	}
+	if err := checkpoint.markExported(1); err != nil {
+		t.Fatalf("failed to store checkpoint: %v", err)
+	}
+	sink := trace.NewMemorySink()
+	if err := ExportTraces(chain, sink, config, nil); err != nil {
+		t.Fatalf("failed to export traces: %v", err)
+	}
+	checkExportedTraces(t, sink, blocks, 5, 10)
+
+	// Once done, nothing is left to export
+	sink = trace.NewMemorySink()
+	if err := ExportTraces(chain, sink, config, nil); err != nil {
+		t.Fatalf("failed to export traces: %v", err)
+	}
+	if records := sink.Records(); len(records) != 0 {
+		t.Errorf("exported %d records again", len(records))
+	}
+	// The checkpoint is specific to the export it was created for
+	if err := ExportTraces(chain, sink, &TraceExportConfig{From: 2, To: 10, ChunkSize: 4, Checkpoint: config.Checkpoint}, nil); err == nil {
+		t.Error("resumed the export of another range")
+	}
+	// An interrupted export stops without checkpointing
+	interrupt := make(chan struct{})
+	close(interrupt)
+	config.Checkpoint = filepath.Join(dir, "interrupted.json")
+	if err := ExportTraces(chain, sink, config, interrupt); err != errTraceExportInterrupted {
+		t.Errorf("interrupt error mismatch: have %v, want %v", err, errTraceExportInterrupted)
+	}
+	if _, err := os.Stat(config.Checkpoint); !os.IsNotExist(err) {
+		t.Errorf("checkpoint written by interrupted export: %v", err)
+	}
+}
@@ -26,11 +26,8 @@ import (
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/params"
 	"github.com/holiman/uint256"
-	
+
 	"github.com/ethereum/go-ethereum/trace"
-	// "encoding/json"
-	// "fmt"
-	"encoding/hex"
 )
 
 // emptyCodeHash is used by create to ensure deployment is disallowed to already
@@ -161,9 +158,12 @@ type EVM struct {
 	// applied in opCall*.
 	callGasTemp uint64
 
-	redundency bool
-	// To check whether the running is a simulation or a syncing
-	sync bool
+	// frameTracer is the tracer notified of the entered and exited call
+	// frames, if the configured one is interested in them.
+	frameTracer FrameTracer
+	// recorder records the trace of the current transaction, if it is the
+	// configured tracer.
+	recorder *TraceRecorder
 }
 
 // NewEVM returns a new EVM. The returned EVM is not thread safe and should
@@ -200,44 +200,10 @@ func NewEVM(blockCtx BlockContext, txCtx TxContext, statedb StateDB, chainConfig
 	evm.interpreters = append(evm.interpreters, NewEVMInterpreter(evm, vmConfig))
 	evm.interpreter = evm.interpreters[0]
 
-	return evm
-}
-
-
-func NewEVMWithFlag(blockCtx BlockContext, txCtx TxContext, statedb StateDB, chainConfig *params.ChainConfig, vmConfig Config, re bool, sync bool) *EVM {
-	evm := &EVM{
-		Context:      blockCtx,
-		TxContext:    txCtx,
-		StateDB:      statedb,
-		vmConfig:     vmConfig,
-		chainConfig:  chainConfig,
-		chainRules:   chainConfig.Rules(blockCtx.BlockNumber),
-		interpreters: make([]Interpreter, 0, 1),
-		redundency:   re,
-		sync:		  sync,
-	}
-
-	if chainConfig.IsEWASM(blockCtx.BlockNumber) {
-		// to be implemented by EVM-C and Wagon PRs.
-		// if vmConfig.EWASMInterpreter != "" {
-		//  extIntOpts := strings.Split(vmConfig.EWASMInterpreter, ":")
-		//  path := extIntOpts[0]
-		//  options := []string{}
-		//  if len(extIntOpts) > 1 {
-		//    options = extIntOpts[1..]
-		//  }
-		//  evm.interpreters = append(evm.interpreters, NewEVMVCInterpreter(evm, vmConfig, options))
-		// } else {
-		// 	evm.interpreters = append(evm.interpreters, NewEWASMInterpreter(evm, vmConfig))
-		// }
-		panic("No supported ewasm interpreter yet.")
+	if vmConfig.Debug {
+		evm.frameTracer, _ = vmConfig.Tracer.(FrameTracer)
+		evm.recorder = traceRecorder(vmConfig.Tracer)
 	}
-
-	// vmConfig.EVMInterpreter will be used by EVM-C, it won't be checked here
-	// as we always want to have the built-in EVM as the failover option.
-	evm.interpreters = append(evm.interpreters, NewEVMInterpreter(evm, vmConfig))
-	evm.interpreter = evm.interpreters[0]
-
 	return evm
 }
 
@@ -246,6 +212,33 @@ func NewEVMWithFlag(blockCtx BlockContext, txCtx TxContext, statedb StateDB, cha
 func (evm *EVM) Reset(txCtx TxContext, statedb StateDB) {
 	evm.TxContext = txCtx
 	evm.StateDB = statedb
+	if evm.recorder != nil {
+		evm.recorder.reset()
+	}
+	evm.recordState()
+}
+
+// recordState wraps the state database so the state accesses are reported to
+// the trace recorder, if enabled in the vm config, or unwraps it otherwise.
+func (evm *EVM) recordState() {
+	if recorder, ok := evm.StateDB.(*stateRecorder); ok {
+		evm.StateDB = recorder.StateDB
+	}
+	if evm.recorder == nil || !evm.vmConfig.TraceStateAccess || evm.StateDB == nil {
+		return
+	}
+	collector := evm.recorder.Collector()
+	collector.RecordStateAccess()
+	evm.StateDB = &stateRecorder{StateDB: evm.StateDB, collector: collector}
+}
+
+// TraceCollector returns the collector recording the current transaction, or
+// nil if the configured tracer is not or does not include a trace recorder.
+func (evm *EVM) TraceCollector() *trace.TraceCollector {
+	if evm.recorder == nil {
+		return nil
+	}
+	return evm.recorder.Collector()
 }
 
 // Cancel cancels any running EVM operation. This may be called concurrently and
@@ -291,67 +284,20 @@ func (evm *EVM) Call(caller ContractRef, addr common.Address, input []byte, gas
 				evm.vmConfig.Tracer.CaptureStart(caller.Address(), addr, false, input, gas, value)
 				evm.vmConfig.Tracer.CaptureEnd(ret, 0, 0, nil)
 			}
+			// The call still shows up as an empty frame in the call tree
+			if evm.frameTracer != nil {
+				evm.frameTracer.CaptureEnter(CALL, caller.Address(), addr, input, gas, value)
+				evm.frameTracer.CaptureExit(nil, gas, nil)
+			}
 			return nil, gas, nil
 		}
 		evm.StateDB.CreateAccount(addr)
 	}
 
-	if evm.redundency == false {
-		if evm.sync == true {
-			trace.CurrentTraceIndex += 1
-			trace.CallDepth += 1
-			trace.CallNum += 1
-			tempt_trace := &trace.TraceN{
-						CallType: "CALL", 
-						FromAddr: caller.Address().String(), 
-						ToAddr: addr.String(),
-						CreateAddr: "0x",
-						SuicideContract: "0x",
-						Beneficiary: "0x",
-						Input: hex.EncodeToString(input),
-						Output: "", // currently unknown hex.EncodeToString(ret) 
-						Value: value, 
-						CallDepth: trace.CallDepth,
-						CallNum: trace.CallNum,
-						TraceIndex: trace.CurrentTraceIndex, 
-						Type: "CALL"}
-
-			// defer the output to the end
-			defer func() {
-		        tempt_trace.Output = hex.EncodeToString(ret)
-		        tempt_traces := []trace.TraceN{}
-				tempt_traces = append(tempt_traces, *tempt_trace)
-				trace.Traces = append(tempt_traces, trace.Traces...) 
-				trace.CallDepth -= 1
-		    }()
-		} else {
-			trace.SimCurrentTraceIndex += 1
-			trace.SimCallDepth += 1
-			trace.SimCallNum += 1
-			tempt_trace := &trace.TraceN{
-						CallType: "CALL", 
-						FromAddr: caller.Address().String(), 
-						ToAddr: addr.String(),
-						CreateAddr: "0x",
-						SuicideContract: "0x",
-						Beneficiary: "0x",
-						Input: hex.EncodeToString(input),
-						Output: "", // currently unknown hex.EncodeToString(ret) 
-						Value: value, 
-						CallDepth: trace.SimCallDepth,
-						CallNum: trace.SimCallNum,
-						TraceIndex: trace.SimCurrentTraceIndex, 
-						Type: "CALL"}
-
-			// defer the output to the end
-			defer func() {
-		        tempt_trace.Output = hex.EncodeToString(ret)
-		        tempt_traces := []trace.TraceN{}
-				tempt_traces = append(tempt_traces, *tempt_trace)
-				trace.SimTraces = append(tempt_traces, trace.SimTraces...) 
-				trace.SimCallDepth -= 1
-		    }()
-		}
+	if evm.frameTracer != nil {
+		evm.frameTracer.CaptureEnter(CALL, caller.Address(), addr, input, gas, value)
+		// The outcome is only known once the frame returns
+		defer func() { evm.frameTracer.CaptureExit(ret, leftOverGas, err) }()
 	}
 
 	evm.Context.Transfer(evm.StateDB, caller.Address(), addr, value)
@@ -423,69 +369,12 @@ func (evm *EVM) CallCode(caller ContractRef, addr common.Address, input []byte,
 		return nil, gas, ErrInsufficientBalance
 	}
 
-	if evm.redundency == false {
-		if evm.sync == true {
-			trace.CurrentTraceIndex += 1
-			trace.CallDepth += 1
-			trace.CallNum += 1
-			tempt_trace := &trace.TraceN{
-						CallType: "CALLCODE", 
-						FromAddr: caller.Address().String(), 
-						ToAddr: addr.String(),
-						CreateAddr: "0x",
-						SuicideContract: "0x",
-						Beneficiary: "0x",
-						Input: hex.EncodeToString(input),
-						Output: "", // currently unknown hex.EncodeToString(ret) 
-						Value: value, 
-						CallDepth: trace.CallDepth,
-						CallNum: trace.CallNum,
-						TraceIndex: trace.CurrentTraceIndex, 
-						Type: "CALL"}
-			// json_trace, _ := json.Marshal(tempt_trace)
-			// fmt.Printf(string(json_trace))
-
-			// defer the output to the end
-			defer func() {
-		        tempt_trace.Output = hex.EncodeToString(ret)
-		        tempt_traces := []trace.TraceN{}
-				tempt_traces = append(tempt_traces, *tempt_trace)
-				trace.Traces = append(tempt_traces, trace.Traces...) 
-				trace.CallDepth -= 1
-		    }()
-		} else {
-			trace.SimCurrentTraceIndex += 1
-			trace.SimCallDepth += 1
-			trace.SimCallNum += 1
-			tempt_trace := &trace.TraceN{
-						CallType: "CALLCODE", 
-						FromAddr: caller.Address().String(), 
-						ToAddr: addr.String(),
-						CreateAddr: "0x",
-						SuicideContract: "0x",
-						Beneficiary: "0x",
-						Input: hex.EncodeToString(input),
-						Output: "", // currently unknown hex.EncodeToString(ret) 
-						Value: value, 
-						CallDepth: trace.SimCallDepth,
-						CallNum: trace.SimCallNum,
-						TraceIndex: trace.SimCurrentTraceIndex, 
-						Type: "CALL"}
-			// json_trace, _ := json.Marshal(tempt_trace)
-			// fmt.Printf(string(json_trace))
-
-			// defer the output to the end
-			defer func() {
-		        tempt_trace.Output = hex.EncodeToString(ret)
-		        tempt_traces := []trace.TraceN{}
-				tempt_traces = append(tempt_traces, *tempt_trace)
-				trace.SimTraces = append(tempt_traces, trace.SimTraces...)  
-				trace.SimCallDepth -= 1
-		    }()
-		}
+	if evm.frameTracer != nil {
+		evm.frameTracer.CaptureEnter(CALLCODE, caller.Address(), addr, input, gas, value)
+		// The outcome is only known once the frame returns
+		defer func() { evm.frameTracer.CaptureExit(ret, leftOverGas, err) }()
 	}
 
-
 	var snapshot = evm.StateDB.Snapshot()
 
 	// It is allowed to call precompiles, even via delegatecall
@@ -525,60 +414,10 @@ func (evm *EVM) DelegateCall(caller ContractRef, addr common.Address, input []by
 		return nil, gas, ErrDepth
 	}
 
-	if evm.redundency == false {
-		if evm.sync == true {
-			trace.CurrentTraceIndex += 1
-			trace.CallDepth += 1
-			trace.CallNum += 1
-			tempt_trace := &trace.TraceN{
-						CallType: "DELEGATECALL", 
-						FromAddr: caller.Address().String(), 
-						ToAddr: addr.String(),
-						CreateAddr: "0x",
-						SuicideContract: "0x",
-						Beneficiary: "0x",
-						Input: hex.EncodeToString(input),
-						Output: "", // currently unknown hex.EncodeToString(ret) 
-						Value: big.NewInt(0), 
-						CallDepth: trace.CallDepth,
-						CallNum: trace.CallNum,
-						TraceIndex: trace.CurrentTraceIndex, 
-						Type: "CALL"}
-			// defer the output to the end
-			defer func() {
-		        tempt_trace.Output = hex.EncodeToString(ret)
-		        tempt_traces := []trace.TraceN{}
-				tempt_traces = append(tempt_traces, *tempt_trace)
-				trace.Traces = append(tempt_traces, trace.Traces...) 
-				trace.CallDepth -= 1
-		    }()
-		} else {
-			trace.SimCurrentTraceIndex += 1
-			trace.SimCallDepth += 1
-			trace.SimCallNum += 1
-			tempt_trace := &trace.TraceN{
-						CallType: "DELEGATECALL", 
-						FromAddr: caller.Address().String(), 
-						ToAddr: addr.String(),
-						CreateAddr: "0x",
-						SuicideContract: "0x",
-						Beneficiary: "0x",
-						Input: hex.EncodeToString(input),
-						Output: "", // currently unknown hex.EncodeToString(ret) 
-						Value: big.NewInt(0), 
-						CallDepth: trace.SimCallDepth,
-						CallNum: trace.SimCallNum,
-						TraceIndex: trace.SimCurrentTraceIndex, 
-						Type: "CALL"}
-			// defer the output to the end
-			defer func() {
-		        tempt_trace.Output = hex.EncodeToString(ret)
-		        tempt_traces := []trace.TraceN{}
-				tempt_traces = append(tempt_traces, *tempt_trace)
-				trace.SimTraces = append(tempt_traces, trace.SimTraces...) 
-				trace.SimCallDepth -= 1
-		    }()
-		}
+	if evm.frameTracer != nil {
+		evm.frameTracer.CaptureEnter(DELEGATECALL, caller.Address(), addr, input, gas, nil)
+		// The outcome is only known once the frame returns
+		defer func() { evm.frameTracer.CaptureExit(ret, leftOverGas, err) }()
 	}
 
 	var snapshot = evm.StateDB.Snapshot()
@@ -618,63 +457,12 @@ func (evm *EVM) StaticCall(caller ContractRef, addr common.Address, input []byte
 		return nil, gas, ErrDepth
 	}
 
-	if evm.redundency == false {
-		if evm.sync == true {
-			trace.CurrentTraceIndex += 1
-			trace.CallDepth += 1
-			trace.CallNum += 1
-			tempt_trace := &trace.TraceN{
-						CallType: "STATICCALL", 
-						FromAddr: caller.Address().String(), 
-						ToAddr: addr.String(),
-						CreateAddr: "0x",
-						SuicideContract: "0x",
-						Beneficiary: "0x",
-						Input: hex.EncodeToString(input),
-						Output: "", // currently unknown hex.EncodeToString(ret) 
-						Value: big.NewInt(0), 
-						CallDepth: trace.CallDepth,
-						CallNum: trace.CallNum,
-						TraceIndex: trace.CurrentTraceIndex, 
-						Type: "CALL"}
-			// defer the output to the end
-			defer func() {
-		        tempt_trace.Output = hex.EncodeToString(ret)
-		        tempt_traces := []trace.TraceN{}
-				tempt_traces = append(tempt_traces, *tempt_trace)
-				trace.Traces = append(tempt_traces, trace.Traces...) 
-				trace.CallDepth -= 1
-		    }()
-		} else {
-			trace.SimCurrentTraceIndex += 1
-			trace.SimCallDepth += 1
-			trace.SimCallNum += 1
-			tempt_trace := &trace.TraceN{
-						CallType: "STATICCALL", 
-						FromAddr: caller.Address().String(), 
-						ToAddr: addr.String(),
-						CreateAddr: "0x",
-						SuicideContract: "0x",
-						Beneficiary: "0x",
-						Input: hex.EncodeToString(input),
-						Output: "", // currently unknown hex.EncodeToString(ret) 
-						Value: big.NewInt(0), 
-						CallDepth: trace.SimCallDepth,
-						CallNum: trace.SimCallNum,
-						TraceIndex: trace.SimCurrentTraceIndex, 
-						Type: "CALL"}
-			// defer the output to the end
-			defer func() {
-		        tempt_trace.Output = hex.EncodeToString(ret)
-		        tempt_traces := []trace.TraceN{}
-				tempt_traces = append(tempt_traces, *tempt_trace)
-				trace.SimTraces = append(tempt_traces, trace.SimTraces...) 
-				trace.SimCallDepth -= 1
-		    }()
-		}
+	if evm.frameTracer != nil {
+		evm.frameTracer.CaptureEnter(STATICCALL, caller.Address(), addr, input, gas, nil)
+		// The outcome is only known once the frame returns
+		defer func() { evm.frameTracer.CaptureExit(ret, leftOverGas, err) }()
 	}
 
-
 	// We take a snapshot here. This is a bit counter-intuitive, and could probably be skipped.
 	// However, even a staticcall is considered a 'touch'. On mainnet, static calls were introduced
 	// after all empty accounts were deleted, so this is not required. However, if we omit this,
@@ -767,74 +555,16 @@ func (evm *EVM) create(caller ContractRef, codeAndHash *codeAndHash, gas uint64,
 		return nil, address, gas, nil
 	}
 
-
-	if evm.redundency == false {
-		op := ""
+	if evm.frameTracer != nil {
+		op := CREATE2
 		if isCreate {
-			op = "CREATE"
-		} else {
-			op = "CREATE2"
-		}
-		if evm.sync == true {
-			trace.CurrentTraceIndex += 1
-			trace.CallDepth += 1
-			trace.CallNum += 1
-			tempt_trace := &trace.TraceN{
-						CallType: op, 
-						FromAddr: caller.Address().String(), 
-						ToAddr: "0x", 
-						CreateAddr: address.String(),
-						SuicideContract: "0x",
-						Beneficiary: "0x",
-						Input: hex.EncodeToString(codeAndHash.code), // set it to be none
-						Output: "", 
-						Value: value, 
-						// Value: new(big.Int).SetUint64(value.Uint64()), 
-						CallDepth: trace.CallDepth,
-						CallNum: trace.CallNum,
-						TraceIndex: trace.CurrentTraceIndex, 
-						Type: "CREATE"}
-			trace.CreatedSC = append(trace.CreatedSC, address.String())
-			// defer the output to the end
-			defer func() {
-		        tempt_trace.Output = hex.EncodeToString(retCreate)
-		        tempt_traces := []trace.TraceN{}
-				tempt_traces = append(tempt_traces, *tempt_trace)
-				trace.Traces = append(tempt_traces, trace.Traces...)
-				trace.CallDepth -= 1
-	    	}()	
-		} else {
-			trace.SimCurrentTraceIndex += 1
-			trace.SimCallDepth += 1
-			trace.SimCallNum += 1
-			tempt_trace := &trace.TraceN{
-						CallType: op, 
-						FromAddr: caller.Address().String(), 
-						ToAddr: "0x", 
-						CreateAddr: address.String(),
-						SuicideContract: "0x",
-						Beneficiary: "0x",
-						Input: hex.EncodeToString(codeAndHash.code), // set it to be none
-						Output: "", 
-						Value: value, 
-						// Value: new(big.Int).SetUint64(value.Uint64()), 
-						CallDepth: trace.SimCallDepth,
-						CallNum: trace.SimCallNum,
-						TraceIndex: trace.SimCurrentTraceIndex, 
-						Type: "CREATE"}
-			trace.SimCreatedSC = append(trace.SimCreatedSC, address.String())
-			// defer the output to the end
-			defer func() {
-		        tempt_trace.Output = hex.EncodeToString(retCreate)
-		        tempt_traces := []trace.TraceN{}
-				tempt_traces = append(tempt_traces, *tempt_trace)
-				trace.SimTraces = append(tempt_traces, trace.SimTraces...)
-				trace.SimCallDepth -= 1
-		    }()
+			op = CREATE
 		}
+		evm.frameTracer.CaptureEnter(op, caller.Address(), address, codeAndHash.code, gas, value)
+		// The outcome is only known once the frame returns
+		defer func() { evm.frameTracer.CaptureExit(retCreate, leftOverGas, err) }()
 	}
 
-
 	if evm.vmConfig.Debug && evm.depth == 0 {
 		evm.vmConfig.Tracer.CaptureStart(caller.Address(), address, true, codeAndHash.code, gas, value)
 	}
@@ -22,11 +22,6 @@ import (
 	"github.com/ethereum/go-ethereum/params"
 	"github.com/holiman/uint256"
 	"golang.org/x/crypto/sha3"
-
-	"github.com/ethereum/go-ethereum/trace"
-	// "encoding/json"
-	"encoding/hex"
-	// "fmt"
 )
 
 func opAdd(pc *uint64, interpreter *EVMInterpreter, callContext *callCtx) ([]byte, error) {
@@ -825,55 +820,6 @@ func opSuicide(pc *uint64, interpreter *EVMInterpreter, callContext *callCtx) ([
 	interpreter.evm.StateDB.AddBalance(beneficiary.Bytes20(), balance)
 	interpreter.evm.StateDB.Suicide(callContext.contract.Address())
 
-	// Trace
-	if interpreter.evm.redundency == false {
-		if interpreter.evm.sync == true {
-			trace.CurrentTraceIndex += 1
-			trace.CallDepth += 1
-			trace.CallNum += 1
-			tempt_trace := &trace.TraceN{
-						CallType: "SELFDESTRUCT", 
-						FromAddr: callContext.contract.caller.Address().String(), 
-						ToAddr: "0x",
-						CreateAddr: "0x",
-						SuicideContract: callContext.contract.Address().String(),
-						Beneficiary: beneficiary.String(),
-						Input: "",
-						Output: "", 
-						Value: balance, 
-						CallDepth: trace.CallDepth,
-						CallNum: trace.CallNum,
-						TraceIndex: trace.CurrentTraceIndex, 
-						Type: "SUICIDE"}
-			trace.Traces = append(trace.Traces, *tempt_trace) 
-			// maybe does not matter since at this time, the execution ends.
-			trace.CallDepth -= 1 
-		} else {
-			trace.SimCurrentTraceIndex += 1
-			trace.SimCallDepth += 1
-			trace.SimCallNum += 1
-			tempt_trace := &trace.TraceN{
-						CallType: "SELFDESTRUCT", 
-						FromAddr: callContext.contract.caller.Address().String(), 
-						ToAddr: "0x",
-						CreateAddr: "0x",
-						SuicideContract: callContext.contract.Address().String(),
-						Beneficiary: beneficiary.String(),
-						Input: "",
-						Output: "", 
-						Value: balance, 
-						CallDepth: trace.SimCallDepth,
-						CallNum: trace.SimCallNum,
-						TraceIndex: trace.SimCurrentTraceIndex, 
-						Type: "SUICIDE"}
-			trace.SimTraces = append(trace.SimTraces, *tempt_trace) 
-			// maybe does not matter since at this time, the execution ends.
-			trace.SimCallDepth -= 1 
-		}
-
-	}
-	
-
 	return nil, nil
 }
 
@@ -891,52 +837,15 @@ func makeLog(size int) executionFunc {
 		}
 
 		d := callContext.memory.GetCopy(int64(mStart.Uint64()), int64(mSize.Uint64()))
-		interpreter.evm.StateDB.AddLog(&types.Log{
+		log := &types.Log{
 			Address: callContext.contract.Address(),
 			Topics:  topics,
 			Data:    d,
 			// This is a non-consensus field, but assigned here because
 			// core/state doesn't know the current block number.
 			BlockNumber: interpreter.evm.Context.BlockNumber.Uint64(),
-		})
-
-		// Convert the log to the TransferLog
-		// len(topics) == 1 and topics[0].String() == "0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef"  is ERC 721 
-		if len(topics) == 3 && topics[0].String() == "0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef" && interpreter.evm.redundency == false {
-			// if len(topics) < 3 {
-			// 	fmt.Printf("this tx has topcis wrong only one topic, current tx index %d current trace index %d\n", trace.CurrentTxIndex, trace.CurrentTraceIndex)
-			// 	fmt.Printf("wrong log Address %s, Topics %s, Data %s, BlockNumber %d\n", callContext.contract.Address().String(), topics, d, interpreter.evm.Context.BlockNumber.Uint64())
-			// 	trace.OnlyOneTopic = true
-			// 	return nil, nil				
-			// }
-
-			if interpreter.evm.sync == true {
-				tempt_log := &trace.TransferLog{
-					FromAddr: topics[1].String(),
-					ToAddr: topics[2].String(),
-					Value: hex.EncodeToString(d),
-					TokenAddr: callContext.contract.Address().String(),
-					CallDepth: trace.CallDepth,
-					CallNum: trace.CallNum,
-					TraceIndex: trace.CurrentTraceIndex, 
-				}
-				// Append to the end
-				trace.TransferLogs = append(trace.TransferLogs, *tempt_log)	
-			} else {
-				tempt_log := &trace.TransferLog{
-					FromAddr: topics[1].String(),
-					ToAddr: topics[2].String(),
-					Value: hex.EncodeToString(d),
-					TokenAddr: callContext.contract.Address().String(),
-					CallDepth: trace.SimCallDepth,
-					CallNum: trace.SimCallNum,
-					TraceIndex: trace.SimCurrentTraceIndex, 
-				}
-				// Append to the end
-				trace.SimTransferLogs = append(trace.SimTransferLogs, *tempt_log)
-			}
-			
 		}
+		interpreter.evm.StateDB.AddLog(log)
 
 		return nil, nil
 	}
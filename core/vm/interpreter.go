@@ -43,6 +43,8 @@ type Config struct {
 	EVMInterpreter   string // External EVM interpreter options
 
 	ExtraEips []int // Additional EIPS that are to be enabled
+
+	TraceStateAccess bool // Records the state read and write sets of traced transactions
 }
 
 // Interpreter is used to run Ethereum based contracts and will utilise the
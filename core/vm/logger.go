@@ -115,6 +115,16 @@ type Tracer interface {
 	CaptureEnd(output []byte, gasUsed uint64, t time.Duration, err error) error
 }
 
+// FrameTracer is a Tracer which is also notified whenever a call frame is
+// entered or exited, at any depth including the outermost one. Frames are
+// reported for CALL, CALLCODE, DELEGATECALL, STATICCALL, CREATE and CREATE2;
+// each CaptureEnter is paired with a CaptureExit once the frame returns.
+type FrameTracer interface {
+	Tracer
+	CaptureEnter(typ OpCode, from common.Address, to common.Address, input []byte, gas uint64, value *big.Int)
+	CaptureExit(output []byte, gasLeft uint64, err error)
+}
+
 // StructLogger is an EVM state logger and implements Tracer.
 //
 // StructLogger can capture state based on the given Log configuration and also keeps
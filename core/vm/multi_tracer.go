@@ -0,0 +1,125 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package vm
+
+import (
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// MultiTracer is a FrameTracer forwarding every event to several tracers, so
+// a trace recorder can run alongside a user supplied tracer. Frame events are
+// only forwarded to the tracers implementing FrameTracer. Errors are returned
+// after all tracers were notified, the first one taking precedence.
+type MultiTracer []Tracer
+
+// NewMultiTracer creates a tracer notifying all the given tracers, in order.
+func NewMultiTracer(tracers ...Tracer) MultiTracer {
+	return MultiTracer(tracers)
+}
+
+// CaptureStart implements Tracer.
+func (t MultiTracer) CaptureStart(from common.Address, to common.Address, create bool, input []byte, gas uint64, value *big.Int) error {
+	var failure error
+	for _, tracer := range t {
+		if err := tracer.CaptureStart(from, to, create, input, gas, value); err != nil && failure == nil {
+			failure = err
+		}
+	}
+	return failure
+}
+
+// CaptureState implements Tracer.
+func (t MultiTracer) CaptureState(env *EVM, pc uint64, op OpCode, gas, cost uint64, memory *Memory, stack *Stack, rStack *ReturnStack, rData []byte, contract *Contract, depth int, err error) error {
+	var failure error
+	for _, tracer := range t {
+		if err := tracer.CaptureState(env, pc, op, gas, cost, memory, stack, rStack, rData, contract, depth, err); err != nil && failure == nil {
+			failure = err
+		}
+	}
+	return failure
+}
+
+// CaptureFault implements Tracer.
+func (t MultiTracer) CaptureFault(env *EVM, pc uint64, op OpCode, gas, cost uint64, memory *Memory, stack *Stack, rStack *ReturnStack, contract *Contract, depth int, err error) error {
+	var failure error
+	for _, tracer := range t {
+		if err := tracer.CaptureFault(env, pc, op, gas, cost, memory, stack, rStack, contract, depth, err); err != nil && failure == nil {
+			failure = err
+		}
+	}
+	return failure
+}
+
+// CaptureEnd implements Tracer.
+func (t MultiTracer) CaptureEnd(output []byte, gasUsed uint64, d time.Duration, err error) error {
+	var failure error
+	for _, tracer := range t {
+		if err := tracer.CaptureEnd(output, gasUsed, d, err); err != nil && failure == nil {
+			failure = err
+		}
+	}
+	return failure
+}
+
+// CaptureEnter implements FrameTracer.
+func (t MultiTracer) CaptureEnter(typ OpCode, from common.Address, to common.Address, input []byte, gas uint64, value *big.Int) {
+	for _, tracer := range t {
+		if tracer, ok := tracer.(FrameTracer); ok {
+			tracer.CaptureEnter(typ, from, to, input, gas, value)
+		}
+	}
+}
+
+// CaptureExit implements FrameTracer.
+func (t MultiTracer) CaptureExit(output []byte, gasLeft uint64, err error) {
+	for _, tracer := range t {
+		if tracer, ok := tracer.(FrameTracer); ok {
+			tracer.CaptureExit(output, gasLeft, err)
+		}
+	}
+}
+
+// traceRecorder returns the trace recorder among the given tracer, if any.
+func traceRecorder(tracer Tracer) *TraceRecorder {
+	switch tracer := tracer.(type) {
+	case *TraceRecorder:
+		return tracer
+	case MultiTracer:
+		for _, t := range tracer {
+			if recorder := traceRecorder(t); recorder != nil {
+				return recorder
+			}
+		}
+	}
+	return nil
+}
+
+// WithTraceRecorder returns the vm config with a fresh trace recorder enabled,
+// running alongside the tracer already enabled in it, if any.
+func WithTraceRecorder(cfg Config) Config {
+	recorder := NewTraceRecorder()
+	if cfg.Debug && cfg.Tracer != nil {
+		cfg.Tracer = NewMultiTracer(cfg.Tracer, recorder)
+	} else {
+		cfg.Tracer = recorder
+	}
+	cfg.Debug = true
+	return cfg
+}
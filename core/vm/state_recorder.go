@@ -0,0 +1,135 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package vm
+
+import (
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/trace"
+)
+
+// stateRecorder wraps the StateDB of an EVM, reporting every storage, balance,
+// nonce and code access of the running transaction to its trace collector.
+type stateRecorder struct {
+	StateDB
+	collector *trace.TraceCollector
+}
+
+func (s *stateRecorder) readBalance(addr common.Address) {
+	s.collector.ReadState(addr, trace.StateBalance, common.Hash{}, common.BigToHash(s.StateDB.GetBalance(addr)))
+}
+
+func (s *stateRecorder) writeBalance(addr common.Address) {
+	s.collector.WriteState(addr, trace.StateBalance, common.Hash{}, common.BigToHash(s.StateDB.GetBalance(addr)))
+}
+
+func (s *stateRecorder) readNonce(addr common.Address) {
+	s.collector.ReadState(addr, trace.StateNonce, common.Hash{}, nonceHash(s.StateDB.GetNonce(addr)))
+}
+
+func (s *stateRecorder) writeNonce(addr common.Address) {
+	s.collector.WriteState(addr, trace.StateNonce, common.Hash{}, nonceHash(s.StateDB.GetNonce(addr)))
+}
+
+func (s *stateRecorder) readCode(addr common.Address) {
+	s.collector.ReadState(addr, trace.StateCode, common.Hash{}, s.StateDB.GetCodeHash(addr))
+}
+
+func (s *stateRecorder) writeCode(addr common.Address) {
+	s.collector.WriteState(addr, trace.StateCode, common.Hash{}, s.StateDB.GetCodeHash(addr))
+}
+
+func (s *stateRecorder) CreateAccount(addr common.Address) {
+	s.writeNonce(addr)
+	s.writeCode(addr)
+	s.StateDB.CreateAccount(addr)
+}
+
+func (s *stateRecorder) SubBalance(addr common.Address, amount *big.Int) {
+	s.writeBalance(addr)
+	s.StateDB.SubBalance(addr, amount)
+}
+
+func (s *stateRecorder) AddBalance(addr common.Address, amount *big.Int) {
+	s.writeBalance(addr)
+	s.StateDB.AddBalance(addr, amount)
+}
+
+func (s *stateRecorder) GetBalance(addr common.Address) *big.Int {
+	s.readBalance(addr)
+	return s.StateDB.GetBalance(addr)
+}
+
+func (s *stateRecorder) GetNonce(addr common.Address) uint64 {
+	s.readNonce(addr)
+	return s.StateDB.GetNonce(addr)
+}
+
+func (s *stateRecorder) SetNonce(addr common.Address, nonce uint64) {
+	s.writeNonce(addr)
+	s.StateDB.SetNonce(addr, nonce)
+}
+
+func (s *stateRecorder) GetCodeHash(addr common.Address) common.Hash {
+	s.readCode(addr)
+	return s.StateDB.GetCodeHash(addr)
+}
+
+func (s *stateRecorder) GetCode(addr common.Address) []byte {
+	s.readCode(addr)
+	return s.StateDB.GetCode(addr)
+}
+
+func (s *stateRecorder) SetCode(addr common.Address, code []byte) {
+	s.writeCode(addr)
+	s.StateDB.SetCode(addr, code)
+}
+
+func (s *stateRecorder) GetCodeSize(addr common.Address) int {
+	s.readCode(addr)
+	return s.StateDB.GetCodeSize(addr)
+}
+
+func (s *stateRecorder) GetCommittedState(addr common.Address, slot common.Hash) common.Hash {
+	value := s.StateDB.GetCommittedState(addr, slot)
+	s.collector.ReadState(addr, trace.StateStorage, slot, value)
+	return value
+}
+
+func (s *stateRecorder) GetState(addr common.Address, slot common.Hash) common.Hash {
+	value := s.StateDB.GetState(addr, slot)
+	s.collector.ReadState(addr, trace.StateStorage, slot, value)
+	return value
+}
+
+func (s *stateRecorder) SetState(addr common.Address, slot common.Hash, value common.Hash) {
+	s.collector.WriteState(addr, trace.StateStorage, slot, s.StateDB.GetState(addr, slot))
+	s.StateDB.SetState(addr, slot, value)
+}
+
+func (s *stateRecorder) Suicide(addr common.Address) bool {
+	s.writeBalance(addr)
+	s.writeNonce(addr)
+	s.writeCode(addr)
+	return s.StateDB.Suicide(addr)
+}
+
+// nonceHash encodes a nonce as a 32 byte word.
+func nonceHash(nonce uint64) common.Hash {
+	return common.BigToHash(new(big.Int).SetUint64(nonce))
+}
@@ -0,0 +1,141 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package vm
+
+import (
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/trace"
+)
+
+// TraceRecorder is a FrameTracer recording the call frames, asset transfers and
+// created contracts of each transaction into a trace collector. It is enabled
+// by setting it as the tracer of the vm config, with Debug on; a fresh
+// collector is started whenever the EVM is reset for a new transaction.
+type TraceRecorder struct {
+	collector *trace.TraceCollector
+	frames    []*trace.TraceN // open frames, innermost last
+}
+
+// NewTraceRecorder creates a trace recorder.
+func NewTraceRecorder() *TraceRecorder {
+	return &TraceRecorder{collector: trace.NewTraceCollector()}
+}
+
+// reset starts recording a new transaction.
+func (r *TraceRecorder) reset() {
+	r.collector = trace.NewTraceCollector()
+	r.frames = r.frames[:0]
+}
+
+// Collector returns the collector of the transaction being recorded.
+func (r *TraceRecorder) Collector() *trace.TraceCollector {
+	return r.collector
+}
+
+// CaptureStart implements Tracer. The outermost frame is reported through
+// CaptureEnter like the nested ones.
+func (r *TraceRecorder) CaptureStart(from common.Address, to common.Address, create bool, input []byte, gas uint64, value *big.Int) error {
+	return nil
+}
+
+// CaptureEnter implements FrameTracer, opening a frame in the call tree.
+func (r *TraceRecorder) CaptureEnter(typ OpCode, from common.Address, to common.Address, input []byte, gas uint64, value *big.Int) {
+	frame := &trace.TraceN{
+		CallType: typ.String(),
+		FromAddr: from,
+		Input:    common.CopyBytes(input),
+		Gas:      gas,
+		Type:     "CALL",
+	}
+	switch typ {
+	case CREATE, CREATE2:
+		frame.CreateAddr, frame.Type = &to, "CREATE"
+	default:
+		frame.ToAddr = &to
+	}
+	if value != nil {
+		frame.Value = new(big.Int).Set(value)
+	} else {
+		frame.Value = new(big.Int)
+	}
+	r.collector.EnterFrame(frame)
+	if frame.CreateAddr != nil {
+		r.collector.AddCreatedSC(to)
+	}
+	r.frames = append(r.frames, frame)
+}
+
+// CaptureExit implements FrameTracer, closing the innermost open frame.
+func (r *TraceRecorder) CaptureExit(output []byte, gasLeft uint64, err error) {
+	frame := r.frames[len(r.frames)-1]
+	r.frames = r.frames[:len(r.frames)-1]
+	r.collector.ExitFrame(frame, output, gasLeft, err)
+}
+
+// CaptureState implements Tracer, recording the self destructs and the asset
+// transfers described by the emitted events right before the instructions
+// execute.
+func (r *TraceRecorder) CaptureState(env *EVM, pc uint64, op OpCode, gas, cost uint64, memory *Memory, stack *Stack, rStack *ReturnStack, rData []byte, contract *Contract, depth int, err error) error {
+	if err != nil {
+		return nil
+	}
+	switch op {
+	case SELFDESTRUCT:
+		// Read the balance without reporting it as a state access
+		statedb := env.StateDB
+		if recorder, ok := statedb.(*stateRecorder); ok {
+			statedb = recorder.StateDB
+		}
+		suicided, beneficiary := contract.Address(), common.Address(stack.Back(0).Bytes20())
+		r.collector.AddSuicide(&trace.TraceN{
+			CallType:        "SELFDESTRUCT",
+			FromAddr:        contract.caller.Address(),
+			SuicideContract: &suicided,
+			Beneficiary:     &beneficiary,
+			Value:           new(big.Int).Set(statedb.GetBalance(suicided)),
+			Type:            "SUICIDE",
+		})
+
+	case LOG0, LOG1, LOG2, LOG3, LOG4:
+		mStart, mSize := stack.Back(0), stack.Back(1)
+		topics := make([]common.Hash, int(op-LOG0))
+		for i := range topics {
+			topics[i] = stack.Back(2 + i).Bytes32()
+		}
+		r.collector.AddLog(&types.Log{
+			Address:     contract.Address(),
+			Topics:      topics,
+			Data:        memory.GetCopy(int64(mStart.Uint64()), int64(mSize.Uint64())),
+			BlockNumber: env.Context.BlockNumber.Uint64(),
+		})
+	}
+	return nil
+}
+
+// CaptureFault implements Tracer.
+func (r *TraceRecorder) CaptureFault(env *EVM, pc uint64, op OpCode, gas, cost uint64, memory *Memory, stack *Stack, rStack *ReturnStack, contract *Contract, depth int, err error) error {
+	return nil
+}
+
+// CaptureEnd implements Tracer.
+func (r *TraceRecorder) CaptureEnd(output []byte, gasUsed uint64, t time.Duration, err error) error {
+	return nil
+}
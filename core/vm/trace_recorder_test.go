@@ -0,0 +1,145 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package vm
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/trace"
+)
+
+// TestTraceRecorder tests that the trace recorder reports a nested call, the
+// token transfer described by an event and a self destruct.
+func TestTraceRecorder(t *testing.T) {
+	var (
+		caller = common.Address{0xaa}
+		outer  = common.Address{0x0a}
+		inner  = common.BytesToAddress([]byte{0x0b})
+		topic  = crypto.Keccak256Hash([]byte("Transfer(address,address,uint256)"))
+	)
+	// The outer contract calls the inner one, which emits Transfer(0xaa, 0xbb, 5)
+	// and self destructs to 0xee
+	outerCode := []byte{
+		byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH1), 0,
+		byte(PUSH1), inner[19], byte(GAS), byte(CALL), byte(STOP),
+	}
+	innerCode := []byte{byte(PUSH1), 5, byte(PUSH1), 0, byte(MSTORE), byte(PUSH1), 0xbb, byte(PUSH1), 0xaa, byte(PUSH32)}
+	innerCode = append(innerCode, topic.Bytes()...)
+	innerCode = append(innerCode, byte(PUSH1), 32, byte(PUSH1), 0, byte(LOG3), byte(PUSH1), 0xee, byte(SELFDESTRUCT))
+
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	statedb.SetCode(outer, outerCode)
+	statedb.SetCode(inner, innerCode)
+	statedb.SetBalance(inner, big.NewInt(7))
+
+	vmctx := BlockContext{
+		CanTransfer: func(StateDB, common.Address, *big.Int) bool { return true },
+		Transfer:    func(StateDB, common.Address, common.Address, *big.Int) {},
+		BlockNumber: big.NewInt(1),
+	}
+	recorder := NewTraceRecorder()
+	vmenv := NewEVM(vmctx, TxContext{}, statedb, params.AllEthashProtocolChanges, Config{Debug: true, Tracer: recorder})
+	vmenv.Reset(TxContext{}, statedb)
+
+	if _, _, err := vmenv.Call(AccountRef(caller), outer, nil, 100000, new(big.Int)); err != nil {
+		t.Fatalf("call failed: %v", err)
+	}
+	collector := vmenv.TraceCollector()
+	if collector != recorder.Collector() {
+		t.Fatal("collector of the EVM is not the recorder's")
+	}
+	traces := collector.Traces()
+	if len(traces) != 3 {
+		t.Fatalf("frame count mismatch: have %d, want 3", len(traces))
+	}
+	for i, want := range []struct {
+		callType string
+		from     common.Address
+		depth    uint64
+	}{{"CALL", caller, 1}, {"CALL", outer, 2}, {"SELFDESTRUCT", outer, 3}} {
+		if have := traces[i]; have.CallType != want.callType || have.FromAddr != want.from || have.CallDepth != want.depth {
+			t.Errorf("frame %d mismatch: have %s from %x at %d, want %s from %x at %d", i, have.CallType, have.FromAddr, have.CallDepth, want.callType, want.from, want.depth)
+		}
+	}
+	if suicide := traces[2]; *suicide.SuicideContract != inner || *suicide.Beneficiary != (common.BytesToAddress([]byte{0xee})) || suicide.Value.Int64() != 7 {
+		t.Errorf("self destruct mismatch: have %x to %x value %v", *suicide.SuicideContract, *suicide.Beneficiary, suicide.Value)
+	}
+	transfers := collector.Transfers
+	if len(transfers) != 2 {
+		t.Fatalf("transfer count mismatch: have %d, want 2", len(transfers))
+	}
+	if token := transfers[0]; token.Token != inner || token.From != common.BytesToAddress([]byte{0xaa}) || token.To != common.BytesToAddress([]byte{0xbb}) || token.Amount.Int64() != 5 || token.TraceIndex != 1 {
+		t.Errorf("token transfer mismatch: have %+v", token)
+	}
+	if ether := transfers[1]; ether.Standard != trace.StandardETH || ether.From != inner || ether.Amount.Int64() != 7 {
+		t.Errorf("self destruct transfer mismatch: have %+v", ether)
+	}
+}
+
+// TestTraceRecorderDisabled tests that no trace is recorded without the
+// recorder configured as tracer.
+func TestTraceRecorderDisabled(t *testing.T) {
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	vmenv := NewEVM(BlockContext{}, TxContext{}, statedb, params.AllEthashProtocolChanges, Config{})
+	if vmenv.TraceCollector() != nil {
+		t.Error("trace collector present without the recorder")
+	}
+	vmenv = NewEVM(BlockContext{}, TxContext{}, statedb, params.AllEthashProtocolChanges, Config{Debug: true, Tracer: NewStructLogger(nil)})
+	if vmenv.TraceCollector() != nil || vmenv.frameTracer != nil {
+		t.Error("trace recorded with another tracer")
+	}
+}
+
+// TestTraceRecorderWithTracer tests that the trace recorder runs alongside the
+// tracer already configured, instead of replacing it.
+func TestTraceRecorderWithTracer(t *testing.T) {
+	var (
+		caller   = common.Address{0xaa}
+		contract = common.Address{0x0a}
+	)
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	statedb.SetCode(contract, []byte{byte(PUSH1), 1, byte(PUSH1), 0, byte(SSTORE), byte(STOP)})
+
+	vmctx := BlockContext{
+		CanTransfer: func(StateDB, common.Address, *big.Int) bool { return true },
+		Transfer:    func(StateDB, common.Address, common.Address, *big.Int) {},
+		BlockNumber: big.NewInt(1),
+	}
+	logger := NewStructLogger(nil)
+	vmenv := NewEVM(vmctx, TxContext{}, statedb, params.AllEthashProtocolChanges, WithTraceRecorder(Config{Debug: true, Tracer: logger}))
+	vmenv.Reset(TxContext{}, statedb)
+
+	if _, _, err := vmenv.Call(AccountRef(caller), contract, nil, 100000, new(big.Int)); err != nil {
+		t.Fatalf("call failed: %v", err)
+	}
+	if logs := logger.StructLogs(); len(logs) != 4 {
+		t.Errorf("struct log count mismatch: have %d, want 4", len(logs))
+	}
+	collector := vmenv.TraceCollector()
+	if collector == nil {
+		t.Fatal("trace collector missing")
+	}
+	if traces := collector.Traces(); len(traces) != 1 || traces[0].FromAddr != caller {
+		t.Errorf("traces mismatch: have %+v", traces)
+	}
+}
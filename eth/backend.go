@@ -42,6 +42,7 @@ import (
 	"github.com/ethereum/go-ethereum/eth/gasprice"
 	"github.com/ethereum/go-ethereum/eth/protocols/eth"
 	"github.com/ethereum/go-ethereum/eth/protocols/snap"
+	"github.com/ethereum/go-ethereum/eth/syncstatus"
 	"github.com/ethereum/go-ethereum/ethdb"
 	"github.com/ethereum/go-ethereum/event"
 	"github.com/ethereum/go-ethereum/internal/ethapi"
@@ -54,7 +55,6 @@ import (
 	"github.com/ethereum/go-ethereum/rlp"
 	"github.com/ethereum/go-ethereum/rpc"
 
-
 	"github.com/ethereum/go-ethereum/realtime"
 	"github.com/ethereum/go-ethereum/trace"
 	// "fmt"
@@ -84,9 +84,11 @@ type Ethereum struct {
 
 	APIBackend *EthAPIBackend
 
-	miner     *miner.Miner
-	gasPrice  *big.Int
-	etherbase common.Address
+	miner      *miner.Miner
+	simulator  *realtime.Simulator
+	syncStatus *syncstatus.Service
+	gasPrice   *big.Int
+	etherbase  common.Address
 
 	networkID     uint64
 	netRPCService *ethapi.PublicNetAPI
@@ -167,6 +169,7 @@ func New(stack *node.Node, config *Config) (*Ethereum, error) {
 			EnablePreimageRecording: config.EnablePreimageRecording,
 			EWASMInterpreter:        config.EWASMInterpreter,
 			EVMInterpreter:          config.EVMInterpreter,
+			TraceStateAccess:        config.Trace.State,
 		}
 		cacheConfig = &core.CacheConfig{
 			TrieCleanLimit:      config.TrieCleanCache,
@@ -195,6 +198,9 @@ func New(stack *node.Node, config *Config) (*Ethereum, error) {
 	if config.TxPool.Journal != "" {
 		config.TxPool.Journal = stack.ResolvePath(config.TxPool.Journal)
 	}
+	if config.Trace.PoolJournal != "" {
+		config.Trace.PoolJournal = stack.ResolvePath(config.Trace.PoolJournal)
+	}
 	eth.txPool = core.NewTxPool(config.TxPool, chainConfig, eth.blockchain)
 
 	// Permit the downloader to use the trie cache allowance during fast sync
@@ -204,16 +210,61 @@ func New(stack *node.Node, config *Config) (*Ethereum, error) {
 		checkpoint = params.TrustedCheckpoints[genesisHash]
 	}
 
-	// new added
-	// fmt.Println("simulator new begin")
-	// fmt.Printf("header time now  %s\n", time.Now())
-	// fmt.Println("current parent num %d", eth.blockchain.CurrentBlock().Number())
-	simulator := realtime.New(eth, chainConfig, eth.engine)
-	// fmt.Println("simulator new end")
-	trace.InitRealtimeDB()
-	// fmt.Println("open mongodb")
+	// Track the sync status, tracing and simulating only at the chain head
+	eth.syncStatus = syncstatus.New(syncstatus.Config{
+		PauseLag:  config.Trace.PauseLag,
+		ResumeLag: config.Trace.ResumeLag,
+	}, eth.eventMux, eth.blockchain, func() uint64 {
+		return eth.handler.downloader.Progress().HighestBlock
+	})
+
+	// Open the trace sinks of the imported and the simulated transactions
+	if config.Trace.ErrorLog != "" {
+		config.Trace.ErrorLog = stack.ResolvePath(config.Trace.ErrorLog)
+	}
+	trace.SetWETHTokens(config.Trace.WETH)
+
+	var historySinks []trace.Sink
+
+	// closeTraces releases the trace sinks and the simulator if the service
+	// fails to come up after they were opened
+	closeTraces := func() {
+		for _, sink := range historySinks {
+			if err := sink.Close(); err != nil {
+				log.Warn("Failed to close trace sink", "err", err)
+			}
+		}
+		if eth.simulator != nil {
+			eth.simulator.Close()
+		}
+	}
+	if config.Trace.Sync {
+		sink, err := trace.OpenSink(&config.Trace, config.Trace.History)
+		if err != nil {
+			return nil, err
+		}
+		historySinks = append(historySinks, sink)
+	}
+	if config.Trace.Realtime {
+		pendingSink, err := trace.OpenSink(&config.Trace, config.Trace.Pending)
+		if err != nil {
+			closeTraces()
+			return nil, err
+		}
+		eth.simulator = realtime.New(eth, chainConfig, eth.engine, &config.Trace, &config.Miner, &config.TxPool, pendingSink)
+
+		// Compare the simulations with the traces of the mined transactions if
+		// they are traced anyway or explicitly asked for, with their receipts
+		// otherwise
+		if config.Trace.Sync || config.Trace.Correlate {
+			historySinks = append(historySinks, eth.simulator.HistorySink())
+		}
+	}
+	if len(historySinks) > 0 {
+		eth.blockchain.SetTraceSink(trace.NewMultiSink(historySinks...))
+		eth.blockchain.SetTraceSyncStatus(eth.syncStatus)
+	}
 
-	// add the simulator to the handler
 	if eth.handler, err = newHandler(&handlerConfig{
 		Database:   chainDb,
 		Chain:      eth.blockchain,
@@ -224,17 +275,13 @@ func New(stack *node.Node, config *Config) (*Ethereum, error) {
 		EventMux:   eth.eventMux,
 		Checkpoint: checkpoint,
 		Whitelist:  config.Whitelist,
-
-		// Mia Add
-		RTSimulator: simulator,
-
 	}); err != nil {
+		closeTraces()
 		return nil, err
 	}
 	eth.miner = miner.New(eth, &config.Miner, chainConfig, eth.EventMux(), eth.engine, eth.isLocalBlock)
 	eth.miner.SetExtra(makeExtraData(config.Miner.ExtraData))
 	// fmt.Println("miner new end")
-	
 
 	eth.APIBackend = &EthAPIBackend{stack.Config().ExtRPCEnabled(), eth, nil}
 	gpoParams := config.GPO
@@ -245,10 +292,12 @@ func New(stack *node.Node, config *Config) (*Ethereum, error) {
 
 	eth.ethDialCandidates, err = setupDiscovery(eth.config.EthDiscoveryURLs)
 	if err != nil {
+		closeTraces()
 		return nil, err
 	}
 	eth.snapDialCandidates, err = setupDiscovery(eth.config.SnapDiscoveryURLs)
 	if err != nil {
+		closeTraces()
 		return nil, err
 	}
 	// Start the RPC service
@@ -332,6 +381,26 @@ func (s *Ethereum) APIs() []rpc.API {
 	// Append any APIs exposed explicitly by the consensus engine
 	apis = append(apis, s.engine.APIs(s.BlockChain())...)
 
+	// Append the simulation APIs if pending transactions are simulated
+	if s.simulator != nil {
+		apis = append(apis, []rpc.API{
+			{
+				Namespace: "realtime",
+				Version:   "1.0",
+				Service:   realtime.NewPublicRealtimeAPI(s.simulator),
+				Public:    true,
+			}, {
+				Namespace: "realtime",
+				Version:   "1.0",
+				Service:   realtime.NewPrivateRealtimeAPI(s.simulator),
+			}, {
+				Namespace: "eth",
+				Version:   "1.0",
+				Service:   realtime.NewPublicSimulationFilterAPI(s.simulator),
+				Public:    true,
+			},
+		}...)
+	}
 	// Append all the local APIs and return
 	return append(apis, []rpc.API{
 		{
@@ -372,6 +441,11 @@ func (s *Ethereum) APIs() []rpc.API {
 			Namespace: "debug",
 			Version:   "1.0",
 			Service:   NewPrivateDebugAPI(s),
+		}, {
+			Namespace: "sync",
+			Version:   "1.0",
+			Service:   syncstatus.NewPublicSyncStatusAPI(s.syncStatus),
+			Public:    true,
 		}, {
 			Namespace: "net",
 			Version:   "1.0",
@@ -542,6 +616,7 @@ func (s *Ethereum) Engine() consensus.Engine           { return s.engine }
 func (s *Ethereum) ChainDb() ethdb.Database            { return s.chainDb }
 func (s *Ethereum) IsListening() bool                  { return true } // Always listening
 func (s *Ethereum) Downloader() *downloader.Downloader { return s.handler.downloader }
+func (s *Ethereum) SyncStatus() *syncstatus.Service    { return s.syncStatus }
 func (s *Ethereum) Synced() bool                       { return atomic.LoadUint32(&s.handler.acceptTxs) == 1 }
 func (s *Ethereum) ArchiveMode() bool                  { return s.config.NoPruning }
 func (s *Ethereum) BloomIndexer() *core.ChainIndexer   { return s.bloomIndexer }
@@ -573,7 +648,11 @@ func (s *Ethereum) Start() error {
 		maxPeers -= s.config.LightPeers
 	}
 	// Start the networking layer and the light server if requested
+	s.syncStatus.Start()
 	s.handler.Start(maxPeers)
+	if s.simulator != nil {
+		s.simulator.Start()
+	}
 	return nil
 }
 
@@ -582,12 +661,16 @@ func (s *Ethereum) Start() error {
 func (s *Ethereum) Stop() error {
 	// Stop all the peer-related stuff first.
 	s.handler.Stop()
+	s.syncStatus.Stop()
 
 	// Then stop everything else.
 	s.bloomIndexer.Close()
 	close(s.closeBloomHandler)
 	s.txPool.Stop()
 	s.miner.Stop()
+	if s.simulator != nil {
+		s.simulator.Close()
+	}
 	s.blockchain.Stop()
 	s.engine.Close()
 	rawdb.PopUncleanShutdownMarker(s.chainDb)
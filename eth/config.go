@@ -31,6 +31,7 @@ import (
 	"github.com/ethereum/go-ethereum/eth/gasprice"
 	"github.com/ethereum/go-ethereum/miner"
 	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/trace"
 )
 
 // DefaultFullGPOConfig contains default gasprice oracle settings for full node.
@@ -78,7 +79,10 @@ var DefaultConfig = Config{
 	TxPool:      core.DefaultTxPoolConfig,
 	RPCGasCap:   25000000,
 	GPO:         DefaultFullGPOConfig,
+	Trace:       trace.DefaultConfig,
 	RPCTxFeeCap: 1, // 1 ether
+
+	RPCTraceFilterRange: 100,
 }
 
 func init() {
@@ -165,6 +169,9 @@ type Config struct {
 	// Gas Price Oracle options
 	GPO gasprice.Config
 
+	// Trace recorder options
+	Trace trace.Config
+
 	// Enables tracking of SHA3 preimages in the VM
 	EnablePreimageRecording bool
 
@@ -184,6 +191,10 @@ type Config struct {
 	// send-transction variants. The unit is ether.
 	RPCTxFeeCap float64 `toml:",omitempty"`
 
+	// RPCTraceFilterRange is the maximum number of blocks a trace_filter request
+	// can span, 0 disables the limit.
+	RPCTraceFilterRange uint64 `toml:",omitempty"`
+
 	// Checkpoint is a hardcoded checkpoint which can be nil.
 	Checkpoint *params.TrustedCheckpoint `toml:",omitempty"`
 
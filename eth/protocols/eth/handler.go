@@ -31,11 +31,6 @@ import (
 	"github.com/ethereum/go-ethereum/params"
 	"github.com/ethereum/go-ethereum/rlp"
 	"github.com/ethereum/go-ethereum/trie"
-
-	"github.com/ethereum/go-ethereum/realtime"
-	"github.com/ethereum/go-ethereum/trace"
-	// "os"
-	"time"
 )
 
 const (
@@ -98,9 +93,6 @@ type Backend interface {
 	// the remote peer. Only packets not consumed by the protocol handler will
 	// be forwarded to the backend.
 	Handle(peer *Peer, packet Packet) error
-
-	// Mia add
-	RTSimulator() *realtime.Simulator
 }
 
 // TxPool defines the methods needed by the protocol handler to serve transactions.
@@ -519,16 +511,6 @@ func handleMessage(backend Backend, peer *Peer) error {
 			}
 			peer.markTransaction(tx.Hash())
 		}
-
-		trace.SyncedDone = false
-		if trace.SyncedDone == true {
-			fmt.Printf("How many messages SyncedDone time %s length %d\n", time.Now(), len(txs))
-			backend.RTSimulator().HandleMessages(txs)
-		} else {
-			fmt.Printf("How many messages not SyncedDone time %s length %d\n", time.Now(), len(txs))
-		}
-		
-
 		if msg.Code == PooledTransactionsMsg {
 			return backend.Handle(peer, (*PooledTransactionsPacket)(&txs))
 		}
@@ -31,7 +31,6 @@ import (
 	"github.com/ethereum/go-ethereum/p2p/enode"
 
 	"fmt"
-	"github.com/ethereum/go-ethereum/trace"
 )
 
 const (
@@ -347,14 +346,6 @@ func (h *handler) doSync(op *chainSyncOp) error {
 			atomic.StoreUint32(&h.acceptTxs, 1)
 		}
 	}
-
-	// Mia add
-	if head.NumberU64() >= h.downloader.HighestBlockNum() {
-		fmt.Printf("doSync func, head.NumberU64(), >= highestBlockNumber, %s %d %d\n", time.Now(), head.NumberU64(), h.downloader.HighestBlockNum())
-		trace.SyncedDone = true
-	}
-
-
 	if head.NumberU64() > 0 {
 		// We've completed a sync cycle, notify all peers of new state. This path is
 		// essential in star-topology networks where a gateway node needs to notify
@@ -0,0 +1,68 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package syncstatus
+
+import (
+	"context"
+
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// PublicSyncStatusAPI exposes the sync status of the node.
+type PublicSyncStatusAPI struct {
+	s *Service
+}
+
+// NewPublicSyncStatusAPI creates a new API for the given sync status service.
+func NewPublicSyncStatusAPI(s *Service) *PublicSyncStatusAPI {
+	return &PublicSyncStatusAPI{s}
+}
+
+// Status returns the current sync status.
+func (api *PublicSyncStatusAPI) Status() Status {
+	return api.s.Status()
+}
+
+// Changes creates a subscription notified each time the node becomes synced or
+// falls behind the network.
+func (api *PublicSyncStatusAPI) Changes(ctx context.Context) (*rpc.Subscription, error) {
+	notifier, supported := rpc.NotifierFromContext(ctx)
+	if !supported {
+		return &rpc.Subscription{}, rpc.ErrNotificationsUnsupported
+	}
+	rpcSub := notifier.CreateSubscription()
+
+	go func() {
+		statuses := make(chan Status)
+		sub := api.s.SubscribeStatus(statuses)
+		defer sub.Unsubscribe()
+
+		for {
+			select {
+			case status := <-statuses:
+				notifier.Notify(rpcSub.ID, status)
+			case <-rpcSub.Err():
+				return
+			case <-notifier.Closed():
+				return
+			case <-sub.Err():
+				return
+			}
+		}
+	}()
+	return rpcSub, nil
+}
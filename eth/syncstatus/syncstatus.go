@@ -0,0 +1,228 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package syncstatus tracks whether the node has caught up with the network, so
+// work which only makes sense at the chain head, such as simulating pending
+// transactions, can be paused while the node is catching up.
+package syncstatus
+
+import (
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/eth/downloader"
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// chainHeadChanSize is the size of channel listening to ChainHeadEvent.
+const chainHeadChanSize = 10
+
+// Config are the hysteresis thresholds of the sync status. A synced node is
+// considered catching up once it falls more than PauseLag blocks behind the
+// network, and synced again once it is at most ResumeLag blocks behind.
+type Config struct {
+	PauseLag  uint64
+	ResumeLag uint64
+}
+
+// DefaultConfig contains the default sync status thresholds.
+var DefaultConfig = Config{
+	PauseLag:  8,
+	ResumeLag: 1,
+}
+
+// Status is a snapshot of the sync status of the node.
+type Status struct {
+	Synced  bool           `json:"synced"`  // whether the node is caught up with the network
+	Syncing bool           `json:"syncing"` // whether the downloader is running a sync cycle
+	Head    hexutil.Uint64 `json:"head"`    // number of the local head block
+	Highest hexutil.Uint64 `json:"highest"` // highest block number known from the network
+}
+
+// Chain is the part of the blockchain the sync status is tracked on.
+type Chain interface {
+	CurrentBlock() *types.Block
+	SubscribeChainHeadEvent(ch chan<- core.ChainHeadEvent) event.Subscription
+}
+
+// Service tracks the sync status based on the downloader events and progress
+// and the local chain head, notifying subscribers whenever the node becomes
+// synced or falls behind. Heads announced by peers are not taken into account
+// until the downloader fetched them, so a single peer can't pause the node by
+// announcing a bogus block number.
+type Service struct {
+	config  Config
+	mux     *event.TypeMux
+	chain   Chain
+	highest func() uint64 // highest block known to the downloader
+
+	synced  bool
+	syncing bool
+	done    bool // whether a sync cycle has completed yet
+	head    uint64
+	lock    sync.RWMutex
+
+	feed  event.Feed
+	scope event.SubscriptionScope
+	quit  chan struct{}
+	wg    sync.WaitGroup
+}
+
+// New creates a sync status service. The highest function reports the highest
+// block known to the downloader; it is not called before Start.
+func New(config Config, mux *event.TypeMux, chain Chain, highest func() uint64) *Service {
+	if config.ResumeLag > config.PauseLag {
+		log.Warn("Sanitizing sync status resume lag", "provided", config.ResumeLag, "updated", config.PauseLag)
+		config.ResumeLag = config.PauseLag
+	}
+	return &Service{
+		config:  config,
+		mux:     mux,
+		chain:   chain,
+		highest: highest,
+		quit:    make(chan struct{}),
+	}
+}
+
+// Start begins tracking the sync status.
+func (s *Service) Start() {
+	s.lock.Lock()
+	s.head = s.chain.CurrentBlock().NumberU64()
+	s.lock.Unlock()
+
+	s.wg.Add(1)
+	go s.loop()
+}
+
+// Stop terminates the sync status tracking and all subscriptions.
+func (s *Service) Stop() {
+	close(s.quit)
+	s.wg.Wait()
+	s.scope.Close()
+}
+
+// Synced reports whether the node is caught up with the network.
+func (s *Service) Synced() bool {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	return s.synced
+}
+
+// Status returns the current sync status.
+func (s *Service) Status() Status {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	return s.status()
+}
+
+// SubscribeStatus registers a subscription notified with the new status each
+// time the node becomes synced or falls behind.
+func (s *Service) SubscribeStatus(ch chan<- Status) event.Subscription {
+	return s.scope.Track(s.feed.Subscribe(ch))
+}
+
+func (s *Service) loop() {
+	defer s.wg.Done()
+
+	var (
+		events = s.mux.Subscribe(downloader.StartEvent{}, downloader.DoneEvent{}, downloader.FailedEvent{})
+		heads  = make(chan core.ChainHeadEvent, chainHeadChanSize)
+		sub    = s.chain.SubscribeChainHeadEvent(heads)
+	)
+	defer events.Unsubscribe()
+	defer sub.Unsubscribe()
+
+	for {
+		select {
+		case ev := <-events.Chan():
+			if ev == nil {
+				return
+			}
+			switch ev.Data.(type) {
+			case downloader.StartEvent:
+				s.update(func() { s.syncing = true })
+			case downloader.DoneEvent:
+				s.update(func() { s.syncing, s.done = false, true })
+			case downloader.FailedEvent:
+				s.update(func() { s.syncing = false })
+			}
+		case head := <-heads:
+			s.update(func() { s.head = head.Block.NumberU64() })
+		case <-sub.Err():
+			return
+		case <-s.quit:
+			return
+		}
+	}
+}
+
+// update applies a change to the tracked state and notifies the subscribers if
+// the node became synced or fell behind as a result.
+func (s *Service) update(change func()) {
+	s.lock.Lock()
+	change()
+
+	lag := uint64(0)
+	if highest := s.highestLocked(); highest > s.head {
+		lag = highest - s.head
+	}
+	synced := s.synced
+	switch {
+	case !s.done:
+		synced = false
+	case s.synced && lag > s.config.PauseLag:
+		synced = false
+	case !s.synced && lag <= s.config.ResumeLag:
+		synced = true
+	}
+	changed := synced != s.synced
+	s.synced = synced
+	status := s.status()
+	s.lock.Unlock()
+
+	if changed {
+		log.Info("Sync status changed", "synced", status.Synced, "head", uint64(status.Head), "highest", uint64(status.Highest))
+		s.feed.Send(status)
+	}
+}
+
+// highestLocked returns the highest block number known from the network. The
+// caller must hold the lock.
+func (s *Service) highestLocked() uint64 {
+	if s.highest == nil {
+		return 0
+	}
+	return s.highest()
+}
+
+// status assembles the current status. The caller must hold the lock.
+func (s *Service) status() Status {
+	highest := s.highestLocked()
+	if s.head > highest {
+		highest = s.head
+	}
+	return Status{
+		Synced:  s.synced,
+		Syncing: s.syncing,
+		Head:    hexutil.Uint64(s.head),
+		Highest: hexutil.Uint64(highest),
+	}
+}
@@ -0,0 +1,118 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package syncstatus
+
+import (
+	"math/big"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/eth/downloader"
+	"github.com/ethereum/go-ethereum/event"
+)
+
+// testChain is a chain whose head is set by the test.
+type testChain struct {
+	head *types.Block
+	feed event.Feed
+}
+
+func (c *testChain) CurrentBlock() *types.Block { return c.head }
+
+func (c *testChain) SubscribeChainHeadEvent(ch chan<- core.ChainHeadEvent) event.Subscription {
+	return c.feed.Subscribe(ch)
+}
+
+func (c *testChain) setHead(number uint64) {
+	c.head = types.NewBlockWithHeader(&types.Header{Number: new(big.Int).SetUint64(number)})
+	c.feed.Send(core.ChainHeadEvent{Block: c.head})
+}
+
+func TestSyncStatusHysteresis(t *testing.T) {
+	var (
+		mux     = new(event.TypeMux)
+		chain   = &testChain{head: types.NewBlockWithHeader(&types.Header{Number: big.NewInt(0)})}
+		highest uint64
+	)
+	defer mux.Stop()
+
+	s := New(Config{PauseLag: 8, ResumeLag: 1}, mux, chain, func() uint64 { return atomic.LoadUint64(&highest) })
+	s.Start()
+	defer s.Stop()
+
+	statuses := make(chan Status, 10)
+	sub := s.SubscribeStatus(statuses)
+	defer sub.Unsubscribe()
+
+	expect := func(synced bool) {
+		t.Helper()
+		select {
+		case status := <-statuses:
+			if status.Synced != synced {
+				t.Fatalf("status mismatch: have synced %v, want %v", status.Synced, synced)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("no status change to synced %v", synced)
+		}
+		if s.Synced() != synced {
+			t.Fatalf("synced mismatch: have %v, want %v", s.Synced(), synced)
+		}
+	}
+	expectNone := func() {
+		t.Helper()
+		select {
+		case status := <-statuses:
+			t.Fatalf("unexpected status change: %+v", status)
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+	// Without any finished sync cycle the node is not considered synced
+	chain.setHead(1)
+	expectNone()
+
+	// The first sync cycle catches up with the network
+	atomic.StoreUint64(&highest, 100)
+	mux.Post(downloader.StartEvent{})
+	chain.setHead(99)
+	expectNone()
+	mux.Post(downloader.DoneEvent{})
+	expect(true)
+
+	// Falling slightly behind is tolerated
+	atomic.StoreUint64(&highest, 105)
+	mux.Post(downloader.StartEvent{})
+	expectNone()
+	mux.Post(downloader.DoneEvent{})
+	chain.setHead(105)
+	expectNone()
+
+	// Falling far behind pauses until caught up to within the resume lag
+	atomic.StoreUint64(&highest, 120)
+	mux.Post(downloader.StartEvent{})
+	expect(false)
+	chain.setHead(110)
+	expectNone()
+	chain.setHead(119)
+	expect(true)
+
+	if status := s.Status(); uint64(status.Head) != 119 || uint64(status.Highest) != 120 {
+		t.Errorf("status mismatch: have head %d highest %d, want 119 and 120", status.Head, status.Highest)
+	}
+}
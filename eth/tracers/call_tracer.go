@@ -0,0 +1,297 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package tracers
+
+import (
+	"encoding/json"
+	"math/big"
+	"sync/atomic"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/vm"
+)
+
+// callFrame is a call reported by the call tracer, with its fields in the order
+// the JavaScript call tracer outputs them.
+type callFrame struct {
+	Type    string          `json:"type"`
+	From    common.Address  `json:"from"`
+	To      *common.Address `json:"to,omitempty"`
+	Value   *hexutil.Big    `json:"value,omitempty"`
+	Gas     *hexutil.Uint64 `json:"gas,omitempty"`
+	GasUsed *hexutil.Uint64 `json:"gasUsed,omitempty"`
+	Input   *hexutil.Bytes  `json:"input,omitempty"`
+	Output  *hexutil.Bytes  `json:"output,omitempty"`
+	Error   string          `json:"error,omitempty"`
+	Time    string          `json:"time,omitempty"`
+	Calls   []*callFrame    `json:"calls,omitempty"`
+
+	gasIn   uint64 // Gas available to the instruction opening the frame
+	gasCost uint64 // Cost of the instruction opening the frame
+	outOff  int64  // Memory offset the output of a call is copied to
+	outLen  int64  // Length of the output of a call copied to memory
+}
+
+// callTracer is the native implementation of the callTracer JavaScript tracer,
+// reporting all the internal calls made by a transaction. It follows the same
+// algorithm opcode by opcode, so that both report exactly the same calls.
+type callTracer struct {
+	callstack []*callFrame // Calls being executed, the transaction itself first
+	descended bool         // Whether an inner call was just entered
+
+	// Transaction level details, reported for the outermost call
+	typ     string
+	from    common.Address
+	to      common.Address
+	input   []byte
+	gas     uint64
+	value   *big.Int
+	gasUsed uint64
+	output  []byte
+	elapsed time.Duration
+	err     error
+
+	interrupt uint32 // Atomic flag to signal execution interruption
+	reason    error  // Textual reason for the interruption
+}
+
+// newCallTracer creates a native call tracer. It takes no configuration.
+func newCallTracer(txCtx vm.TxContext, config json.RawMessage) (ResultTracer, error) {
+	return &callTracer{callstack: []*callFrame{{}}}, nil
+}
+
+// CaptureStart implements vm.Tracer, recording the outermost call.
+func (t *callTracer) CaptureStart(from common.Address, to common.Address, create bool, input []byte, gas uint64, value *big.Int) error {
+	t.typ = "CALL"
+	if create {
+		t.typ = "CREATE"
+	}
+	t.from, t.to, t.input, t.gas, t.value = from, to, common.CopyBytes(input), gas, value
+	return nil
+}
+
+// CaptureState implements vm.Tracer, opening and closing the calls around the
+// instructions entering and returning from them.
+func (t *callTracer) CaptureState(env *vm.EVM, pc uint64, op vm.OpCode, gas, cost uint64, memory *vm.Memory, stack *vm.Stack, rStack *vm.ReturnStack, rData []byte, contract *vm.Contract, depth int, err error) error {
+	if atomic.LoadUint32(&t.interrupt) > 0 {
+		env.Cancel()
+		return nil
+	}
+	// Capture any errors immediately
+	if err != nil {
+		t.fault(err)
+		return nil
+	}
+	// We only care about system opcodes, faster if we pre-check once
+	syscall := op&0xf0 == 0xf0
+
+	switch {
+	case syscall && (op == vm.CREATE || op == vm.CREATE2):
+		// A new contract is being created, add to the call stack
+		inOff := int64(stack.Back(1).Uint64())
+		inEnd := inOff + int64(stack.Back(2).Uint64())
+
+		t.callstack = append(t.callstack, &callFrame{
+			Type:    op.String(),
+			From:    contract.Address(),
+			Input:   (*hexutil.Bytes)(ptrTo(memorySlice(memory, inOff, inEnd))),
+			Value:   (*hexutil.Big)(stack.Back(0).ToBig()),
+			gasIn:   gas,
+			gasCost: cost,
+		})
+		t.descended = true
+		return nil
+
+	case syscall && op == vm.SELFDESTRUCT:
+		// A contract is being self destructed, gather that as a subcall too
+		to := common.Address(stack.Back(0).Bytes20())
+
+		parent := t.callstack[len(t.callstack)-1]
+		parent.Calls = append(parent.Calls, &callFrame{
+			Type:  op.String(),
+			From:  contract.Address(),
+			To:    &to,
+			Value: (*hexutil.Big)(new(big.Int).Set(env.StateDB.GetBalance(contract.Address()))),
+		})
+		return nil
+
+	case syscall && (op == vm.CALL || op == vm.CALLCODE || op == vm.DELEGATECALL || op == vm.STATICCALL):
+		// A new method invocation is being done, add to the call stack. Skip any
+		// pre-compile invocations, those are just fancy opcodes
+		to := common.Address(stack.Back(1).Bytes20())
+		if _, ok := vm.PrecompiledContractsIstanbul[to]; ok {
+			return nil
+		}
+		off := 1
+		if op == vm.DELEGATECALL || op == vm.STATICCALL {
+			off = 0
+		}
+		inOff := int64(stack.Back(2 + off).Uint64())
+		inEnd := inOff + int64(stack.Back(3+off).Uint64())
+
+		call := &callFrame{
+			Type:    op.String(),
+			From:    contract.Address(),
+			To:      &to,
+			Input:   (*hexutil.Bytes)(ptrTo(memorySlice(memory, inOff, inEnd))),
+			gasIn:   gas,
+			gasCost: cost,
+			outOff:  int64(stack.Back(4 + off).Uint64()),
+			outLen:  int64(stack.Back(5 + off).Uint64()),
+		}
+		if off == 1 {
+			call.Value = (*hexutil.Big)(stack.Back(2).ToBig())
+		}
+		t.callstack = append(t.callstack, call)
+		t.descended = true
+		return nil
+	}
+	// If we've just descended into an inner call, retrieve its true allowance. It
+	// has to be extracted from within the call as there may be funky gas dynamics
+	// with regard to requested and actually given gas (2300 stipend, 63/64 rule).
+	// Calls to plain accounts never get here, so their gas is not reported.
+	if t.descended {
+		if depth >= len(t.callstack) {
+			t.callstack[len(t.callstack)-1].Gas = (*hexutil.Uint64)(&gas)
+		}
+		t.descended = false
+	}
+	if syscall && op == vm.REVERT {
+		t.callstack[len(t.callstack)-1].Error = "execution reverted"
+		return nil
+	}
+	if depth == len(t.callstack)-1 {
+		// An inner call returned, pop it off the call stack and get its results
+		call := t.callstack[len(t.callstack)-1]
+		t.callstack = t.callstack[:len(t.callstack)-1]
+
+		ret := stack.Back(0)
+		if call.Type == "CREATE" || call.Type == "CREATE2" {
+			// A contract was created, retrieve its address and code
+			gasUsed := call.gasIn - call.gasCost - gas
+			call.GasUsed = (*hexutil.Uint64)(&gasUsed)
+
+			if !ret.IsZero() {
+				to := common.Address(ret.Bytes20())
+				call.To = &to
+				call.Output = (*hexutil.Bytes)(ptrTo(common.CopyBytes(env.StateDB.GetCode(to))))
+			} else if call.Error == "" {
+				call.Error = "internal failure"
+			}
+		} else {
+			// A contract was called, retrieve its gas usage and output
+			if call.Gas != nil {
+				gasUsed := call.gasIn - call.gasCost + uint64(*call.Gas) - gas
+				call.GasUsed = (*hexutil.Uint64)(&gasUsed)
+			}
+			if !ret.IsZero() {
+				call.Output = (*hexutil.Bytes)(ptrTo(memorySlice(memory, call.outOff, call.outOff+call.outLen)))
+			} else if call.Error == "" {
+				call.Error = "internal failure"
+			}
+		}
+		parent := t.callstack[len(t.callstack)-1]
+		parent.Calls = append(parent.Calls, call)
+	}
+	return nil
+}
+
+// CaptureFault implements vm.Tracer, failing the call the error occurred in.
+func (t *callTracer) CaptureFault(env *vm.EVM, pc uint64, op vm.OpCode, gas, cost uint64, memory *vm.Memory, stack *vm.Stack, rStack *vm.ReturnStack, contract *vm.Contract, depth int, err error) error {
+	if atomic.LoadUint32(&t.interrupt) > 0 {
+		return nil
+	}
+	t.fault(err)
+	return nil
+}
+
+// fault pops the call failing with the given error off the call stack.
+func (t *callTracer) fault(err error) {
+	// If the topmost call already reverted, don't handle the additional fault again
+	if t.callstack[len(t.callstack)-1].Error != "" {
+		return
+	}
+	call := t.callstack[len(t.callstack)-1]
+	t.callstack = t.callstack[:len(t.callstack)-1]
+	call.Error = err.Error()
+
+	// Consume all available gas
+	if call.Gas != nil {
+		gasUsed := *call.Gas
+		call.GasUsed = &gasUsed
+	}
+	// Flatten the failed call into its parent, or leave it in the stack if it
+	// is the outermost one
+	if len(t.callstack) > 0 {
+		parent := t.callstack[len(t.callstack)-1]
+		parent.Calls = append(parent.Calls, call)
+		return
+	}
+	t.callstack = append(t.callstack, call)
+}
+
+// CaptureEnd implements vm.Tracer, recording the outcome of the outermost call.
+func (t *callTracer) CaptureEnd(output []byte, gasUsed uint64, elapsed time.Duration, err error) error {
+	t.output, t.gasUsed, t.elapsed, t.err = common.CopyBytes(output), gasUsed, elapsed, err
+	return nil
+}
+
+// GetResult implements ResultTracer, returning the call tree of the transaction.
+func (t *callTracer) GetResult() (json.RawMessage, error) {
+	if atomic.LoadUint32(&t.interrupt) > 0 {
+		return nil, t.reason
+	}
+	value := t.value
+	if value == nil {
+		value = new(big.Int)
+	}
+	result := &callFrame{
+		Type:    t.typ,
+		From:    t.from,
+		To:      &t.to,
+		Value:   (*hexutil.Big)(value),
+		Gas:     (*hexutil.Uint64)(&t.gas),
+		GasUsed: (*hexutil.Uint64)(&t.gasUsed),
+		Input:   (*hexutil.Bytes)(&t.input),
+		Output:  (*hexutil.Bytes)(&t.output),
+		Time:    t.elapsed.String(),
+		Calls:   t.callstack[0].Calls,
+	}
+	if t.callstack[0].Error != "" {
+		result.Error = t.callstack[0].Error
+	} else if t.err != nil {
+		result.Error = t.err.Error()
+	}
+	if result.Error != "" && (result.Error != "execution reverted" || len(t.output) == 0) {
+		result.Output = nil
+	}
+	return json.Marshal(result)
+}
+
+// Stop implements ResultTracer, aborting the execution of the transaction.
+func (t *callTracer) Stop(err error) {
+	t.reason = err
+	atomic.StoreUint32(&t.interrupt, 1)
+}
+
+// ptrTo returns a pointer to the given byte slice, so it is reported even if
+// empty.
+func ptrTo(blob []byte) *[]byte {
+	return &blob
+}
@@ -0,0 +1,83 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package tracers
+
+import (
+	"encoding/json"
+
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/holiman/uint256"
+)
+
+// ResultTracer is a vm.Tracer assembling its result as JSON, which can be
+// interrupted mid-execution. It is implemented by both the JavaScript and the
+// native tracers.
+type ResultTracer interface {
+	vm.Tracer
+
+	// GetResult returns the result of the tracing, or the error it failed with.
+	GetResult() (json.RawMessage, error)
+
+	// Stop interrupts the tracing with the given error.
+	Stop(err error)
+}
+
+// nativeTracers contains the tracers implemented in Go by name. They produce
+// the same output as the built in JavaScript tracers they are named after and
+// take precedence over them.
+var nativeTracers = map[string]func(txCtx vm.TxContext, config json.RawMessage) (ResultTracer, error){
+	"callTracer":     newCallTracer,
+	"prestateTracer": newPrestateTracer,
+}
+
+// NewTracer creates the tracer with the given name, or the JavaScript tracer
+// defined by the given code. The config is passed on to native tracers, the
+// JavaScript ones have none.
+func NewTracer(code string, txCtx vm.TxContext, config json.RawMessage) (ResultTracer, error) {
+	if constructor, ok := nativeTracers[code]; ok {
+		return constructor(txCtx, config)
+	}
+	return New(code, txCtx)
+}
+
+// memorySlice returns a copy of the memory from begin to end. Like the memory
+// of the JavaScript tracers, out of bound accesses yield nil.
+func memorySlice(memory *vm.Memory, begin, end int64) []byte {
+	if end == begin {
+		return []byte{}
+	}
+	if end < begin || begin < 0 {
+		log.Warn("Tracer accessed out of bound memory", "offset", begin, "end", end)
+		return nil
+	}
+	if int64(memory.Len()) < end {
+		log.Warn("Tracer accessed out of bound memory", "available", memory.Len(), "offset", begin, "size", end-begin)
+		return nil
+	}
+	return memory.GetCopy(begin, end-begin)
+}
+
+// stackPeek returns the n-th item from the top of the stack. Like the stack of
+// the JavaScript tracers, out of bound accesses yield zero.
+func stackPeek(stack *vm.Stack, n int) *uint256.Int {
+	if len(stack.Data()) <= n || n < 0 {
+		log.Warn("Tracer accessed out of bound stack", "size", len(stack.Data()), "index", n)
+		return new(uint256.Int)
+	}
+	return stack.Back(n)
+}
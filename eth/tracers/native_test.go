@@ -0,0 +1,248 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package tracers
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/tests"
+)
+
+// callTracerTests loads all the call tracer test cases by name.
+func callTracerTests(t *testing.T) map[string]*callTracerTest {
+	files, err := ioutil.ReadDir("testdata")
+	if err != nil {
+		t.Fatalf("failed to retrieve tracer test suite: %v", err)
+	}
+	suite := make(map[string]*callTracerTest)
+	for _, file := range files {
+		if !strings.HasPrefix(file.Name(), "call_tracer_") {
+			continue
+		}
+		blob, err := ioutil.ReadFile(filepath.Join("testdata", file.Name()))
+		if err != nil {
+			t.Fatalf("failed to read testcase: %v", err)
+		}
+		test := new(callTracerTest)
+		if err := json.Unmarshal(blob, test); err != nil {
+			t.Fatalf("failed to parse testcase: %v", err)
+		}
+		suite[camel(strings.TrimSuffix(strings.TrimPrefix(file.Name(), "call_tracer_"), ".json"))] = test
+	}
+	return suite
+}
+
+// runTracerTest executes the transaction of a call tracer test case with the
+// given tracer and returns the trace result.
+func runTracerTest(t *testing.T, test *callTracerTest, newTracer func(vm.TxContext) (ResultTracer, error)) json.RawMessage {
+	tx := new(types.Transaction)
+	if err := rlp.DecodeBytes(common.FromHex(test.Input), tx); err != nil {
+		t.Fatalf("failed to parse testcase input: %v", err)
+	}
+	signer := types.MakeSigner(test.Genesis.Config, new(big.Int).SetUint64(uint64(test.Context.Number)))
+	origin, _ := signer.Sender(tx)
+	txContext := vm.TxContext{
+		Origin:   origin,
+		GasPrice: tx.GasPrice(),
+	}
+	context := vm.BlockContext{
+		CanTransfer: core.CanTransfer,
+		Transfer:    core.Transfer,
+		Coinbase:    test.Context.Miner,
+		BlockNumber: new(big.Int).SetUint64(uint64(test.Context.Number)),
+		Time:        new(big.Int).SetUint64(uint64(test.Context.Time)),
+		Difficulty:  (*big.Int)(test.Context.Difficulty),
+		GasLimit:    uint64(test.Context.GasLimit),
+	}
+	_, statedb := tests.MakePreState(rawdb.NewMemoryDatabase(), test.Genesis.Alloc, false)
+
+	tracer, err := newTracer(txContext)
+	if err != nil {
+		t.Fatalf("failed to create tracer: %v", err)
+	}
+	evm := vm.NewEVM(context, txContext, statedb, test.Genesis.Config, vm.Config{Debug: true, Tracer: tracer})
+
+	msg, err := tx.AsMessage(signer)
+	if err != nil {
+		t.Fatalf("failed to prepare transaction for tracing: %v", err)
+	}
+	st := core.NewStateTransition(evm, msg, new(core.GasPool).AddGas(tx.Gas()))
+	if _, err = st.TransitionDb(); err != nil {
+		t.Fatalf("failed to execute transaction: %v", err)
+	}
+	res, err := tracer.GetResult()
+	if err != nil {
+		t.Fatalf("failed to retrieve trace result: %v", err)
+	}
+	return res
+}
+
+// Tests that the native call tracer reports the same calls as the JavaScript
+// one on the call tracer test suite.
+func TestNativeCallTracer(t *testing.T) {
+	for name, test := range callTracerTests(t) {
+		test := test // capture range variable
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			res := runTracerTest(t, test, func(txCtx vm.TxContext) (ResultTracer, error) {
+				return NewTracer("callTracer", txCtx, nil)
+			})
+			ret := new(callTrace)
+			if err := json.Unmarshal(res, ret); err != nil {
+				t.Fatalf("failed to unmarshal trace result: %v", err)
+			}
+			if !jsonEqual(ret, test.Result) {
+				t.Fatalf("trace mismatch: \nhave %+v\nwant %+v", ret, test.Result)
+			}
+			// Beyond the fields checked by the suite, the output must be identical
+			js := runTracerTest(t, test, func(txCtx vm.TxContext) (ResultTracer, error) {
+				return New("callTracer", txCtx)
+			})
+			if !equalResults(t, res, js, "time") {
+				t.Errorf("result mismatch: \nhave %s\nwant %s", res, js)
+			}
+		})
+	}
+}
+
+// Tests that the native prestate tracer reports the same state as the
+// JavaScript one on the call tracer test suite.
+func TestNativePrestateTracer(t *testing.T) {
+	for name, test := range callTracerTests(t) {
+		test := test // capture range variable
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			native := runTracerTest(t, test, func(txCtx vm.TxContext) (ResultTracer, error) {
+				return NewTracer("prestateTracer", txCtx, nil)
+			})
+			js := runTracerTest(t, test, func(txCtx vm.TxContext) (ResultTracer, error) {
+				return New("prestateTracer", txCtx)
+			})
+			if !equalResults(t, native, js) {
+				t.Errorf("result mismatch: \nhave %s\nwant %s", native, js)
+			}
+		})
+	}
+}
+
+// equalResults reports whether two JSON results are equal, disregarding the
+// given top level fields.
+func equalResults(t *testing.T, x, y json.RawMessage, ignore ...string) bool {
+	var xv, yv map[string]interface{}
+	if err := json.Unmarshal(x, &xv); err != nil {
+		t.Fatalf("failed to unmarshal result: %v", err)
+	}
+	if err := json.Unmarshal(y, &yv); err != nil {
+		t.Fatalf("failed to unmarshal result: %v", err)
+	}
+	for _, field := range ignore {
+		delete(xv, field)
+		delete(yv, field)
+	}
+	return reflect.DeepEqual(xv, yv)
+}
+
+// Tests that the prestate tracer in diff mode reports the modified state before
+// and after the transaction.
+func TestPrestateTracerDiffMode(t *testing.T) {
+	var (
+		key, _   = crypto.GenerateKey()
+		origin   = crypto.PubkeyToAddress(key.PublicKey)
+		contract = common.HexToAddress("0x00000000000000000000000000000000deadbeef")
+		reader   = common.HexToAddress("0x00000000000000000000000000000000cafebabe")
+		signer   = types.HomesteadSigner{}
+	)
+	// The contract increments slot 0, reads slot 1 and the balance of another account
+	alloc := core.GenesisAlloc{
+		origin: {Balance: big.NewInt(params.Ether)},
+		contract: {
+			Code:    hexutil.MustDecode("0x6000546001016000556001545073cafebabe3150"),
+			Storage: map[common.Hash]common.Hash{{}: common.BigToHash(big.NewInt(5)), common.BigToHash(common.Big1): common.BigToHash(big.NewInt(7))},
+		},
+		reader: {Balance: big.NewInt(3)},
+	}
+	_, statedb := tests.MakePreState(rawdb.NewMemoryDatabase(), alloc, false)
+
+	tx, _ := types.SignTx(types.NewTransaction(0, contract, big.NewInt(100), 100000, big.NewInt(1), nil), signer, key)
+	txContext := vm.TxContext{Origin: origin, GasPrice: tx.GasPrice()}
+	context := vm.BlockContext{
+		CanTransfer: core.CanTransfer,
+		Transfer:    core.Transfer,
+		BlockNumber: big.NewInt(1),
+		Time:        big.NewInt(1),
+		Difficulty:  big.NewInt(1),
+		GasLimit:    1000000,
+	}
+	tracer, err := NewTracer("prestateTracer", txContext, json.RawMessage(`{"diffMode": true}`))
+	if err != nil {
+		t.Fatalf("failed to create tracer: %v", err)
+	}
+	evm := vm.NewEVM(context, txContext, statedb, params.TestChainConfig, vm.Config{Debug: true, Tracer: tracer})
+	msg, _ := tx.AsMessage(signer)
+	if _, err := core.ApplyMessage(evm, msg, new(core.GasPool).AddGas(tx.Gas())); err != nil {
+		t.Fatalf("failed to execute transaction: %v", err)
+	}
+	res, err := tracer.GetResult()
+	if err != nil {
+		t.Fatalf("failed to retrieve trace result: %v", err)
+	}
+	var diff prestateDiff
+	if err := json.Unmarshal(res, &diff); err != nil {
+		t.Fatalf("failed to unmarshal trace result: %v", err)
+	}
+	// The read-only account is left out, as is the slot only read
+	if len(diff.Pre) != 2 || len(diff.Post) != 2 {
+		t.Fatalf("account count mismatch: have %d pre and %d post, want 2", len(diff.Pre), len(diff.Post))
+	}
+	pre, post := diff.Pre[contract], diff.Post[contract]
+	if pre == nil || post == nil {
+		t.Fatalf("contract missing: have pre %+v, post %+v", pre, post)
+	}
+	if pre.Balance.ToInt().Sign() != 0 || post.Balance.ToInt().Int64() != 100 {
+		t.Errorf("contract balance mismatch: have %v -> %v, want 0 -> 100", pre.Balance, post.Balance)
+	}
+	if post.Nonce != nil || post.Code != nil {
+		t.Errorf("unmodified contract fields reported: nonce %v, code %v", post.Nonce, post.Code)
+	}
+	slot := common.Hash{}
+	if len(pre.Storage) != 1 || pre.Storage[slot] != common.BigToHash(big.NewInt(5)) {
+		t.Errorf("contract pre storage mismatch: have %v", pre.Storage)
+	}
+	if len(post.Storage) != 1 || post.Storage[slot] != common.BigToHash(big.NewInt(6)) {
+		t.Errorf("contract post storage mismatch: have %v", post.Storage)
+	}
+	if pre, post := diff.Pre[origin], diff.Post[origin]; pre == nil || post == nil || *pre.Nonce != 0 || *post.Nonce != 1 {
+		t.Errorf("sender nonce mismatch: have pre %+v, post %+v", pre, post)
+	}
+}
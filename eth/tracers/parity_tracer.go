@@ -0,0 +1,337 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package tracers
+
+import (
+	"math/big"
+	"sync/atomic"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/vm"
+)
+
+// parityFrame is a call frame, or a self destruct, recorded by the parity
+// tracer.
+type parityFrame struct {
+	typ     vm.OpCode
+	from    common.Address
+	to      common.Address // Callee, created contract or self destruct beneficiary
+	input   []byte
+	gas     uint64
+	value   *big.Int
+	gasUsed uint64
+	output  []byte
+	err     error
+	calls   []*parityFrame
+}
+
+// vmTrace is the trace of the instructions executed in a call frame, in the
+// format of the Parity vmTrace.
+type vmTrace struct {
+	Code hexutil.Bytes  `json:"code"`
+	Ops  []*vmOperation `json:"ops"`
+}
+
+// vmOperation is an instruction of a vmTrace, along with the call frame it
+// entered, if any.
+type vmOperation struct {
+	Cost uint64      `json:"cost"`
+	Ex   *vmExecuted `json:"ex"`
+	PC   uint64      `json:"pc"`
+	Sub  *vmTrace    `json:"sub"`
+}
+
+// vmExecuted is the outcome of an instruction of a vmTrace: the gas left, the
+// stack items pushed, and the memory or storage written.
+type vmExecuted struct {
+	Mem   *vmMemoryDiff  `json:"mem"`
+	Push  []*hexutil.Big `json:"push"`
+	Store *vmStorageDiff `json:"store"`
+	Used  uint64         `json:"used"`
+}
+
+// vmMemoryDiff is the memory written by an instruction.
+type vmMemoryDiff struct {
+	Data hexutil.Bytes `json:"data"`
+	Off  int64         `json:"off"`
+}
+
+// vmStorageDiff is the storage slot written by an instruction.
+type vmStorageDiff struct {
+	Key *hexutil.Big `json:"key"`
+	Val *hexutil.Big `json:"val"`
+}
+
+// vmFrame is a call frame being traced instruction by instruction. The outcome
+// of an instruction is only known at the next one, so it is left pending.
+type vmFrame struct {
+	trace   *vmTrace
+	pending *vmOperation   // Last instruction executed, its outcome unknown yet
+	pushes  int            // Number of stack items reported for the pending instruction
+	memOff  int64          // Offset of the memory written by the pending instruction
+	memLen  int64          // Length of the memory written by the pending instruction
+	store   *vmStorageDiff // Storage slot written by the pending instruction
+}
+
+// parityTracer is a vm.FrameTracer recording what the Parity style trace APIs
+// report about a transaction: its call frames, optionally the instructions it
+// executed, and the accounts and storage slots it may have modified.
+type parityTracer struct {
+	start  *parityFrame   // Transaction as started, in case no frame is entered
+	root   *parityFrame   // Outermost call frame
+	frames []*parityFrame // Call frames being executed, innermost last
+
+	vmTrace  bool       // Whether to trace the executed instructions
+	vmRoot   *vmTrace   // Instructions executed in the outermost call frame
+	vmFrames []*vmFrame // Call frames being traced, innermost last
+
+	touched map[common.Address]map[common.Hash]struct{} // Accounts and storage slots possibly modified
+
+	interrupt uint32 // Atomic flag to signal execution interruption
+	reason    error  // Textual reason for the interruption
+}
+
+// newParityTracer creates a parity tracer, tracing the executed instructions
+// too if vmTrace is set.
+func newParityTracer(vmTrace bool) *parityTracer {
+	return &parityTracer{
+		vmTrace: vmTrace,
+		touched: make(map[common.Address]map[common.Hash]struct{}),
+	}
+}
+
+// touch records an account, and if given a storage slot of it, as possibly
+// modified.
+func (t *parityTracer) touch(addr common.Address, keys ...common.Hash) {
+	slots := t.touched[addr]
+	if slots == nil {
+		slots = make(map[common.Hash]struct{})
+		t.touched[addr] = slots
+	}
+	for _, key := range keys {
+		slots[key] = struct{}{}
+	}
+}
+
+// CaptureStart implements vm.Tracer, recording the transaction in case it
+// enters no frame, like a call to an account which doesn't exist.
+func (t *parityTracer) CaptureStart(from common.Address, to common.Address, create bool, input []byte, gas uint64, value *big.Int) error {
+	t.start = &parityFrame{typ: vm.CALL, from: from, to: to, input: common.CopyBytes(input), gas: gas, value: value}
+	if create {
+		t.start.typ = vm.CREATE
+	}
+	return nil
+}
+
+// CaptureEnter implements vm.FrameTracer, opening a call frame.
+func (t *parityTracer) CaptureEnter(typ vm.OpCode, from common.Address, to common.Address, input []byte, gas uint64, value *big.Int) {
+	frame := &parityFrame{typ: typ, from: from, to: to, input: common.CopyBytes(input), gas: gas}
+	switch {
+	case value != nil:
+		frame.value = new(big.Int).Set(value)
+	case typ == vm.DELEGATECALL && len(t.frames) > 0:
+		// Delegate calls execute with the value of their caller
+		frame.value = t.frames[len(t.frames)-1].value
+	default:
+		frame.value = new(big.Int)
+	}
+	if len(t.frames) == 0 {
+		t.root = frame
+	} else {
+		parent := t.frames[len(t.frames)-1]
+		parent.calls = append(parent.calls, frame)
+	}
+	t.frames = append(t.frames, frame)
+	t.touch(from)
+	t.touch(to)
+
+	if t.vmTrace {
+		trace := &vmTrace{Ops: []*vmOperation{}}
+		if len(t.vmFrames) == 0 {
+			t.vmRoot = trace
+		} else if parent := t.vmFrames[len(t.vmFrames)-1]; parent.pending != nil {
+			parent.pending.Sub = trace
+		}
+		t.vmFrames = append(t.vmFrames, &vmFrame{trace: trace})
+	}
+}
+
+// CaptureExit implements vm.FrameTracer, closing the innermost call frame.
+func (t *parityTracer) CaptureExit(output []byte, gasLeft uint64, err error) {
+	frame := t.frames[len(t.frames)-1]
+	t.frames = t.frames[:len(t.frames)-1]
+
+	frame.gasUsed, frame.output, frame.err = frame.gas-gasLeft, common.CopyBytes(output), err
+
+	if t.vmTrace {
+		vmframe := t.vmFrames[len(t.vmFrames)-1]
+		t.vmFrames = t.vmFrames[:len(t.vmFrames)-1]
+
+		// The last instruction halted the frame, so it has no visible effects
+		if vmframe.pending != nil {
+			vmframe.pending.Ex = &vmExecuted{Push: []*hexutil.Big{}, Store: vmframe.store, Used: gasLeft}
+		}
+	}
+}
+
+// CaptureState implements vm.Tracer, recording the self destructs, the storage
+// slots written and if enabled, the executed instructions.
+func (t *parityTracer) CaptureState(env *vm.EVM, pc uint64, op vm.OpCode, gas, cost uint64, memory *vm.Memory, stack *vm.Stack, rStack *vm.ReturnStack, rData []byte, contract *vm.Contract, depth int, err error) error {
+	if atomic.LoadUint32(&t.interrupt) > 0 {
+		env.Cancel()
+		return nil
+	}
+	// The instruction failed before executing, it has no outcome
+	if err != nil {
+		if t.vmTrace {
+			t.traceOp(pc, op, gas, cost, memory, stack, contract)
+			t.vmFrames[len(t.vmFrames)-1].pending = nil
+		}
+		return nil
+	}
+	switch op {
+	case vm.SSTORE:
+		t.touch(contract.Address(), stackPeek(stack, 0).Bytes32())
+
+	case vm.SELFDESTRUCT:
+		beneficiary := common.Address(stackPeek(stack, 0).Bytes20())
+		frame := t.frames[len(t.frames)-1]
+		frame.calls = append(frame.calls, &parityFrame{
+			typ:   op,
+			from:  contract.Address(),
+			to:    beneficiary,
+			value: new(big.Int).Set(env.StateDB.GetBalance(contract.Address())),
+		})
+		t.touch(beneficiary)
+	}
+	if t.vmTrace {
+		t.traceOp(pc, op, gas, cost, memory, stack, contract)
+	}
+	return nil
+}
+
+// traceOp completes the instruction executed before in the current frame and
+// starts tracing the given one.
+func (t *parityTracer) traceOp(pc uint64, op vm.OpCode, gas, cost uint64, memory *vm.Memory, stack *vm.Stack, contract *vm.Contract) {
+	frame := t.vmFrames[len(t.vmFrames)-1]
+	if len(frame.trace.Ops) == 0 {
+		frame.trace.Code = common.CopyBytes(contract.Code)
+	}
+	if frame.pending != nil {
+		ex := &vmExecuted{Push: make([]*hexutil.Big, 0, frame.pushes), Used: gas}
+		for i := frame.pushes - 1; i >= 0; i-- {
+			ex.Push = append(ex.Push, (*hexutil.Big)(stackPeek(stack, i).ToBig()))
+		}
+		if frame.memLen > 0 {
+			if data := memorySlice(memory, frame.memOff, frame.memOff+frame.memLen); data != nil {
+				ex.Mem = &vmMemoryDiff{Data: data, Off: frame.memOff}
+			}
+		}
+		ex.Store = frame.store
+		frame.pending.Ex = ex
+	}
+	// Note what the instruction is about to do, to report it once done
+	operation := &vmOperation{Cost: cost, PC: pc}
+	frame.trace.Ops = append(frame.trace.Ops, operation)
+	frame.pending, frame.pushes = operation, stackPushes(op)
+	frame.memOff, frame.memLen, frame.store = 0, 0, nil
+
+	memRange := func(off, size int) {
+		frame.memOff, frame.memLen = int64(stackPeek(stack, off).Uint64()), int64(stackPeek(stack, size).Uint64())
+	}
+	switch op {
+	case vm.MSTORE:
+		frame.memOff, frame.memLen = int64(stackPeek(stack, 0).Uint64()), 32
+	case vm.MSTORE8:
+		frame.memOff, frame.memLen = int64(stackPeek(stack, 0).Uint64()), 1
+	case vm.CALLDATACOPY, vm.CODECOPY, vm.RETURNDATACOPY:
+		memRange(0, 2)
+	case vm.EXTCODECOPY:
+		memRange(1, 3)
+	case vm.CALL, vm.CALLCODE:
+		memRange(5, 6)
+	case vm.DELEGATECALL, vm.STATICCALL:
+		memRange(4, 5)
+	case vm.SSTORE:
+		frame.store = &vmStorageDiff{
+			Key: (*hexutil.Big)(stackPeek(stack, 0).ToBig()),
+			Val: (*hexutil.Big)(stackPeek(stack, 1).ToBig()),
+		}
+	}
+}
+
+// stackPushes returns the number of stack items reported as pushed by an
+// instruction. Like Parity, duplications and swaps report all the items they
+// involve.
+func stackPushes(op vm.OpCode) int {
+	switch {
+	case op >= vm.DUP1 && op <= vm.DUP16:
+		return int(op-vm.DUP1) + 2
+	case op >= vm.SWAP1 && op <= vm.SWAP16:
+		return int(op-vm.SWAP1) + 2
+	}
+	switch op {
+	case vm.STOP, vm.POP, vm.MSTORE, vm.MSTORE8, vm.SSTORE, vm.JUMP, vm.JUMPI, vm.JUMPDEST,
+		vm.LOG0, vm.LOG1, vm.LOG2, vm.LOG3, vm.LOG4, vm.RETURN, vm.REVERT, vm.SELFDESTRUCT,
+		vm.CALLDATACOPY, vm.CODECOPY, vm.EXTCODECOPY, vm.RETURNDATACOPY,
+		vm.BEGINSUB, vm.JUMPSUB, vm.RETURNSUB:
+		return 0
+	}
+	return 1
+}
+
+// CaptureFault implements vm.Tracer, dropping the outcome of the instruction
+// which failed.
+func (t *parityTracer) CaptureFault(env *vm.EVM, pc uint64, op vm.OpCode, gas, cost uint64, memory *vm.Memory, stack *vm.Stack, rStack *vm.ReturnStack, contract *vm.Contract, depth int, err error) error {
+	if t.vmTrace && len(t.vmFrames) > 0 {
+		t.vmFrames[len(t.vmFrames)-1].pending = nil
+	}
+	return nil
+}
+
+// CaptureEnd implements vm.Tracer, completing the transaction if it entered no
+// frame.
+func (t *parityTracer) CaptureEnd(output []byte, gasUsed uint64, elapsed time.Duration, err error) error {
+	if t.start != nil {
+		t.start.gasUsed, t.start.output, t.start.err = gasUsed, common.CopyBytes(output), err
+	}
+	return nil
+}
+
+// rootFrame returns the outermost call frame of the transaction.
+func (t *parityTracer) rootFrame() *parityFrame {
+	if t.root != nil {
+		return t.root
+	}
+	return t.start
+}
+
+// rootVMTrace returns the instructions executed by the transaction.
+func (t *parityTracer) rootVMTrace() *vmTrace {
+	if t.vmRoot != nil {
+		return t.vmRoot
+	}
+	return &vmTrace{Ops: []*vmOperation{}}
+}
+
+// Stop aborts the execution of the transaction.
+func (t *parityTracer) Stop(err error) {
+	t.reason = err
+	atomic.StoreUint32(&t.interrupt, 1)
+}
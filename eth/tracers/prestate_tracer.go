@@ -0,0 +1,311 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package tracers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync/atomic"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// prestateAccount is an account reported by the prestate tracer.
+type prestateAccount struct {
+	Balance *hexutil.Big                `json:"balance"`
+	Nonce   uint64                      `json:"nonce"`
+	Code    hexutil.Bytes               `json:"code"`
+	Storage map[common.Hash]common.Hash `json:"storage"`
+}
+
+// diffAccount is an account reported by the prestate tracer in diff mode, with
+// the fields left unmodified by the transaction omitted.
+type diffAccount struct {
+	Balance *hexutil.Big                `json:"balance,omitempty"`
+	Nonce   *uint64                     `json:"nonce,omitempty"`
+	Code    *hexutil.Bytes              `json:"code,omitempty"`
+	Storage map[common.Hash]common.Hash `json:"storage,omitempty"`
+}
+
+// prestateTracerConfig is the configuration of the prestate tracer.
+type prestateTracerConfig struct {
+	// DiffMode reports the state before and after the transaction, restricted
+	// to the accounts, fields and storage slots it modified.
+	DiffMode bool `json:"diffMode"`
+}
+
+// prestateDiff is the result of the prestate tracer in diff mode.
+type prestateDiff struct {
+	Pre  map[common.Address]*diffAccount `json:"pre"`
+	Post map[common.Address]*diffAccount `json:"post"`
+}
+
+// prestateTracer is the native implementation of the prestateTracer JavaScript
+// tracer, reporting the state accessed by a transaction as it was before, which
+// is sufficient to execute the transaction locally from a custom genesis.
+type prestateTracer struct {
+	config   prestateTracerConfig
+	db       vm.StateDB                                  // State the transaction executes on
+	prestate map[common.Address]*prestateAccount         // Accounts accessed, as they were before the transaction
+	created  map[common.Address]struct{}                 // Contracts created by the transaction
+	keys     map[common.Address]map[common.Hash]struct{} // Storage slots accessed, to diff the post-state
+
+	// Transaction level details, to undo the effects of the transaction not
+	// present in the prestate yet when the accounts are first looked up
+	create       bool
+	from         common.Address
+	to           common.Address
+	input        []byte
+	value        *big.Int
+	gasUsed      uint64
+	gasPrice     *big.Int
+	intrinsicGas uint64
+
+	interrupt uint32 // Atomic flag to signal execution interruption
+	reason    error  // Textual reason for the interruption
+}
+
+// newPrestateTracer creates a native prestate tracer, reporting the state
+// before the transaction, or with diffMode set, the state it modified before
+// and after.
+func newPrestateTracer(txCtx vm.TxContext, config json.RawMessage) (ResultTracer, error) {
+	t := &prestateTracer{gasPrice: txCtx.GasPrice}
+	if len(config) > 0 {
+		if err := json.Unmarshal(config, &t.config); err != nil {
+			return nil, fmt.Errorf("invalid prestate tracer config: %v", err)
+		}
+	}
+	return t, nil
+}
+
+// CaptureStart implements vm.Tracer, recording the transaction.
+func (t *prestateTracer) CaptureStart(from common.Address, to common.Address, create bool, input []byte, gas uint64, value *big.Int) error {
+	t.create, t.from, t.to, t.input, t.value = create, from, to, common.CopyBytes(input), value
+	return nil
+}
+
+// CaptureState implements vm.Tracer, looking up any state about to be accessed
+// for the first time.
+func (t *prestateTracer) CaptureState(env *vm.EVM, pc uint64, op vm.OpCode, gas, cost uint64, memory *vm.Memory, stack *vm.Stack, rStack *vm.ReturnStack, rData []byte, contract *vm.Contract, depth int, err error) error {
+	if atomic.LoadUint32(&t.interrupt) > 0 {
+		env.Cancel()
+		return nil
+	}
+	// Add the current account if we just started tracing. Its balance may
+	// already include the value sent along, which is fixed in GetResult.
+	if t.prestate == nil {
+		rules := env.ChainConfig()
+		intrinsicGas, err := core.IntrinsicGas(t.input, t.create, rules.IsHomestead(env.Context.BlockNumber), rules.IsIstanbul(env.Context.BlockNumber))
+		if err != nil {
+			return err
+		}
+		t.db, t.intrinsicGas = env.StateDB, intrinsicGas
+		t.prestate = make(map[common.Address]*prestateAccount)
+		t.created = make(map[common.Address]struct{})
+		t.keys = make(map[common.Address]map[common.Hash]struct{})
+
+		t.lookupAccount(contract.Address())
+	}
+	// Whenever new state is accessed, add it to the prestate
+	switch op {
+	case vm.EXTCODECOPY, vm.EXTCODESIZE, vm.BALANCE:
+		t.lookupAccount(common.Address(stackPeek(stack, 0).Bytes20()))
+
+	case vm.CREATE:
+		from := contract.Address()
+		created := crypto.CreateAddress(from, env.StateDB.GetNonce(from))
+		t.lookupAccount(created)
+		t.created[created] = struct{}{}
+
+	case vm.CREATE2:
+		// stack: salt, size, offset, endowment
+		offset, size := int64(stackPeek(stack, 1).Uint64()), int64(stackPeek(stack, 2).Uint64())
+		codeHash := crypto.Keccak256(memorySlice(memory, offset, offset+size))
+		created := crypto.CreateAddress2(contract.Address(), stackPeek(stack, 3).Bytes32(), codeHash)
+		t.lookupAccount(created)
+		t.created[created] = struct{}{}
+
+	case vm.CALL, vm.CALLCODE, vm.DELEGATECALL, vm.STATICCALL:
+		t.lookupAccount(common.Address(stackPeek(stack, 1).Bytes20()))
+
+	case vm.SSTORE, vm.SLOAD:
+		t.lookupStorage(contract.Address(), stackPeek(stack, 0).Bytes32())
+	}
+	return nil
+}
+
+// lookupAccount adds the given account to the prestate, unless already there.
+func (t *prestateTracer) lookupAccount(addr common.Address) {
+	if _, ok := t.prestate[addr]; ok {
+		return
+	}
+	t.prestate[addr] = &prestateAccount{
+		Balance: (*hexutil.Big)(new(big.Int).Set(t.db.GetBalance(addr))),
+		Nonce:   t.db.GetNonce(addr),
+		Code:    common.CopyBytes(t.db.GetCode(addr)),
+		Storage: make(map[common.Hash]common.Hash),
+	}
+}
+
+// lookupStorage adds the given storage slot of an account already in the
+// prestate to it, unless already there.
+func (t *prestateTracer) lookupStorage(addr common.Address, key common.Hash) {
+	storage := t.prestate[addr].Storage
+	if _, ok := storage[key]; ok {
+		return
+	}
+	storage[key] = t.db.GetState(addr, key)
+
+	if t.keys[addr] == nil {
+		t.keys[addr] = make(map[common.Hash]struct{})
+	}
+	t.keys[addr][key] = struct{}{}
+}
+
+// CaptureFault implements vm.Tracer.
+func (t *prestateTracer) CaptureFault(env *vm.EVM, pc uint64, op vm.OpCode, gas, cost uint64, memory *vm.Memory, stack *vm.Stack, rStack *vm.ReturnStack, contract *vm.Contract, depth int, err error) error {
+	return nil
+}
+
+// CaptureEnd implements vm.Tracer, recording the gas used by the transaction.
+func (t *prestateTracer) CaptureEnd(output []byte, gasUsed uint64, elapsed time.Duration, err error) error {
+	t.gasUsed = gasUsed
+	return nil
+}
+
+// GetResult implements ResultTracer, returning the prestate, or in diff mode
+// the modified state before and after the transaction.
+func (t *prestateTracer) GetResult() (json.RawMessage, error) {
+	if atomic.LoadUint32(&t.interrupt) > 0 {
+		return nil, t.reason
+	}
+	if t.prestate == nil {
+		// The state is only reachable while code executes
+		return nil, errors.New("prestate of transactions executing no code is unavailable")
+	}
+	// At this point, the value needs to be deducted from the outer transaction
+	// and moved back to the origin, along with the gas fee
+	t.lookupAccount(t.from)
+	t.lookupAccount(t.to)
+	value := t.value
+	if value == nil {
+		value = new(big.Int)
+	}
+	to, from := t.prestate[t.to], t.prestate[t.from]
+
+	toBal := new(big.Int).Sub(to.Balance.ToInt(), value)
+	to.Balance = (*hexutil.Big)(toBal)
+
+	fee := new(big.Int).Mul(new(big.Int).SetUint64(t.gasUsed+t.intrinsicGas), t.gasPrice)
+	fromBal := new(big.Int).Add(from.Balance.ToInt(), value)
+	from.Balance = (*hexutil.Big)(fromBal.Add(fromBal, fee))
+
+	// Decrement the caller's nonce, and remove empty create targets. Any
+	// existing state would have made the transaction invalid in the first place.
+	from.Nonce--
+	if t.create {
+		delete(t.prestate, t.to)
+		t.created[t.to] = struct{}{}
+	}
+	if !t.config.DiffMode {
+		return json.Marshal(t.prestate)
+	}
+	return json.Marshal(t.diff())
+}
+
+// diff restricts the prestate to the modified state, and assembles the state
+// after the transaction for the same accounts, fields and storage slots.
+// Contracts created by the transaction only appear in the post-state, and self
+// destructed ones only in the pre-state.
+func (t *prestateTracer) diff() *prestateDiff {
+	diff := &prestateDiff{
+		Pre:  make(map[common.Address]*diffAccount),
+		Post: make(map[common.Address]*diffAccount),
+	}
+	for addr := range t.created {
+		if _, ok := t.prestate[addr]; !ok && !t.db.HasSuicided(addr) && t.db.Exist(addr) {
+			diff.Post[addr] = t.postAccount(addr, nil)
+		}
+	}
+	for addr, pre := range t.prestate {
+		nonce := pre.Nonce
+		modified := &diffAccount{Balance: pre.Balance, Nonce: &nonce, Code: &pre.Code}
+		if t.db.HasSuicided(addr) {
+			modified.Storage = pre.Storage
+			diff.Pre[addr] = modified
+			continue
+		}
+		post := t.postAccount(addr, pre)
+		if post.Balance == nil && post.Nonce == nil && post.Code == nil && len(post.Storage) == 0 {
+			continue
+		}
+		// Only report the modified storage slots in the pre-state too
+		for key := range post.Storage {
+			if modified.Storage == nil {
+				modified.Storage = make(map[common.Hash]common.Hash)
+			}
+			modified.Storage[key] = pre.Storage[key]
+		}
+		diff.Pre[addr], diff.Post[addr] = modified, post
+	}
+	return diff
+}
+
+// postAccount returns the fields of the given account which differ from the
+// given prestate, or all of them if there is none.
+func (t *prestateTracer) postAccount(addr common.Address, pre *prestateAccount) *diffAccount {
+	var (
+		post    = new(diffAccount)
+		balance = t.db.GetBalance(addr)
+		nonce   = t.db.GetNonce(addr)
+		code    = t.db.GetCode(addr)
+	)
+	if pre == nil || pre.Balance.ToInt().Cmp(balance) != 0 {
+		post.Balance = (*hexutil.Big)(new(big.Int).Set(balance))
+	}
+	if pre == nil || pre.Nonce != nonce {
+		post.Nonce = &nonce
+	}
+	if pre == nil || !bytes.Equal(pre.Code, code) {
+		post.Code = (*hexutil.Bytes)(ptrTo(common.CopyBytes(code)))
+	}
+	for key := range t.keys[addr] {
+		value := t.db.GetState(addr, key)
+		if pre != nil && pre.Storage[key] == value {
+			continue
+		}
+		if post.Storage == nil {
+			post.Storage = make(map[common.Hash]common.Hash)
+		}
+		post.Storage[key] = value
+	}
+	return post
+}
+
+// Stop implements ResultTracer, aborting the execution of the transaction.
+func (t *prestateTracer) Stop(err error) {
+	t.reason = err
+	atomic.StoreUint32(&t.interrupt, 1)
+}
@@ -0,0 +1,621 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package tracers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/internal/ethapi"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// TraceAPI is the collection of Parity style tracing APIs, exposed in the trace
+// namespace so that tooling written against Parity and OpenEthereum works as is.
+// Unlike Parity, no traces are reported for the block and uncle rewards.
+type TraceAPI struct {
+	api *API
+}
+
+// NewTraceAPI creates a new API definition for the Parity style tracing methods
+// of the Ethereum service.
+func NewTraceAPI(backend Backend) *TraceAPI {
+	return &TraceAPI{api: NewAPI(backend)}
+}
+
+// flatTrace is a call frame or a self destruct, in the format of the Parity
+// traces. The frames of a transaction are listed depth first, each addressed
+// by the indices of the frames leading to it.
+type flatTrace struct {
+	Action              interface{}  `json:"action"`
+	BlockHash           *common.Hash `json:"blockHash,omitempty"`
+	BlockNumber         *uint64      `json:"blockNumber,omitempty"`
+	Error               string       `json:"error,omitempty"`
+	Result              interface{}  `json:"result,omitempty"`
+	Subtraces           int          `json:"subtraces"`
+	TraceAddress        []int        `json:"traceAddress"`
+	TransactionHash     *common.Hash `json:"transactionHash,omitempty"`
+	TransactionPosition *uint64      `json:"transactionPosition,omitempty"`
+	Type                string       `json:"type"`
+
+	from common.Address // Sender, creator or self destructed contract, for filtering
+	to   common.Address // Callee, created contract or beneficiary, for filtering
+}
+
+// callAction is the action of a call trace.
+type callAction struct {
+	CallType string         `json:"callType"`
+	From     common.Address `json:"from"`
+	Gas      hexutil.Uint64 `json:"gas"`
+	Input    hexutil.Bytes  `json:"input"`
+	To       common.Address `json:"to"`
+	Value    *hexutil.Big   `json:"value"`
+}
+
+// callResult is the result of a successful call trace.
+type callResult struct {
+	GasUsed hexutil.Uint64 `json:"gasUsed"`
+	Output  hexutil.Bytes  `json:"output"`
+}
+
+// createAction is the action of a create trace.
+type createAction struct {
+	From  common.Address `json:"from"`
+	Gas   hexutil.Uint64 `json:"gas"`
+	Init  hexutil.Bytes  `json:"init"`
+	Value *hexutil.Big   `json:"value"`
+}
+
+// createResult is the result of a successful create trace.
+type createResult struct {
+	Address common.Address `json:"address"`
+	Code    hexutil.Bytes  `json:"code"`
+	GasUsed hexutil.Uint64 `json:"gasUsed"`
+}
+
+// suicideAction is the action of a self destruct trace.
+type suicideAction struct {
+	Address       common.Address `json:"address"`
+	Balance       *hexutil.Big   `json:"balance"`
+	RefundAddress common.Address `json:"refundAddress"`
+}
+
+// traceResults is the outcome of replaying a transaction, with the traces of
+// the requested types only.
+type traceResults struct {
+	Output    hexutil.Bytes `json:"output"`
+	StateDiff stateDiff     `json:"stateDiff"`
+	Trace     []*flatTrace  `json:"trace"`
+	VMTrace   *vmTrace      `json:"vmTrace"`
+}
+
+// stateDiff is the state modified by a transaction, in the format of the Parity
+// stateDiff.
+type stateDiff map[common.Address]*accountDiff
+
+// accountDiff is an account modified by a transaction. Only the storage slots
+// modified are reported.
+type accountDiff struct {
+	Balance *diffField                 `json:"balance"`
+	Code    *diffField                 `json:"code"`
+	Nonce   *diffField                 `json:"nonce"`
+	Storage map[common.Hash]*diffField `json:"storage"`
+}
+
+// diffField is the change of an account field or storage slot, encoded as "="
+// if unchanged, {"+": to} if created, {"-": from} if deleted and otherwise as
+// {"*": {"from": from, "to": to}}.
+type diffField struct {
+	marker   string
+	from, to interface{}
+}
+
+// newDiffField creates the change of a field of an account which was either
+// born, died, or modified by a transaction.
+func newDiffField(born, died, same bool, from, to interface{}) *diffField {
+	switch {
+	case born:
+		return &diffField{marker: "+", to: to}
+	case died:
+		return &diffField{marker: "-", from: from}
+	case same:
+		return &diffField{marker: "="}
+	}
+	return &diffField{marker: "*", from: from, to: to}
+}
+
+// MarshalJSON implements json.Marshaler.
+func (f *diffField) MarshalJSON() ([]byte, error) {
+	switch f.marker {
+	case "=":
+		return json.Marshal(f.marker)
+	case "+":
+		return json.Marshal(map[string]interface{}{f.marker: f.to})
+	case "-":
+		return json.Marshal(map[string]interface{}{f.marker: f.from})
+	}
+	return json.Marshal(map[string]interface{}{f.marker: map[string]interface{}{"from": f.from, "to": f.to}})
+}
+
+// traceFilterArgs are the criteria of trace_filter. Traces match if both their
+// sender and recipient are among the given ones, any if none are.
+type traceFilterArgs struct {
+	FromBlock   *rpc.BlockNumber `json:"fromBlock"`
+	ToBlock     *rpc.BlockNumber `json:"toBlock"`
+	FromAddress []common.Address `json:"fromAddress"`
+	ToAddress   []common.Address `json:"toAddress"`
+	After       *uint64          `json:"after"` // Number of matching traces to skip
+	Count       *uint64          `json:"count"` // Maximum number of matching traces to return
+}
+
+// matches reports whether the given trace matches the address criteria.
+func (args *traceFilterArgs) matches(trace *flatTrace) bool {
+	contains := func(addrs []common.Address, addr common.Address) bool {
+		if len(addrs) == 0 {
+			return true
+		}
+		for _, a := range addrs {
+			if a == addr {
+				return true
+			}
+		}
+		return false
+	}
+	return contains(args.FromAddress, trace.from) && contains(args.ToAddress, trace.to)
+}
+
+// Block returns the traces of all the transactions of a block.
+func (api *TraceAPI) Block(ctx context.Context, number rpc.BlockNumber) ([]*flatTrace, error) {
+	block, err := api.api.blockByNumber(ctx, number)
+	if err != nil {
+		return nil, err
+	}
+	return api.traceBlock(ctx, block)
+}
+
+// Transaction returns the traces of a transaction.
+func (api *TraceAPI) Transaction(ctx context.Context, hash common.Hash) ([]*flatTrace, error) {
+	_, blockHash, blockNumber, index, err := api.api.backend.GetTransaction(ctx, hash)
+	if err != nil {
+		return nil, err
+	}
+	// It shouldn't happen in practice.
+	if blockNumber == 0 {
+		return nil, errors.New("genesis is not traceable")
+	}
+	block, err := api.api.blockByNumberAndHash(ctx, rpc.BlockNumber(blockNumber), blockHash)
+	if err != nil {
+		return nil, err
+	}
+	msg, vmctx, statedb, release, err := api.api.backend.StateAtTransaction(ctx, block, int(index), defaultTraceReexec)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	tracer, _, err := api.traceTx(ctx, msg, vmctx, statedb, false)
+	if err != nil {
+		return nil, err
+	}
+	return flattenTraces(tracer.rootFrame(), block, hash, index), nil
+}
+
+// Filter returns the traces of the transactions in a block range, restricted to
+// those matching the given addresses.
+func (api *TraceAPI) Filter(ctx context.Context, args traceFilterArgs) ([]*flatTrace, error) {
+	from, to := rpc.LatestBlockNumber, rpc.LatestBlockNumber
+	if args.FromBlock != nil {
+		from = *args.FromBlock
+	}
+	if args.ToBlock != nil {
+		to = *args.ToBlock
+	}
+	start, err := api.api.blockByNumber(ctx, from)
+	if err != nil {
+		return nil, err
+	}
+	end, err := api.api.blockByNumber(ctx, to)
+	if err != nil {
+		return nil, err
+	}
+	if start.NumberU64() > end.NumberU64() {
+		return nil, fmt.Errorf("invalid block range: #%d > #%d", start.NumberU64(), end.NumberU64())
+	}
+	if limit := api.api.backend.RPCTraceFilterRange(); limit != 0 && end.NumberU64()-start.NumberU64() >= limit {
+		return nil, fmt.Errorf("block range too large: %d blocks, maximum %d", end.NumberU64()-start.NumberU64()+1, limit)
+	}
+	results := []*flatTrace{}
+
+	// The genesis has no transactions to trace
+	if start.NumberU64() == 0 {
+		if end.NumberU64() == 0 {
+			return results, nil
+		}
+		if start, err = api.api.blockByNumber(ctx, 1); err != nil {
+			return nil, err
+		}
+	}
+	// Regenerate the states the blocks of the range are executed on in one go,
+	// instead of reexecuting the chain up to the parent of every block.
+	parent, err := api.api.blockByNumberAndHash(ctx, rpc.BlockNumber(start.NumberU64()-1), start.ParentHash())
+	if err != nil {
+		return nil, err
+	}
+	last, err := api.api.blockByNumberAndHash(ctx, rpc.BlockNumber(end.NumberU64()-1), end.ParentHash())
+	if err != nil {
+		return nil, err
+	}
+	states, release, err := api.api.backend.StatesInRange(ctx, parent, last, defaultTraceReexec)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	var skipped uint64
+	for number := start.NumberU64(); number <= end.NumberU64(); number++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		block := start
+		if number != start.NumberU64() {
+			if block, err = api.api.blockByNumber(ctx, rpc.BlockNumber(number)); err != nil {
+				return nil, err
+			}
+		}
+		traces, err := api.traceBlockWithState(ctx, block, states[number-start.NumberU64()])
+		if err != nil {
+			return nil, err
+		}
+		for _, trace := range traces {
+			if !args.matches(trace) {
+				continue
+			}
+			if args.After != nil && skipped < *args.After {
+				skipped++
+				continue
+			}
+			results = append(results, trace)
+			if args.Count != nil && uint64(len(results)) >= *args.Count {
+				return results, nil
+			}
+		}
+	}
+	return results, nil
+}
+
+// ReplayTransaction replays a transaction, returning the traces of the given
+// types: trace, vmTrace and stateDiff.
+func (api *TraceAPI) ReplayTransaction(ctx context.Context, hash common.Hash, traceTypes []string) (*traceResults, error) {
+	_, blockHash, blockNumber, index, err := api.api.backend.GetTransaction(ctx, hash)
+	if err != nil {
+		return nil, err
+	}
+	// It shouldn't happen in practice.
+	if blockNumber == 0 {
+		return nil, errors.New("genesis is not traceable")
+	}
+	block, err := api.api.blockByNumberAndHash(ctx, rpc.BlockNumber(blockNumber), blockHash)
+	if err != nil {
+		return nil, err
+	}
+	msg, vmctx, statedb, release, err := api.api.backend.StateAtTransaction(ctx, block, int(index), defaultTraceReexec)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	return api.replay(ctx, msg, vmctx, statedb, traceTypes)
+}
+
+// Call executes a call on top of the given block, the latest one by default,
+// returning the traces of the given types: trace, vmTrace and stateDiff.
+func (api *TraceAPI) Call(ctx context.Context, args ethapi.CallArgs, traceTypes []string, blockNrOrHash *rpc.BlockNumberOrHash) (*traceResults, error) {
+	if blockNrOrHash == nil {
+		latest := rpc.BlockNumberOrHashWithNumber(rpc.LatestBlockNumber)
+		blockNrOrHash = &latest
+	}
+	var (
+		err   error
+		block *types.Block
+	)
+	if hash, ok := blockNrOrHash.Hash(); ok {
+		block, err = api.api.blockByHash(ctx, hash)
+	} else if number, ok := blockNrOrHash.Number(); ok {
+		block, err = api.api.blockByNumber(ctx, number)
+	}
+	if err != nil {
+		return nil, err
+	}
+	statedb, release, err := api.api.backend.StateAtBlock(ctx, block, defaultTraceReexec)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	msg := args.ToMessage(api.api.backend.RPCGasCap())
+	vmctx := core.NewEVMBlockContext(block.Header(), api.api.chainContext(ctx), nil)
+	return api.replay(ctx, msg, vmctx, statedb, traceTypes)
+}
+
+// traceBlock executes all the transactions contained within a block, returning
+// their traces.
+func (api *TraceAPI) traceBlock(ctx context.Context, block *types.Block) ([]*flatTrace, error) {
+	if block.NumberU64() == 0 {
+		return nil, errors.New("genesis is not traceable")
+	}
+	parent, err := api.api.blockByNumberAndHash(ctx, rpc.BlockNumber(block.NumberU64()-1), block.ParentHash())
+	if err != nil {
+		return nil, err
+	}
+	statedb, release, err := api.api.backend.StateAtBlock(ctx, parent, defaultTraceReexec)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	return api.traceBlockWithState(ctx, block, statedb)
+}
+
+// traceBlockWithState executes all the transactions contained within a block
+// on top of the state of its parent, returning their traces.
+func (api *TraceAPI) traceBlockWithState(ctx context.Context, block *types.Block, statedb *state.StateDB) ([]*flatTrace, error) {
+	var (
+		config   = api.api.backend.ChainConfig()
+		signer   = types.MakeSigner(config, block.Number())
+		blockCtx = core.NewEVMBlockContext(block.Header(), api.api.chainContext(ctx), nil)
+		traces   = []*flatTrace{}
+	)
+	for i, tx := range block.Transactions() {
+		msg, _ := tx.AsMessage(signer)
+		tracer, _, err := api.traceTx(ctx, msg, blockCtx, statedb, false)
+		if err != nil {
+			return nil, err
+		}
+		traces = append(traces, flattenTraces(tracer.rootFrame(), block, tx.Hash(), uint64(i))...)
+
+		// Finalize the state so any modifications are written to the trie
+		// Only delete empty objects if EIP158/161 (a.k.a Spurious Dragon) is in effect
+		statedb.Finalise(config.IsEIP158(block.Number()))
+	}
+	return traces, nil
+}
+
+// replay executes the given message in the provided environment, returning the
+// traces of the requested types.
+func (api *TraceAPI) replay(ctx context.Context, message core.Message, vmctx vm.BlockContext, statedb *state.StateDB, traceTypes []string) (*traceResults, error) {
+	var withTrace, withVMTrace, withStateDiff bool
+	for _, typ := range traceTypes {
+		switch typ {
+		case "trace":
+			withTrace = true
+		case "vmTrace":
+			withVMTrace = true
+		case "stateDiff":
+			withStateDiff = true
+		default:
+			return nil, fmt.Errorf("unsupported trace type %q, want one of trace, vmTrace or stateDiff", typ)
+		}
+	}
+	var pre *state.StateDB
+	if withStateDiff {
+		pre = statedb.Copy()
+	}
+	tracer, result, err := api.traceTx(ctx, message, vmctx, statedb, withVMTrace)
+	if err != nil {
+		return nil, err
+	}
+	results := &traceResults{Output: result.ReturnData, Trace: []*flatTrace{}}
+	if withTrace {
+		results.Trace = flattenTraces(tracer.rootFrame(), nil, common.Hash{}, 0)
+	}
+	if withVMTrace {
+		results.VMTrace = tracer.rootVMTrace()
+	}
+	if withStateDiff {
+		statedb.Finalise(api.api.backend.ChainConfig().IsEIP158(vmctx.BlockNumber))
+
+		// Besides the accounts touched by the execution, the sender pays for the
+		// gas and the miner receives the fees
+		tracer.touch(message.From())
+		tracer.touch(vmctx.Coinbase)
+		if root := tracer.rootFrame(); root != nil {
+			tracer.touch(root.to)
+		}
+
+		results.StateDiff = diffState(pre, statedb, tracer.touched)
+	}
+	return results, nil
+}
+
+// traceTx executes the given message in the provided environment with a parity
+// tracer, returning it along with the outcome of the execution.
+func (api *TraceAPI) traceTx(ctx context.Context, message core.Message, vmctx vm.BlockContext, statedb *state.StateDB, vmTrace bool) (*parityTracer, *core.ExecutionResult, error) {
+	tracer := newParityTracer(vmTrace)
+
+	// Handle timeouts and RPC cancellations
+	deadlineCtx, cancel := context.WithTimeout(ctx, defaultTraceTimeout)
+	go func() {
+		<-deadlineCtx.Done()
+		switch {
+		case ctx.Err() != nil:
+			tracer.Stop(ctx.Err())
+		case deadlineCtx.Err() == context.DeadlineExceeded:
+			tracer.Stop(errors.New("execution timeout"))
+		}
+	}()
+	defer cancel()
+
+	vmenv := vm.NewEVM(vmctx, core.NewEVMTxContext(message), statedb, api.api.backend.ChainConfig(), vm.Config{Debug: true, Tracer: tracer})
+	result, err := core.ApplyMessage(vmenv, message, new(core.GasPool).AddGas(message.Gas()))
+	if err != nil {
+		return nil, nil, fmt.Errorf("tracing failed: %v", err)
+	}
+	if atomic.LoadUint32(&tracer.interrupt) > 0 {
+		return nil, nil, tracer.reason
+	}
+	return tracer, result, nil
+}
+
+// flattenTraces lists the call frames of a transaction depth first. If a block
+// is given, the traces are localized to the transaction within it.
+func flattenTraces(root *parityFrame, block *types.Block, tx common.Hash, index uint64) []*flatTrace {
+	traces := []*flatTrace{}
+	if root == nil {
+		return traces
+	}
+	var flatten func(frame *parityFrame, address []int)
+	flatten = func(frame *parityFrame, address []int) {
+		trace := newFlatTrace(frame)
+		trace.Subtraces, trace.TraceAddress = len(frame.calls), address
+		if block != nil {
+			hash, number := block.Hash(), block.NumberU64()
+			trace.BlockHash, trace.BlockNumber = &hash, &number
+			trace.TransactionHash, trace.TransactionPosition = &tx, &index
+		}
+		traces = append(traces, trace)
+
+		for i, call := range frame.calls {
+			flatten(call, append(append(make([]int, 0, len(address)+1), address...), i))
+		}
+	}
+	flatten(root, []int{})
+	return traces
+}
+
+// newFlatTrace converts a call frame into a trace, without its position.
+func newFlatTrace(frame *parityFrame) *flatTrace {
+	trace := &flatTrace{from: frame.from, to: frame.to}
+	if frame.err != nil {
+		trace.Error = parityError(frame.err)
+	}
+	switch frame.typ {
+	case vm.CREATE, vm.CREATE2:
+		trace.Type = "create"
+		trace.Action = &createAction{
+			From:  frame.from,
+			Gas:   hexutil.Uint64(frame.gas),
+			Init:  frame.input,
+			Value: (*hexutil.Big)(frame.value),
+		}
+		if frame.err == nil {
+			trace.Result = &createResult{
+				Address: frame.to,
+				Code:    frame.output,
+				GasUsed: hexutil.Uint64(frame.gasUsed),
+			}
+		}
+	case vm.SELFDESTRUCT:
+		trace.Type = "suicide"
+		trace.Action = &suicideAction{
+			Address:       frame.from,
+			Balance:       (*hexutil.Big)(frame.value),
+			RefundAddress: frame.to,
+		}
+	default:
+		trace.Type = "call"
+		trace.Action = &callAction{
+			CallType: strings.ToLower(frame.typ.String()),
+			From:     frame.from,
+			Gas:      hexutil.Uint64(frame.gas),
+			Input:    frame.input,
+			To:       frame.to,
+			Value:    (*hexutil.Big)(frame.value),
+		}
+		if frame.err == nil {
+			trace.Result = &callResult{
+				GasUsed: hexutil.Uint64(frame.gasUsed),
+				Output:  frame.output,
+			}
+		}
+	}
+	return trace
+}
+
+// parityError converts an execution error into the message Parity reports.
+func parityError(err error) string {
+	switch err.(type) {
+	case *vm.ErrStackUnderflow:
+		return "Stack underflow"
+	case *vm.ErrStackOverflow:
+		return "Out of stack"
+	case *vm.ErrInvalidOpCode:
+		return "Bad instruction"
+	}
+	switch err {
+	case vm.ErrOutOfGas, vm.ErrCodeStoreOutOfGas:
+		return "Out of gas"
+	case vm.ErrExecutionReverted:
+		return "Reverted"
+	case vm.ErrInvalidJump:
+		return "Bad jump destination"
+	case vm.ErrWriteProtection:
+		return "Mutable Call In Static Context"
+	}
+	return err.Error()
+}
+
+// diffState compares the given accounts and storage slots before and after a
+// transaction, returning those it modified.
+func diffState(pre, post *state.StateDB, touched map[common.Address]map[common.Hash]struct{}) stateDiff {
+	diff := make(stateDiff)
+	for addr, slots := range touched {
+		existed, exists := pre.Exist(addr), post.Exist(addr)
+		if !existed && !exists {
+			continue
+		}
+		var (
+			born, died = !existed && exists, existed && !exists
+			changed    = born || died
+
+			preBalance, postBalance = pre.GetBalance(addr), post.GetBalance(addr)
+			preNonce, postNonce     = pre.GetNonce(addr), post.GetNonce(addr)
+			preCode, postCode       = pre.GetCode(addr), post.GetCode(addr)
+		)
+		if preBalance.Cmp(postBalance) != 0 || preNonce != postNonce || !bytes.Equal(preCode, postCode) {
+			changed = true
+		}
+		account := &accountDiff{
+			Balance: newDiffField(born, died, preBalance.Cmp(postBalance) == 0, (*hexutil.Big)(preBalance), (*hexutil.Big)(postBalance)),
+			Nonce:   newDiffField(born, died, preNonce == postNonce, hexutil.Uint64(preNonce), hexutil.Uint64(postNonce)),
+			Code:    newDiffField(born, died, bytes.Equal(preCode, postCode), hexutil.Bytes(preCode), hexutil.Bytes(postCode)),
+			Storage: make(map[common.Hash]*diffField),
+		}
+		for key := range slots {
+			from, to := pre.GetState(addr, key), post.GetState(addr, key)
+			if from == to {
+				continue
+			}
+			account.Storage[key] = newDiffField(born, died, false, from, to)
+			changed = true
+		}
+		if changed {
+			diff[addr] = account
+		}
+	}
+	return diff
+}
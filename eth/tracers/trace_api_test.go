@@ -0,0 +1,323 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package tracers
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/internal/ethapi"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+var (
+	// traceCallee returns the word 0x2a.
+	traceCallee     = common.HexToAddress("0x00000000000000000000000000000000000000bb")
+	traceCalleeCode = hexutil.MustDecode("0x602a60005260206000f3")
+
+	// traceCaller calls traceCallee and stores the word returned in slot 0.
+	traceCaller     = common.HexToAddress("0x00000000000000000000000000000000000000aa")
+	traceCallerCode = append(append(hexutil.MustDecode("0x60206000600060006000"+"73"), traceCallee.Bytes()...), hexutil.MustDecode("0x5af150600051600055")...)
+
+	traceMiner = common.HexToAddress("0x00000000000000000000000000000000000000cc")
+
+	// traceGhostCaller calls traceGhost, an account which doesn't exist,
+	// without value.
+	traceGhost           = common.HexToAddress("0x00000000000000000000000000000000000000dd")
+	traceGhostCaller     = common.HexToAddress("0x00000000000000000000000000000000000000ee")
+	traceGhostCallerCode = append(append(hexutil.MustDecode("0x60006000600060006000"+"73"), traceGhost.Bytes()...), hexutil.MustDecode("0x5af15000")...)
+)
+
+// newTraceAPITester creates a chain whose blocks each contain a transfer from
+// the first account to the second and a call to traceCaller, returning the
+// trace API along with the hashes of the transactions.
+func newTraceAPITester(t *testing.T, blocks int) (*TraceAPI, Accounts, [][]common.Hash) {
+	accounts := newAccounts(2)
+	genesis := &core.Genesis{Alloc: core.GenesisAlloc{
+		accounts[0].addr: {Balance: big.NewInt(params.Ether)},
+		traceCaller:      {Balance: new(big.Int), Code: traceCallerCode},
+		traceCallee:      {Balance: new(big.Int), Code: traceCalleeCode},
+	}}
+	signer := types.HomesteadSigner{}
+	hashes := make([][]common.Hash, blocks+1)
+	api := NewTraceAPI(newTestBackend(t, blocks, genesis, func(i int, b *core.BlockGen) {
+		b.SetCoinbase(traceMiner)
+
+		transfer, _ := types.SignTx(types.NewTransaction(uint64(2*i), accounts[1].addr, big.NewInt(1000), params.TxGas, big.NewInt(1), nil), signer, accounts[0].key)
+		b.AddTx(transfer)
+		call, _ := types.SignTx(types.NewTransaction(uint64(2*i+1), traceCaller, big.NewInt(0), 100000, big.NewInt(1), nil), signer, accounts[0].key)
+		b.AddTx(call)
+
+		hashes[i+1] = []common.Hash{transfer.Hash(), call.Hash()}
+	}))
+	return api, accounts, hashes
+}
+
+func TestTraceAPIBlock(t *testing.T) {
+	t.Parallel()
+
+	api, accounts, hashes := newTraceAPITester(t, 2)
+	traces, err := api.Block(context.Background(), rpc.BlockNumber(2))
+	if err != nil {
+		t.Fatalf("failed to trace block: %v", err)
+	}
+	if len(traces) != 3 {
+		t.Fatalf("trace count mismatch: have %d, want 3", len(traces))
+	}
+	// The transfer is a single call
+	transfer := traces[0]
+	if transfer.Type != "call" || transfer.Subtraces != 0 || len(transfer.TraceAddress) != 0 {
+		t.Errorf("transfer trace mismatch: have %+v", transfer)
+	}
+	if *transfer.TransactionHash != hashes[2][0] || *transfer.TransactionPosition != 0 || *transfer.BlockNumber != 2 {
+		t.Errorf("transfer trace position mismatch: have tx %x #%d in block %d", *transfer.TransactionHash, *transfer.TransactionPosition, *transfer.BlockNumber)
+	}
+	if action := transfer.Action.(*callAction); action.From != accounts[0].addr || action.To != accounts[1].addr || action.Value.ToInt().Int64() != 1000 {
+		t.Errorf("transfer action mismatch: have %+v", action)
+	}
+	// The call to the caller contains the one to the callee
+	caller, callee := traces[1], traces[2]
+	if caller.Subtraces != 1 || len(caller.TraceAddress) != 0 || *caller.TransactionPosition != 1 {
+		t.Errorf("caller trace mismatch: have %+v", caller)
+	}
+	if !reflect.DeepEqual(callee.TraceAddress, []int{0}) || callee.Subtraces != 0 {
+		t.Errorf("callee trace mismatch: have %+v", callee)
+	}
+	if action := callee.Action.(*callAction); action.CallType != "call" || action.From != traceCaller || action.To != traceCallee {
+		t.Errorf("callee action mismatch: have %+v", action)
+	}
+	if result := callee.Result.(*callResult); !reflect.DeepEqual(result.Output, hexutil.Bytes(common.LeftPadBytes([]byte{0x2a}, 32))) {
+		t.Errorf("callee output mismatch: have %v", result.Output)
+	}
+	// The traces of a transaction are the same as in its block
+	txTraces, err := api.Transaction(context.Background(), hashes[2][1])
+	if err != nil {
+		t.Fatalf("failed to trace transaction: %v", err)
+	}
+	have, _ := json.Marshal(txTraces)
+	want, _ := json.Marshal(traces[1:])
+	if string(have) != string(want) {
+		t.Errorf("transaction traces mismatch: have %s, want %s", have, want)
+	}
+}
+
+func TestTraceAPIFilter(t *testing.T) {
+	t.Parallel()
+
+	api, accounts, hashes := newTraceAPITester(t, 3)
+	from, to := rpc.BlockNumber(1), rpc.BlockNumber(3)
+	after, count := uint64(1), uint64(1)
+
+	tests := []struct {
+		args   traceFilterArgs
+		hashes []common.Hash
+	}{
+		// All the traces in the range
+		{
+			args:   traceFilterArgs{FromBlock: &from, ToBlock: &to},
+			hashes: []common.Hash{hashes[1][0], hashes[1][1], hashes[1][1], hashes[2][0], hashes[2][1], hashes[2][1], hashes[3][0], hashes[3][1], hashes[3][1]},
+		},
+		// The latest block by default
+		{
+			args:   traceFilterArgs{ToAddress: []common.Address{accounts[1].addr}},
+			hashes: []common.Hash{hashes[3][0]},
+		},
+		// The inner calls to the callee
+		{
+			args:   traceFilterArgs{FromBlock: &from, FromAddress: []common.Address{traceCaller}, ToAddress: []common.Address{traceCallee}},
+			hashes: []common.Hash{hashes[1][1], hashes[2][1], hashes[3][1]},
+		},
+		// Paginated calls from the sender
+		{
+			args:   traceFilterArgs{FromBlock: &from, FromAddress: []common.Address{accounts[0].addr}, ToAddress: []common.Address{traceCaller}, After: &after, Count: &count},
+			hashes: []common.Hash{hashes[2][1]},
+		},
+	}
+	for i, tt := range tests {
+		traces, err := api.Filter(context.Background(), tt.args)
+		if err != nil {
+			t.Errorf("test %d: failed to filter traces: %v", i, err)
+			continue
+		}
+		have := make([]common.Hash, len(traces))
+		for j, trace := range traces {
+			have[j] = *trace.TransactionHash
+		}
+		if !reflect.DeepEqual(have, tt.hashes) {
+			t.Errorf("test %d: traces mismatch: have %x, want %x", i, have, tt.hashes)
+		}
+	}
+	if _, err := api.Filter(context.Background(), traceFilterArgs{FromBlock: &to, ToBlock: &from}); err == nil {
+		t.Errorf("inverted block range accepted")
+	}
+}
+
+func TestTraceAPIFilterRange(t *testing.T) {
+	t.Parallel()
+
+	// The test backend caps the filtered range at 16 blocks
+	api, _, hashes := newTraceAPITester(t, 16)
+	genesis, first, last := rpc.BlockNumber(0), rpc.BlockNumber(1), rpc.BlockNumber(16)
+
+	if _, err := api.Filter(context.Background(), traceFilterArgs{FromBlock: &genesis, ToBlock: &last}); err == nil {
+		t.Fatalf("oversized block range accepted")
+	}
+	traces, err := api.Filter(context.Background(), traceFilterArgs{FromBlock: &first, ToBlock: &last})
+	if err != nil {
+		t.Fatalf("failed to filter traces: %v", err)
+	}
+	if len(traces) != 3*16 {
+		t.Fatalf("trace count mismatch: have %d, want %d", len(traces), 3*16)
+	}
+	for i, trace := range traces {
+		if want := hashes[i/3+1][(i%3+1)/2]; *trace.TransactionHash != want {
+			t.Errorf("trace %d: transaction mismatch: have %x, want %x", i, *trace.TransactionHash, want)
+		}
+	}
+}
+
+func TestTraceAPIMissingCallee(t *testing.T) {
+	t.Parallel()
+
+	accounts := newAccounts(1)
+	genesis := &core.Genesis{Alloc: core.GenesisAlloc{
+		accounts[0].addr: {Balance: big.NewInt(params.Ether)},
+		traceGhostCaller: {Balance: new(big.Int), Code: traceGhostCallerCode},
+	}}
+	var hash common.Hash
+	api := NewTraceAPI(newTestBackend(t, 1, genesis, func(i int, b *core.BlockGen) {
+		tx, _ := types.SignTx(types.NewTransaction(0, traceGhostCaller, big.NewInt(0), 100000, big.NewInt(1), nil), types.HomesteadSigner{}, accounts[0].key)
+		b.AddTx(tx)
+		hash = tx.Hash()
+	}))
+	// The call to the missing account is reported like by OpenEthereum, even
+	// though it executes nothing
+	traces, err := api.Block(context.Background(), rpc.BlockNumber(1))
+	if err != nil {
+		t.Fatalf("failed to trace block: %v", err)
+	}
+	if len(traces) != 2 || traces[0].Subtraces != 1 {
+		t.Fatalf("traces mismatch: have %d traces", len(traces))
+	}
+	ghost := traces[1]
+	if !reflect.DeepEqual(ghost.TraceAddress, []int{0}) || ghost.Subtraces != 0 || ghost.Error != "" {
+		t.Errorf("missing callee trace mismatch: have %+v", ghost)
+	}
+	if action := ghost.Action.(*callAction); action.CallType != "call" || action.From != traceGhostCaller || action.To != traceGhost || action.Value.ToInt().Sign() != 0 {
+		t.Errorf("missing callee action mismatch: have %+v", action)
+	}
+	if result := ghost.Result.(*callResult); result.GasUsed != 0 || len(result.Output) != 0 {
+		t.Errorf("missing callee result mismatch: have %+v", result)
+	}
+	res, err := api.ReplayTransaction(context.Background(), hash, []string{"trace"})
+	if err != nil {
+		t.Fatalf("failed to replay transaction: %v", err)
+	}
+	if len(res.Trace) != 2 || res.Trace[1].Action.(*callAction).To != traceGhost {
+		t.Errorf("replayed traces mismatch: have %+v", res.Trace)
+	}
+}
+
+func TestTraceAPIReplayTransaction(t *testing.T) {
+	t.Parallel()
+
+	api, accounts, hashes := newTraceAPITester(t, 1)
+	if _, err := api.ReplayTransaction(context.Background(), hashes[1][1], []string{"trace", "memTrace"}); err == nil {
+		t.Errorf("unsupported trace type accepted")
+	}
+	res, err := api.ReplayTransaction(context.Background(), hashes[1][1], []string{"trace", "vmTrace", "stateDiff"})
+	if err != nil {
+		t.Fatalf("failed to replay transaction: %v", err)
+	}
+	if len(res.Trace) != 2 || res.Trace[0].BlockHash != nil || res.Trace[0].TransactionHash != nil {
+		t.Errorf("traces mismatch: have %+v", res.Trace)
+	}
+	// The caller executes 14 instructions, the 8th calling into the callee
+	if !reflect.DeepEqual([]byte(res.VMTrace.Code), traceCallerCode) || len(res.VMTrace.Ops) != 14 {
+		t.Fatalf("vmTrace mismatch: have code %x, %d ops", []byte(res.VMTrace.Code), len(res.VMTrace.Ops))
+	}
+	call := res.VMTrace.Ops[7]
+	if call.Sub == nil || !reflect.DeepEqual([]byte(call.Sub.Code), traceCalleeCode) || len(call.Sub.Ops) != 6 {
+		t.Fatalf("vmTrace call mismatch: have %+v", call)
+	}
+	if len(call.Ex.Push) != 1 || call.Ex.Push[0].ToInt().Int64() != 1 || call.Ex.Mem == nil || call.Ex.Mem.Off != 0 || len(call.Ex.Mem.Data) != 32 {
+		t.Errorf("vmTrace call outcome mismatch: have %+v", call.Ex)
+	}
+	if store := res.VMTrace.Ops[12].Ex.Store; store == nil || store.Key.ToInt().Sign() != 0 || store.Val.ToInt().Int64() != 0x2a {
+		t.Errorf("vmTrace store mismatch: have %+v", store)
+	}
+	// The sender pays the fees to the miner and the caller stores the output
+	blob, _ := json.Marshal(res.StateDiff)
+	var diff map[common.Address]map[string]interface{}
+	if err := json.Unmarshal(blob, &diff); err != nil {
+		t.Fatalf("failed to decode state diff: %v", err)
+	}
+	if len(diff) != 3 {
+		t.Fatalf("state diff account count mismatch: have %s", blob)
+	}
+	if sender := diff[accounts[0].addr]; sender["code"] != "=" || !reflect.DeepEqual(sender["nonce"], map[string]interface{}{"*": map[string]interface{}{"from": "0x1", "to": "0x2"}}) {
+		t.Errorf("sender diff mismatch: have %v", sender)
+	}
+	if miner := diff[traceMiner]; miner == nil || miner["balance"] == "=" {
+		t.Errorf("miner diff mismatch: have %v", miner)
+	}
+	want := map[string]interface{}{
+		"0x0000000000000000000000000000000000000000000000000000000000000000": map[string]interface{}{"*": map[string]interface{}{
+			"from": "0x0000000000000000000000000000000000000000000000000000000000000000",
+			"to":   "0x000000000000000000000000000000000000000000000000000000000000002a",
+		}},
+	}
+	if caller := diff[traceCaller]; caller["balance"] != "=" || !reflect.DeepEqual(caller["storage"], want) {
+		t.Errorf("caller diff mismatch: have %v", caller)
+	}
+}
+
+func TestTraceAPICall(t *testing.T) {
+	t.Parallel()
+
+	api, accounts, _ := newTraceAPITester(t, 1)
+	res, err := api.Call(context.Background(), ethapi.CallArgs{
+		From: &accounts[0].addr,
+		Data: (*hexutil.Bytes)(&traceCalleeCode),
+	}, []string{"trace", "stateDiff"}, nil)
+	if err != nil {
+		t.Fatalf("failed to trace call: %v", err)
+	}
+	if res.VMTrace != nil || len(res.Trace) != 1 || res.Trace[0].Type != "create" {
+		t.Fatalf("traces mismatch: have %+v", res)
+	}
+	created := res.Trace[0].Result.(*createResult)
+	if !reflect.DeepEqual(res.Output, hexutil.Bytes(common.LeftPadBytes([]byte{0x2a}, 32))) || !reflect.DeepEqual(created.Code, res.Output) {
+		t.Errorf("created code mismatch: have %v, output %v", created.Code, res.Output)
+	}
+	account := res.StateDiff[created.Address]
+	if account == nil {
+		t.Fatalf("created account missing from the state diff")
+	}
+	blob, _ := json.Marshal(account)
+	if want := `{"balance":{"+":"0x0"},"code":{"+":"0x000000000000000000000000000000000000000000000000000000000000002a"},"nonce":{"+":"0x1"},"storage":{}}`; string(blob) != want {
+		t.Errorf("created account diff mismatch: have %s, want %s", blob, want)
+	}
+}
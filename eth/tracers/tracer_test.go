@@ -124,11 +124,9 @@ func TestTracer(t *testing.T) {
 }
 
 func TestHalt(t *testing.T) {
-	t.Skip("duktape doesn't support abortion")
-
 	timeout := errors.New("stahp")
 	vmctx := testCtx()
-	tracer, err := New("{step: function() { while(1); }, result: function() { return null; }}", vmctx.txCtx)
+	tracer, err := New("{step: function() { while(1); }, fault: function() {}, result: function() { return null; }}", vmctx.txCtx)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -161,3 +159,24 @@ func TestHaltBetweenSteps(t *testing.T) {
 		t.Errorf("Expected timeout error, got %v", err)
 	}
 }
+
+// Tests that all the built in tracers run without errors on the call tracer test
+// suite.
+func TestBuiltinTracers(t *testing.T) {
+	for name := range all {
+		name := name // capture range variable
+		for test, tc := range callTracerTests(t) {
+			tc := tc // capture range variable
+			t.Run(name+"/"+test, func(t *testing.T) {
+				t.Parallel()
+
+				res := runTracerTest(t, tc, func(txCtx vm.TxContext) (ResultTracer, error) {
+					return New(name, txCtx)
+				})
+				if !json.Valid(res) {
+					t.Errorf("invalid result: %s", res)
+				}
+			})
+		}
+	}
+}
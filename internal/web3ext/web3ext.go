@@ -28,6 +28,7 @@ var Modules = map[string]string{
 	"miner":      MinerJs,
 	"net":        NetJs,
 	"personal":   PersonalJs,
+	"realtime":   RealtimeJs,
 	"rpc":        RpcJs,
 	"shh":        ShhJs,
 	"swarmfs":    SwarmfsJs,
@@ -752,6 +753,55 @@ web3._extend({
 });
 `
 
+const RealtimeJs = `
+web3._extend({
+	property: 'realtime',
+	methods: [
+		new web3._extend.Method({
+			name: 'start',
+			call: 'realtime_start'
+		}),
+		new web3._extend.Method({
+			name: 'stop',
+			call: 'realtime_stop'
+		}),
+		new web3._extend.Method({
+			name: 'getResult',
+			call: 'realtime_getResult',
+			params: 1
+		}),
+		new web3._extend.Method({
+			name: 'getReplacements',
+			call: 'realtime_getReplacements',
+			params: 1
+		}),
+		new web3._extend.Method({
+			name: 'getInclusion',
+			call: 'realtime_getInclusion',
+			params: 1
+		}),
+		new web3._extend.Method({
+			name: 'simulate',
+			call: 'realtime_simulate',
+			params: 1
+		}),
+	],
+	properties:
+	[
+		new web3._extend.Property({
+			name: 'status',
+			getter: 'realtime_status',
+			outputFormatter: function(status) {
+				status.queued = web3._extend.utils.toDecimal(status.queued);
+				status.executing = web3._extend.utils.toDecimal(status.executing);
+				status.executed = web3._extend.utils.toDecimal(status.executed);
+				return status;
+			}
+		}),
+	]
+});
+`
+
 const TxpoolJs = `
 web3._extend({
 	property: 'txpool',
@@ -0,0 +1,86 @@
+package realtime
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/trace"
+)
+
+// PublicRealtimeAPI exposes the results of the realtime simulator.
+type PublicRealtimeAPI struct {
+	simulator *Simulator
+}
+
+// NewPublicRealtimeAPI creates a new API for the given simulator.
+func NewPublicRealtimeAPI(simulator *Simulator) *PublicRealtimeAPI {
+	return &PublicRealtimeAPI{simulator}
+}
+
+// Status returns whether the simulator is running and whether the node is
+// synced, along with the number of queued, executing and executed transactions
+// and the number of transactions waiting for a simulation worker.
+func (api *PublicRealtimeAPI) Status() map[string]interface{} {
+	queued, executing, executed := api.simulator.simTxPool.Stats()
+	return map[string]interface{}{
+		"running":   api.simulator.isRunning(),
+		"synced":    api.simulator.isSynced(),
+		"rolling":   api.simulator.rolling,
+		"queued":    hexutil.Uint(queued),
+		"executing": hexutil.Uint(executing),
+		"executed":  hexutil.Uint(executed),
+		"backlog":   hexutil.Uint(len(api.simulator.taskCh)),
+	}
+}
+
+// GetResult returns the simulated receipt, traces and transfers of a recently
+// simulated pending transaction, or nil if it is unknown.
+func (api *PublicRealtimeAPI) GetResult(hash common.Hash) *trace.TransactionAll {
+	return api.simulator.Result(hash)
+}
+
+// GetReplacements returns the replacement chain of the given transaction: all
+// transactions seen with the same sender and nonce, oldest first, or nil if it
+// is unknown.
+func (api *PublicRealtimeAPI) GetReplacements(hash common.Hash) []Replacement {
+	return api.simulator.simTxPool.Replacements(hash)
+}
+
+// GetInclusion returns whether the given simulated transaction was mined,
+// replaced or dropped, along with the difference between its simulated and
+// actual outcome, or nil if it is unknown or still pending.
+func (api *PublicRealtimeAPI) GetInclusion(hash common.Hash) *trace.Inclusion {
+	return api.simulator.Inclusion(hash)
+}
+
+// Simulate executes the given signed, RLP encoded transaction on top of the
+// pending state and returns its receipt, traces and transfers. The simulated
+// transaction is neither broadcast nor recorded.
+func (api *PublicRealtimeAPI) Simulate(input hexutil.Bytes) (*trace.TransactionAll, error) {
+	tx := new(types.Transaction)
+	if err := rlp.DecodeBytes(input, tx); err != nil {
+		return nil, err
+	}
+	return api.simulator.Simulate(tx)
+}
+
+// PrivateRealtimeAPI allows controlling the realtime simulator.
+type PrivateRealtimeAPI struct {
+	simulator *Simulator
+}
+
+// NewPrivateRealtimeAPI creates a new API for the given simulator.
+func NewPrivateRealtimeAPI(simulator *Simulator) *PrivateRealtimeAPI {
+	return &PrivateRealtimeAPI{simulator}
+}
+
+// Start begins simulating the incoming pending transactions.
+func (api *PrivateRealtimeAPI) Start() {
+	api.simulator.Start()
+}
+
+// Stop pauses the simulation of pending transactions.
+func (api *PrivateRealtimeAPI) Stop() {
+	api.simulator.Stop()
+}
@@ -0,0 +1,50 @@
+package realtime
+
+import (
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+func TestRealtimeAPI(t *testing.T) {
+	simulator, sink := newTestSimulator(t, true)
+	api := NewPublicRealtimeAPI(simulator)
+
+	executed := transfer(t, testKey, 0, 1)
+	if _, err := simulator.ExecuteTransaction(executed); err != nil {
+		t.Fatalf("failed to simulate transaction: %v", err)
+	}
+	simulator.simTxPool.RemoveExecuted(executed)
+
+	result := api.GetResult(executed.Hash())
+	if result == nil || result.TxHash != executed.Hash() || result.TxReceipt == nil {
+		t.Fatalf("result mismatch: have %+v", result)
+	}
+	if result := api.GetResult(transfer(t, otherKey, 0, 1).Hash()); result != nil {
+		t.Errorf("result of unknown transaction: %+v", result)
+	}
+	// On-demand simulations build on the pending state but leave it untouched
+	next := transfer(t, testKey, 1, 1)
+	input, err := rlp.EncodeToBytes(next)
+	if err != nil {
+		t.Fatalf("failed to encode transaction: %v", err)
+	}
+	simulated, err := api.Simulate(input)
+	if err != nil {
+		t.Fatalf("failed to simulate raw transaction: %v", err)
+	}
+	if simulated.TxHash != next.Hash() || simulated.TxReceipt.TxIndex != 1 {
+		t.Errorf("simulation mismatch: have hash %x index %d, want %x index 1", simulated.TxHash, simulated.TxReceipt.TxIndex, next.Hash())
+	}
+	if len(simulator.pending.txs) != 1 || len(sink.Records()) != 1 || api.GetResult(next.Hash()) != nil {
+		t.Errorf("on-demand simulation recorded: %d stacked, %d records", len(simulator.pending.txs), len(sink.Records()))
+	}
+	if _, err := api.Simulate(hexutil.Bytes{0x01}); err == nil {
+		t.Error("malformed transaction simulated")
+	}
+	status := api.Status()
+	if status["executed"] != hexutil.Uint(1) || status["queued"] != hexutil.Uint(0) || status["rolling"] != true {
+		t.Errorf("status mismatch: have %v", status)
+	}
+}
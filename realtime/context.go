@@ -0,0 +1,153 @@
+package realtime
+
+import (
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/ethereum/go-ethereum/miner"
+	"github.com/ethereum/go-ethereum/trace"
+)
+
+// contextSensitiveMeter counts the simulated transactions whose outcome depends
+// on the block they are mined in.
+var contextSensitiveMeter = metrics.NewRegisteredMeter("realtime/context/sensitive", nil)
+
+// blockContext are the settings the header of the simulated block is derived
+// from, the way the miner would assemble it.
+type blockContext struct {
+	coinbase common.Address
+	gasFloor uint64        // Target gas floor of the miner, zero to keep the parent's gas limit
+	gasCeil  uint64        // Target gas ceiling of the miner
+	interval time.Duration // Expected time between blocks
+	probe    bool          // Whether to simulate again under alternative contexts
+}
+
+// newBlockContext extracts the block context settings from the trace recorder
+// and miner configurations. The coinbase defaults to the miner's etherbase.
+func newBlockContext(config *trace.Config, minerConfig *miner.Config) blockContext {
+	context := blockContext{
+		coinbase: config.Coinbase,
+		interval: config.BlockInterval,
+		probe:    config.Probe,
+	}
+	if minerConfig != nil {
+		if context.coinbase == (common.Address{}) {
+			context.coinbase = minerConfig.Etherbase
+		}
+		context.gasFloor, context.gasCeil = minerConfig.GasFloor, minerConfig.GasCeil
+	}
+	if context.interval <= 0 {
+		log.Warn("Sanitizing invalid simulation block interval", "provided", context.interval, "updated", trace.DefaultConfig.BlockInterval)
+		context.interval = trace.DefaultConfig.BlockInterval
+	}
+	if context.probe && config.Rolling {
+		log.Warn("Block context probing is only supported by isolated simulation")
+		context.probe = false
+	}
+	return context
+}
+
+// simulationHeader creates the header of the block following parent, which the
+// pending transactions are simulated in. Like the miner, the gas limit moves
+// towards the configured target and the difficulty follows the consensus
+// rules. The block is expected one block interval after its parent, or now if
+// that is already past.
+func (simulator *Simulator) simulationHeader(parent *types.Block) *types.Header {
+	timestamp := parent.Time() + uint64(simulator.context.interval/time.Second)
+	if now := uint64(time.Now().Unix()); timestamp < now {
+		timestamp = now
+	}
+	return simulator.headerAt(parent, simulator.context.coinbase, timestamp)
+}
+
+// headerAt creates the header of the block following parent with the given
+// coinbase and timestamp.
+func (simulator *Simulator) headerAt(parent *types.Block, coinbase common.Address, timestamp uint64) *types.Header {
+	header := &types.Header{
+		ParentHash: parent.Hash(),
+		Number:     new(big.Int).Add(parent.Number(), common.Big1),
+		GasLimit:   parent.GasLimit(),
+		Time:       timestamp,
+		Coinbase:   coinbase,
+	}
+	if simulator.context.gasFloor > 0 {
+		header.GasLimit = core.CalcGasLimit(parent, simulator.context.gasFloor, simulator.context.gasCeil)
+	}
+	header.Difficulty = simulator.chain.Engine().CalcDifficulty(simulator.chain, timestamp, parent.Header())
+	return header
+}
+
+// applyIsolated applies a single transaction in the given block on top of
+// statedb and reverts it afterwards.
+func (simulator *Simulator) applyIsolated(tx *types.Transaction, statedb *state.StateDB, header *types.Header) (*types.Receipt, *trace.TraceCollector, error) {
+	snap := statedb.Snapshot()
+	defer statedb.RevertToSnapshot(snap)
+
+	statedb.Prepare(tx.Hash(), common.Hash{}, 0)
+	gasPool := new(core.GasPool).AddGas(header.GasLimit)
+
+	return core.RTApplyTransaction(simulator.chainConfig, simulator.chain, nil, gasPool, statedb, header, tx, &header.GasUsed, *simulator.chain.GetVMConfig())
+}
+
+// executeProbed simulates a transaction in isolation like executeIsolated, then
+// simulates it again with another coinbase and a later timestamp. It returns
+// the block context fields whose change alters the outcome of the transaction.
+func (simulator *Simulator) executeProbed(tx *types.Transaction, statedb *state.StateDB) (*types.Receipt, *trace.TraceCollector, []string, error) {
+	parent := simulator.chain.CurrentBlock()
+	if statedb == nil {
+		current, err := simulator.chain.StateAt(parent.Root())
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		statedb = current
+	}
+	header := simulator.simulationHeader(parent)
+	receipt, collector, err := simulator.applyIsolated(tx, statedb, header)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	var (
+		record   = collector.Record(tx.Hash())
+		interval = uint64(simulator.context.interval / time.Second)
+		probes   = []struct {
+			field  string
+			header *types.Header
+		}{
+			{trace.ContextCoinbase, simulator.headerAt(parent, probeCoinbase(header.Coinbase), header.Time)},
+			{trace.ContextTimestamp, simulator.headerAt(parent, header.Coinbase, header.Time+interval)},
+		}
+		fields []string
+	)
+	for _, probe := range probes {
+		_, probed, err := simulator.applyIsolated(tx, statedb, probe.header)
+		if err != nil {
+			// Failing to apply is a difference of its own, e.g. the gas limit
+			fields = append(fields, probe.field)
+			continue
+		}
+		probedRecord := probed.Record(tx.Hash())
+		if diff := trace.DiffRecords(&record, &probedRecord); len(diff.Mismatches) > 0 {
+			fields = append(fields, probe.field)
+		}
+	}
+	if len(fields) > 0 {
+		contextSensitiveMeter.Mark(1)
+		log.Debug("Context sensitive transaction simulated", "hash", tx.Hash(), "fields", fields)
+	}
+	return receipt, collector, fields, nil
+}
+
+// probeCoinbase returns an alternative coinbase, differing from the given one
+// in every byte.
+func probeCoinbase(coinbase common.Address) common.Address {
+	for i := range coinbase {
+		coinbase[i] ^= 0xff
+	}
+	return coinbase
+}
@@ -0,0 +1,73 @@
+package realtime
+
+import (
+	"math/big"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/miner"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/trace"
+)
+
+func TestSimulationHeader(t *testing.T) {
+	simulator, _ := newTestSimulator(t, false)
+	simulator.context = newBlockContext(&trace.Config{BlockInterval: time.Hour}, &miner.Config{
+		Etherbase: common.Address{0xee},
+		GasFloor:  8000000,
+		GasCeil:   8000000,
+	})
+	parent := simulator.chain.CurrentBlock()
+	header := simulator.simulationHeader(parent)
+
+	if header.Coinbase != (common.Address{0xee}) {
+		t.Errorf("coinbase mismatch: have %x, want the etherbase", header.Coinbase)
+	}
+	if want := core.CalcGasLimit(parent, 8000000, 8000000); header.GasLimit != want {
+		t.Errorf("gas limit mismatch: have %d, want %d", header.GasLimit, want)
+	}
+	// The genesis is older than an interval, so the block is expected now
+	if now := uint64(time.Now().Unix()); header.Time < now {
+		t.Errorf("timestamp in the past: have %d, now %d", header.Time, now)
+	}
+	if want := simulator.chain.Engine().CalcDifficulty(simulator.chain, header.Time, parent.Header()); header.Difficulty.Cmp(want) != 0 {
+		t.Errorf("difficulty mismatch: have %v, want %v", header.Difficulty, want)
+	}
+	// A configured coinbase takes precedence over the etherbase
+	simulator.context = newBlockContext(&trace.Config{Coinbase: common.Address{0xcb}}, &miner.Config{Etherbase: common.Address{0xee}})
+	if header := simulator.simulationHeader(parent); header.Coinbase != (common.Address{0xcb}) {
+		t.Errorf("coinbase mismatch: have %x, want the configured one", header.Coinbase)
+	}
+}
+
+func TestProbeContext(t *testing.T) {
+	simulator, sink := newTestSimulator(t, false)
+	simulator.context = newBlockContext(&trace.Config{BlockInterval: time.Second, Probe: true}, nil)
+
+	var (
+		signer = types.NewEIP155Signer(params.TestChainConfig.ChainID)
+		plain  = transfer(t, testKey, 0, 1)
+		// Contracts returning the coinbase and the timestamp as their code
+		coinbase  = signTx(t, signer, types.NewContractCreation(0, new(big.Int), 100000, big.NewInt(1), hexutil.MustDecode("0x4160005260206000f3")))
+		timestamp = signTx(t, signer, types.NewContractCreation(0, new(big.Int), 100000, big.NewInt(1), hexutil.MustDecode("0x4260005260206000f3")))
+	)
+	for _, tx := range []*types.Transaction{plain, coinbase, timestamp} {
+		if _, err := simulator.ExecuteTransaction(tx); err != nil {
+			t.Fatalf("failed to simulate transaction %x: %v", tx.Hash(), err)
+		}
+	}
+	records := sink.Records()
+	if len(records) != 3 {
+		t.Fatalf("record count mismatch: have %d, want 3", len(records))
+	}
+	for i, want := range [][]string{nil, {trace.ContextCoinbase}, {trace.ContextTimestamp}} {
+		if !reflect.DeepEqual(records[i].TxContext, want) {
+			t.Errorf("record %d: context mismatch: have %v, want %v", i, records[i].TxContext, want)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package realtime
+
+import (
+	"context"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/ethereum/go-ethereum/trace"
+)
+
+// simulationChanSize is the size of channel listening to simulation results.
+const simulationChanSize = 128
+
+// SimulationFilter selects the simulation results streamed to a subscriber.
+// Every non-empty criterion has to match, any of the addresses within a
+// criterion matches.
+type SimulationFilter struct {
+	From      []common.Address `json:"from"`      // transaction senders
+	To        []common.Address `json:"to"`        // transaction recipients, or created contracts
+	Contracts []common.Address `json:"contracts"` // accounts called or created anywhere in the call tree
+	Tokens    []common.Address `json:"tokens"`    // token contracts of the transfers made
+	MinValue  *hexutil.Big     `json:"minValue"`  // minimum ether value of the transaction
+}
+
+// Matches reports whether the simulation record passes the filter.
+func (f *SimulationFilter) Matches(record *trace.TransactionAll) bool {
+	receipt := record.TxReceipt
+	if receipt == nil {
+		return false
+	}
+	if len(f.From) > 0 && !includes(f.From, receipt.FromAddr) {
+		return false
+	}
+	if len(f.To) > 0 {
+		to := receipt.ToAddr
+		if to == nil && len(record.TxTraces) > 0 {
+			to = record.TxTraces[0].CreateAddr
+		}
+		if to == nil || !includes(f.To, *to) {
+			return false
+		}
+	}
+	if len(f.Contracts) > 0 && !touches(record, f.Contracts) {
+		return false
+	}
+	if len(f.Tokens) > 0 {
+		found := false
+		for _, transfer := range record.TxTransfers {
+			if transfer.Standard != trace.StandardETH && includes(f.Tokens, transfer.Token) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if f.MinValue != nil && (receipt.Value == nil || receipt.Value.Cmp(f.MinValue.ToInt()) < 0) {
+		return false
+	}
+	return true
+}
+
+// touches reports whether any of the addresses is called or created by the
+// transaction.
+func touches(record *trace.TransactionAll, addrs []common.Address) bool {
+	for _, frame := range record.TxTraces {
+		for _, addr := range []*common.Address{frame.ToAddr, frame.CreateAddr, frame.SuicideContract} {
+			if addr != nil && includes(addrs, *addr) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func includes(addresses []common.Address, a common.Address) bool {
+	for _, addr := range addresses {
+		if addr == a {
+			return true
+		}
+	}
+	return false
+}
+
+// SubscribeSimulations registers a subscription notified with the record of
+// every pending transaction simulated from now on.
+func (simulator *Simulator) SubscribeSimulations(ch chan<- *trace.TransactionAll) event.Subscription {
+	return simulator.scope.Track(simulator.simulationFeed.Subscribe(ch))
+}
+
+// PublicSimulationFilterAPI streams the results of the realtime simulator.
+type PublicSimulationFilterAPI struct {
+	simulator *Simulator
+}
+
+// NewPublicSimulationFilterAPI creates a new API for the given simulator.
+func NewPublicSimulationFilterAPI(simulator *Simulator) *PublicSimulationFilterAPI {
+	return &PublicSimulationFilterAPI{simulator}
+}
+
+// RealtimeSimulations creates a subscription notified with the receipt, traces
+// and transfers of each simulated pending transaction matching the filter, as
+// soon as its simulation completes.
+func (api *PublicSimulationFilterAPI) RealtimeSimulations(ctx context.Context, filter *SimulationFilter) (*rpc.Subscription, error) {
+	notifier, supported := rpc.NotifierFromContext(ctx)
+	if !supported {
+		return &rpc.Subscription{}, rpc.ErrNotificationsUnsupported
+	}
+	if filter == nil {
+		filter = new(SimulationFilter)
+	}
+	rpcSub := notifier.CreateSubscription()
+
+	go func() {
+		records := make(chan *trace.TransactionAll, simulationChanSize)
+		sub := api.simulator.SubscribeSimulations(records)
+		defer sub.Unsubscribe()
+
+		for {
+			select {
+			case record := <-records:
+				if filter.Matches(record) {
+					notifier.Notify(rpcSub.ID, record)
+				}
+			case <-rpcSub.Err(): // client send an unsubscribe request
+				return
+			case <-notifier.Closed(): // connection dropped
+				return
+			case <-sub.Err(): // simulator stopped
+				return
+			}
+		}
+	}()
+	return rpcSub, nil
+}
+
+// RealtimeInclusions creates a subscription notified whenever a simulated
+// transaction is mined, replaced or dropped, or the block it was mined in is
+// reorged out.
+func (api *PublicSimulationFilterAPI) RealtimeInclusions(ctx context.Context) (*rpc.Subscription, error) {
+	notifier, supported := rpc.NotifierFromContext(ctx)
+	if !supported {
+		return &rpc.Subscription{}, rpc.ErrNotificationsUnsupported
+	}
+	rpcSub := notifier.CreateSubscription()
+
+	go func() {
+		inclusions := make(chan *InclusionEvent, simulationChanSize)
+		sub := api.simulator.SubscribeInclusions(inclusions)
+		defer sub.Unsubscribe()
+
+		for {
+			select {
+			case inclusion := <-inclusions:
+				notifier.Notify(rpcSub.ID, inclusion)
+			case <-rpcSub.Err(): // client send an unsubscribe request
+				return
+			case <-notifier.Closed(): // connection dropped
+				return
+			case <-sub.Err(): // simulator stopped
+				return
+			}
+		}
+	}()
+	return rpcSub, nil
+}
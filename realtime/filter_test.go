@@ -0,0 +1,93 @@
+package realtime
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/trace"
+)
+
+func TestSimulationFilter(t *testing.T) {
+	var (
+		from     = common.Address{0x01}
+		to       = common.Address{0x02}
+		callee   = common.Address{0x03}
+		created  = common.Address{0x04}
+		token    = common.Address{0x05}
+		stranger = common.Address{0xff}
+	)
+	call := &trace.TransactionAll{
+		TxReceipt: &trace.TxReceipt{FromAddr: from, ToAddr: &to, Value: big.NewInt(100)},
+		TxTraces: []trace.TraceN{
+			{FromAddr: from, ToAddr: &to},
+			{FromAddr: to, ToAddr: &callee},
+		},
+		TxTransfers: []trace.AssetTransfer{
+			{Standard: trace.StandardETH, From: from, To: to, Amount: big.NewInt(100)},
+			{Standard: trace.StandardERC20, Token: token, From: to, To: from, Amount: big.NewInt(1)},
+		},
+	}
+	creation := &trace.TransactionAll{
+		TxReceipt: &trace.TxReceipt{FromAddr: from, Value: new(big.Int)},
+		TxTraces:  []trace.TraceN{{FromAddr: from, CreateAddr: &created}},
+	}
+	tests := []struct {
+		filter SimulationFilter
+		call   bool
+		create bool
+	}{
+		{SimulationFilter{}, true, true},
+		{SimulationFilter{From: []common.Address{stranger, from}}, true, true},
+		{SimulationFilter{From: []common.Address{stranger}}, false, false},
+		{SimulationFilter{To: []common.Address{to}}, true, false},
+		{SimulationFilter{To: []common.Address{created}}, false, true},
+		{SimulationFilter{Contracts: []common.Address{callee}}, true, false},
+		{SimulationFilter{Contracts: []common.Address{created}}, false, true},
+		{SimulationFilter{Tokens: []common.Address{token}}, true, false},
+		{SimulationFilter{Tokens: []common.Address{{}}}, false, false}, // ether transfers don't count
+		{SimulationFilter{MinValue: (*hexutil.Big)(big.NewInt(100))}, true, false},
+		{SimulationFilter{MinValue: (*hexutil.Big)(big.NewInt(101))}, false, false},
+		{SimulationFilter{From: []common.Address{from}, Tokens: []common.Address{stranger}}, false, false},
+	}
+	for i, tt := range tests {
+		if have := tt.filter.Matches(call); have != tt.call {
+			t.Errorf("test %d: call match mismatch: have %t, want %t", i, have, tt.call)
+		}
+		if have := tt.filter.Matches(creation); have != tt.create {
+			t.Errorf("test %d: creation match mismatch: have %t, want %t", i, have, tt.create)
+		}
+	}
+}
+
+func TestSubscribeSimulations(t *testing.T) {
+	simulator, _ := newTestSimulator(t, false)
+
+	records := make(chan *trace.TransactionAll, 1)
+	sub := simulator.SubscribeSimulations(records)
+	defer sub.Unsubscribe()
+
+	tx := transfer(t, testKey, 0, 1)
+	if _, err := simulator.ExecuteTransaction(tx); err != nil {
+		t.Fatalf("failed to simulate transaction: %v", err)
+	}
+	select {
+	case record := <-records:
+		if record.TxHash != tx.Hash() {
+			t.Errorf("record hash mismatch: have %x, want %x", record.TxHash, tx.Hash())
+		}
+	case <-time.After(time.Second):
+		t.Fatal("simulation record not delivered")
+	}
+	// Failed simulations are not streamed
+	if _, err := simulator.ExecuteTransaction(transfer(t, testKey, 1, 1)); err == nil {
+		t.Fatal("nonce gap simulated")
+	}
+	select {
+	case record := <-records:
+		t.Errorf("failed simulation delivered: %x", record.TxHash)
+	default:
+	}
+}
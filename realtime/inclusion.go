@@ -0,0 +1,230 @@
+package realtime
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/ethereum/go-ethereum/trace"
+	lru "github.com/hashicorp/golang-lru"
+)
+
+const (
+	// actualCacheLimit is the number of records of mined transactions kept
+	// until the blocks they belong to become the head.
+	actualCacheLimit = 8192
+
+	// inclusionCacheLimit is the number of inclusions kept for the API.
+	inclusionCacheLimit = 16384
+
+	// maxCorrelateDepth is the maximum number of blocks correlated at once
+	// when the head advances by several blocks.
+	maxCorrelateDepth = 64
+)
+
+var (
+	includedMeter = metrics.NewRegisteredMeter("realtime/inclusion/included", nil)
+	mismatchMeter = metrics.NewRegisteredMeter("realtime/inclusion/mismatch", nil) // Included with a different outcome
+	droppedMeter  = metrics.NewRegisteredMeter("realtime/inclusion/dropped", nil)
+	reorgedMeter  = metrics.NewRegisteredMeter("realtime/inclusion/reorged", nil)
+)
+
+// historySink receives the trace records of the transactions in imported
+// blocks, so the simulations can be compared with the actual executions.
+type historySink struct {
+	simulator *Simulator
+}
+
+// HistorySink returns a trace sink to be fed with the records of the imported
+// transactions. Without it, simulated transactions are only compared with the
+// status and gas used of their receipts once mined.
+func (simulator *Simulator) HistorySink() trace.Sink {
+	return &historySink{simulator}
+}
+
+// Write implements trace.Sink, keeping the record until its block is
+// correlated.
+func (s *historySink) Write(tx trace.TransactionAll) error {
+	s.simulator.actual.Add(tx.TxHash, &tx)
+	return nil
+}
+
+// Flush implements trace.Sink. Records are kept in memory, so it is a noop.
+func (s *historySink) Flush() error { return nil }
+
+// Close implements trace.Sink. The simulator outlives the blockchain, so it is
+// a noop.
+func (s *historySink) Close() error { return nil }
+
+// SubscribeInclusions registers a subscription notified whenever the fate of a
+// simulated transaction becomes known.
+func (simulator *Simulator) SubscribeInclusions(ch chan<- *InclusionEvent) event.Subscription {
+	return simulator.scope.Track(simulator.inclusionFeed.Subscribe(ch))
+}
+
+// InclusionEvent is posted when a simulated transaction is mined, replaced or
+// dropped, or the block it was mined in is reorged out.
+type InclusionEvent struct {
+	TxHash    common.Hash      `json:"txHash"`
+	Inclusion *trace.Inclusion `json:"inclusion"`
+}
+
+// Inclusion returns the last known fate of a simulated transaction, or nil if
+// it is unknown or still pending.
+func (simulator *Simulator) Inclusion(hash common.Hash) *trace.Inclusion {
+	if inclusion, ok := simulator.inclusions.Get(hash); ok {
+		return inclusion.(*trace.Inclusion)
+	}
+	return nil
+}
+
+// correlateHead correlates the simulated transactions with the blocks which
+// became canonical up to the new head, oldest first.
+func (simulator *Simulator) correlateHead(head *types.Block) {
+	blocks := []*types.Block{head}
+	for parent := head; len(blocks) < maxCorrelateDepth && parent.NumberU64() > simulator.correlated+1 && simulator.correlated > 0; {
+		if parent = simulator.chain.GetBlock(parent.ParentHash(), parent.NumberU64()-1); parent == nil {
+			break
+		}
+		blocks = append(blocks, parent)
+	}
+	for i := len(blocks) - 1; i >= 0; i-- {
+		simulator.correlate(blocks[i])
+	}
+	simulator.correlated = head.NumberU64()
+}
+
+// correlate marks the simulated transactions mined in the block as included,
+// comparing their simulated outcome with the actual one, and those superseded
+// by a mined transaction as replaced or dropped.
+func (simulator *Simulator) correlate(block *types.Block) {
+	receipts := simulator.chain.GetReceiptsByHash(block.Hash())
+	if len(receipts) != len(block.Transactions()) {
+		log.Warn("Missing receipts of correlated block", "number", block.Number(), "hash", block.Hash())
+		return
+	}
+	signer := types.MakeSigner(simulator.chainConfig, block.Number())
+	for i, tx := range block.Transactions() {
+		from, err := types.Sender(signer, tx)
+		if err != nil {
+			continue
+		}
+		var (
+			hash      = tx.Hash()
+			slot      = simulator.simTxPool.resolve(from, tx.Nonce())
+			simulated = false
+		)
+		for _, known := range slot {
+			if known.Hash() == hash {
+				simulated = true
+			}
+		}
+		for _, known := range slot {
+			if known.Hash() == hash {
+				continue
+			}
+			// Another transaction took the nonce, either one seen replacing
+			// this one or one which never reached the simulator
+			inclusion := &trace.Inclusion{
+				Status:      trace.InclusionDropped,
+				BlockNumber: block.NumberU64(),
+				BlockHash:   block.Hash(),
+				TxIndex:     uint64(i),
+				ReplacedBy:  &hash,
+			}
+			if simulated {
+				inclusion.Status = trace.InclusionReplaced
+			}
+			simulator.settle(known.Hash(), inclusion)
+		}
+		// Transactions reorged out and mined again are no longer in the pool
+		if prev := simulator.Inclusion(hash); prev != nil && prev.Status == trace.InclusionReorged {
+			simulated = true
+		}
+		if !simulated {
+			continue
+		}
+		inclusion := &trace.Inclusion{
+			Status:      trace.InclusionIncluded,
+			BlockNumber: block.NumberU64(),
+			BlockHash:   block.Hash(),
+			TxIndex:     uint64(i),
+		}
+		if record := simulator.Result(hash); record != nil {
+			// Only the rolling pending state gives simulations a position
+			if simulator.rolling {
+				index := record.TxReceipt.TxIndex
+				inclusion.SimIndex = &index
+			}
+			if actual, ok := simulator.actual.Get(hash); ok {
+				inclusion.Diff = trace.DiffRecords(record, actual.(*trace.TransactionAll))
+			} else {
+				inclusion.Diff = trace.DiffReceipt(record, receipts[i].Status, receipts[i].GasUsed)
+			}
+			if len(inclusion.Diff.Mismatches) > 0 {
+				mismatchMeter.Mark(1)
+			}
+		}
+		simulator.settle(hash, inclusion)
+	}
+}
+
+// uncorrelate marks the transactions mined in a block which left the canonical
+// chain as reorged.
+func (simulator *Simulator) uncorrelate(block *types.Block) {
+	for _, tx := range block.Transactions() {
+		prev := simulator.Inclusion(tx.Hash())
+		if prev == nil || prev.BlockHash != block.Hash() || prev.Status != trace.InclusionIncluded {
+			continue
+		}
+		inclusion := *prev
+		inclusion.Status = trace.InclusionReorged
+		simulator.settle(tx.Hash(), &inclusion)
+	}
+}
+
+// expire marks the simulated transactions evicted from the pool without being
+// mined as dropped.
+func (simulator *Simulator) expire(hashes []common.Hash) {
+	for _, hash := range hashes {
+		if simulator.Inclusion(hash) == nil {
+			simulator.settle(hash, &trace.Inclusion{Status: trace.InclusionDropped})
+		}
+	}
+}
+
+// settle records the fate of a simulated transaction, notifying subscribers
+// and writing its simulation record again along with its inclusion, which
+// supersedes the record stored when it was simulated.
+func (simulator *Simulator) settle(hash common.Hash, inclusion *trace.Inclusion) {
+	switch inclusion.Status {
+	case trace.InclusionIncluded:
+		includedMeter.Mark(1)
+	case trace.InclusionReplaced, trace.InclusionDropped:
+		droppedMeter.Mark(1)
+	case trace.InclusionReorged:
+		reorgedMeter.Mark(1)
+	}
+	simulator.inclusions.Add(hash, inclusion)
+	simulator.inclusionFeed.Send(&InclusionEvent{TxHash: hash, Inclusion: inclusion})
+
+	if simulator.sink == nil {
+		return
+	}
+	if record := simulator.Result(hash); record != nil {
+		settled := *record
+		settled.TxInclusion = inclusion
+		if err := simulator.sink.Write(settled); err != nil {
+			log.Warn("Failed to write simulation inclusion", "hash", hash, "err", err)
+		}
+	}
+}
+
+// newInclusionCaches creates the caches of the mined transaction records and
+// of the inclusions.
+func newInclusionCaches() (*lru.Cache, *lru.Cache) {
+	actual, _ := lru.New(actualCacheLimit)
+	inclusions, _ := lru.New(inclusionCacheLimit)
+	return actual, inclusions
+}
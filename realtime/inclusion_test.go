@@ -0,0 +1,157 @@
+package realtime
+
+import (
+	"testing"
+
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/trace"
+)
+
+// mineBlock imports a block with the given transactions on top of the genesis.
+func mineBlock(t *testing.T, simulator *Simulator, txs ...*types.Transaction) *types.Block {
+	db := rawdb.NewMemoryDatabase()
+	genesis := testGenesis().MustCommit(db)
+	blocks, _ := core.GenerateChain(params.TestChainConfig, genesis, ethash.NewFaker(), db, 1, func(i int, gen *core.BlockGen) {
+		for _, tx := range txs {
+			gen.AddTx(tx)
+		}
+	})
+	if _, err := simulator.chain.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to import block: %v", err)
+	}
+	return blocks[0]
+}
+
+func TestInclusion(t *testing.T) {
+	simulator, sink := newTestSimulator(t, false)
+	simulator.chain.SetTraceSink(simulator.HistorySink())
+
+	var (
+		lone     = transfer(t, otherKey, 0, 1)
+		first    = transfer(t, testKey, 0, 100)
+		second   = transfer(t, testKey, 0, 110) // replaces first
+		stale    = transfer(t, otherKey, 1, 1)
+		unknown  = transfer(t, otherKey, 1, 2) // takes the nonce of stale
+		upcoming = transfer(t, testKey, 1, 100)
+	)
+	for _, tx := range []*types.Transaction{lone, first, second, stale, upcoming} {
+		if _, errs := simulator.admit([]*types.Transaction{tx}); errs[0] != nil {
+			t.Fatalf("transaction %x not admitted: %v", tx.Hash(), errs[0])
+		}
+	}
+	for _, tx := range []*types.Transaction{lone, second} {
+		if _, err := simulator.ExecuteTransaction(tx); err != nil {
+			t.Fatalf("failed to simulate transaction %x: %v", tx.Hash(), err)
+		}
+	}
+	events := make(chan *InclusionEvent, 10)
+	sub := simulator.SubscribeInclusions(events)
+	defer sub.Unsubscribe()
+
+	block := mineBlock(t, simulator, lone, second, unknown)
+	simulator.correlateHead(block)
+
+	// Both simulations were mined with the outcome they were simulated with.
+	// Simulated in isolation, they have no position to compare against.
+	for i, tx := range []*types.Transaction{lone, second} {
+		inclusion := simulator.Inclusion(tx.Hash())
+		if inclusion == nil || inclusion.Status != trace.InclusionIncluded {
+			t.Fatalf("transaction %d: inclusion mismatch: have %+v", i, inclusion)
+		}
+		if _, ok := inclusion.IndexDelta(); inclusion.BlockHash != block.Hash() || inclusion.TxIndex != uint64(i) || ok {
+			t.Errorf("transaction %d: position mismatch: have %+v", i, inclusion)
+		}
+		if diff := inclusion.Diff; diff == nil || !diff.Traced || len(diff.Mismatches) != 0 {
+			t.Errorf("transaction %d: outcome diff mismatch: have %+v", i, diff)
+		}
+	}
+	if inclusion := simulator.Inclusion(first.Hash()); inclusion == nil || inclusion.Status != trace.InclusionReplaced || *inclusion.ReplacedBy != second.Hash() {
+		t.Errorf("replaced transaction inclusion mismatch: have %+v", inclusion)
+	}
+	if inclusion := simulator.Inclusion(stale.Hash()); inclusion == nil || inclusion.Status != trace.InclusionDropped || *inclusion.ReplacedBy != unknown.Hash() {
+		t.Errorf("dropped transaction inclusion mismatch: have %+v", inclusion)
+	}
+	if inclusion := simulator.Inclusion(upcoming.Hash()); inclusion != nil {
+		t.Errorf("pending transaction settled: %+v", inclusion)
+	}
+	for _, tx := range []*types.Transaction{lone, first, second, stale} {
+		if status := simulator.simTxPool.Get(tx.Hash()); status != TxStatusUnknown {
+			t.Errorf("settled transaction %x still tracked: %v", tx.Hash(), status)
+		}
+	}
+	if len(events) != 4 {
+		t.Errorf("inclusion event count mismatch: have %d, want 4", len(events))
+	}
+	// Only the simulated transactions have a record to write again, which
+	// supersedes the one written when they were simulated
+	records := sink.Records()
+	if len(records) != 2 {
+		t.Fatalf("record count mismatch: have %d, want 2", len(records))
+	}
+	for i, tx := range []*types.Transaction{lone, second} {
+		if records[i].TxHash != tx.Hash() || records[i].TxInclusion == nil || records[i].TxInclusion.Status != trace.InclusionIncluded {
+			t.Errorf("record %d mismatch: have %x with inclusion %+v", i, records[i].TxHash, records[i].TxInclusion)
+		}
+	}
+	// A reorg unmarks the inclusions, until the transactions are mined again
+	simulator.uncorrelate(block)
+	if inclusion := simulator.Inclusion(lone.Hash()); inclusion.Status != trace.InclusionReorged {
+		t.Errorf("reorged transaction status mismatch: have %s, want %s", inclusion.Status, trace.InclusionReorged)
+	}
+	simulator.correlate(block)
+	if inclusion := simulator.Inclusion(lone.Hash()); inclusion.Status != trace.InclusionIncluded {
+		t.Errorf("remined transaction status mismatch: have %s, want %s", inclusion.Status, trace.InclusionIncluded)
+	}
+}
+
+func TestInclusionReceiptDiff(t *testing.T) {
+	simulator, _ := newTestSimulator(t, false)
+
+	tx := transfer(t, testKey, 0, 1)
+	if _, errs := simulator.admit([]*types.Transaction{tx}); errs[0] != nil {
+		t.Fatalf("transaction not admitted: %v", errs[0])
+	}
+	if _, err := simulator.ExecuteTransaction(tx); err != nil {
+		t.Fatalf("failed to simulate transaction: %v", err)
+	}
+	// Without the history records, only the receipts are compared
+	simulator.correlateHead(mineBlock(t, simulator, tx))
+
+	inclusion := simulator.Inclusion(tx.Hash())
+	if inclusion == nil || inclusion.Diff == nil {
+		t.Fatalf("inclusion mismatch: have %+v", inclusion)
+	}
+	if diff := inclusion.Diff; diff.Traced || len(diff.Mismatches) != 0 || diff.ActualGasUsed != params.TxGas {
+		t.Errorf("outcome diff mismatch: have %+v", diff)
+	}
+}
+
+func TestInclusionRollingIndex(t *testing.T) {
+	simulator, _ := newTestSimulator(t, true)
+
+	// Stacked by price, the pricier transaction is simulated first
+	cheap, pricey := transfer(t, otherKey, 0, 1), transfer(t, testKey, 0, 2)
+	for _, tx := range []*types.Transaction{cheap, pricey} {
+		if _, errs := simulator.admit([]*types.Transaction{tx}); errs[0] != nil {
+			t.Fatalf("transaction %x not admitted: %v", tx.Hash(), errs[0])
+		}
+		if _, err := simulator.ExecuteTransaction(tx); err != nil {
+			t.Fatalf("failed to simulate transaction %x: %v", tx.Hash(), err)
+		}
+	}
+	simulator.correlateHead(mineBlock(t, simulator, cheap, pricey))
+
+	for i, tx := range []*types.Transaction{cheap, pricey} {
+		inclusion := simulator.Inclusion(tx.Hash())
+		if inclusion == nil || inclusion.SimIndex == nil || *inclusion.SimIndex != uint64(1-i) {
+			t.Fatalf("transaction %d: simulation index mismatch: have %+v", i, inclusion)
+		}
+		if delta, ok := inclusion.IndexDelta(); !ok || delta != int64(2*i-1) {
+			t.Errorf("transaction %d: index delta mismatch: have %d, want %d", i, delta, 2*i-1)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package realtime
+
+import (
+	"errors"
+	"io"
+	"os"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// errNoActiveJournal is returned if a transaction is attempted to be inserted
+// into the journal, but no such file is currently open.
+var errNoActiveJournal = errors.New("no active journal")
+
+// devNull is a WriteCloser that just discards anything written into it, used
+// while loading the journal so the loaded entries are not written back.
+type devNull struct{}
+
+func (*devNull) Write(p []byte) (n int, err error) { return len(p), nil }
+func (*devNull) Close() error                      { return nil }
+
+// journalEntry is a transaction tracked by the simulation pool, as stored in
+// the journal.
+type journalEntry struct {
+	Tx     *types.Transaction
+	Status uint64 // TxStatusQueued or TxStatusExecuted
+	Time   uint64 // unix time the transaction was first tracked at
+}
+
+// simJournal is a rotating log of the queued and simulated transactions, so
+// they are neither lost nor simulated again after a node restart. It mirrors
+// the transaction pool's journal.
+type simJournal struct {
+	path   string         // Filesystem path to store the entries at
+	writer io.WriteCloser // Output stream to write new entries into
+}
+
+// newSimJournal creates a new simulation journal at the given path.
+func newSimJournal(path string) *simJournal {
+	return &simJournal{
+		path: path,
+	}
+}
+
+// load parses a journal dump from disk, restoring its entries through the given
+// function.
+func (journal *simJournal) load(restore func([]journalEntry) []error) error {
+	// Skip the parsing if the journal file doesn't exist at all
+	if _, err := os.Stat(journal.path); os.IsNotExist(err) {
+		return nil
+	}
+	input, err := os.Open(journal.path)
+	if err != nil {
+		return err
+	}
+	defer input.Close()
+
+	// Temporarily discard any journal additions (don't double add on load)
+	journal.writer = new(devNull)
+	defer func() { journal.writer = nil }()
+
+	stream := rlp.NewStream(input, 0)
+	total, dropped := 0, 0
+
+	loadBatch := func(entries []journalEntry) {
+		for _, err := range restore(entries) {
+			if err != nil {
+				log.Debug("Failed to restore journaled simulation", "err", err)
+				dropped++
+			}
+		}
+	}
+	var (
+		failure error
+		batch   []journalEntry
+	)
+	for {
+		// Parse the next entry and terminate on error
+		var entry journalEntry
+		if err = stream.Decode(&entry); err != nil {
+			if err != io.EOF {
+				failure = err
+			}
+			if len(batch) > 0 {
+				loadBatch(batch)
+			}
+			break
+		}
+		total++
+
+		if batch = append(batch, entry); len(batch) > 1024 {
+			loadBatch(batch)
+			batch = batch[:0]
+		}
+	}
+	log.Info("Loaded simulation journal", "transactions", total, "dropped", dropped)
+
+	return failure
+}
+
+// insert adds the specified entry to the journal.
+func (journal *simJournal) insert(entry journalEntry) error {
+	if journal.writer == nil {
+		return errNoActiveJournal
+	}
+	return rlp.Encode(journal.writer, &entry)
+}
+
+// rotate regenerates the journal based on the current contents of the
+// simulation pool.
+func (journal *simJournal) rotate(entries []journalEntry) error {
+	// Close the current journal (if any is open)
+	if journal.writer != nil {
+		if err := journal.writer.Close(); err != nil {
+			return err
+		}
+		journal.writer = nil
+	}
+	// Generate a new journal with the contents of the current pool
+	replacement, err := os.OpenFile(journal.path+".new", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0755)
+	if err != nil {
+		return err
+	}
+	for i := range entries {
+		if err = rlp.Encode(replacement, &entries[i]); err != nil {
+			replacement.Close()
+			return err
+		}
+	}
+	replacement.Close()
+
+	// Replace the live journal with the newly generated one
+	if err = os.Rename(journal.path+".new", journal.path); err != nil {
+		return err
+	}
+	sink, err := os.OpenFile(journal.path, os.O_WRONLY|os.O_APPEND, 0755)
+	if err != nil {
+		return err
+	}
+	journal.writer = sink
+	log.Info("Regenerated simulation journal", "transactions", len(entries))
+
+	return nil
+}
+
+// close flushes the journal contents to disk and closes the file.
+func (journal *simJournal) close() error {
+	var err error
+
+	if journal.writer != nil {
+		err = journal.writer.Close()
+		journal.writer = nil
+	}
+	return err
+}
@@ -0,0 +1,78 @@
+package realtime
+
+import (
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// Kinds of pending transactions the simulator can be configured to simulate,
+// see trace.Config.Kinds.
+const (
+	KindCall        = "call"        // message call to a contract
+	KindCreate      = "create"      // contract deployment
+	KindTransfer    = "transfer"    // plain call to an externally owned account
+	KindUnprotected = "unprotected" // signed without EIP155 replay protection, in addition to the above
+)
+
+// kindFilter is the set of transaction kinds enabled for simulation.
+type kindFilter map[string]bool
+
+// newKindFilter creates the filter enabling the given kinds, ignoring unknown
+// ones.
+func newKindFilter(kinds []string) kindFilter {
+	filter := make(kindFilter)
+	for _, kind := range kinds {
+		switch kind = strings.ToLower(strings.TrimSpace(kind)); kind {
+		case KindCall, KindCreate, KindTransfer, KindUnprotected:
+			filter[kind] = true
+		default:
+			log.Warn("Ignoring unknown simulated transaction kind", "kind", kind)
+		}
+	}
+	return filter
+}
+
+// checkKind returns the error rejecting a transaction if its kind is disabled.
+// The recipient of a message call counts as a contract if it has code either
+// in the head state or, in rolling mode, in the pending state, so calls to
+// contracts deployed by pending transactions are simulated as such.
+func (simulator *Simulator) checkKind(tx *types.Transaction, head *state.StateDB) error {
+	if !tx.Protected() && !simulator.kinds[KindUnprotected] {
+		return SimErrUnprotected
+	}
+	to := tx.To()
+	switch {
+	case to == nil:
+		if !simulator.kinds[KindCreate] {
+			return SimErrCreation
+		}
+	case simulator.isContract(*to, head):
+		if !simulator.kinds[KindCall] {
+			return SimErrToContract
+		}
+	default:
+		if !simulator.kinds[KindTransfer] {
+			return SimErrToEOA
+		}
+	}
+	return nil
+}
+
+// isContract reports whether the account has code in the head state or the
+// pending state.
+func (simulator *Simulator) isContract(addr common.Address, head *state.StateDB) bool {
+	if head.GetCodeSize(addr) > 0 {
+		return true
+	}
+	if !simulator.rolling {
+		return false
+	}
+	simulator.pendingLock.Lock()
+	defer simulator.pendingLock.Unlock()
+
+	return simulator.pending != nil && simulator.pending.state.GetCodeSize(addr) > 0
+}
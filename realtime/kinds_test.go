@@ -0,0 +1,110 @@
+package realtime
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// deployCode is the init code of a contract whose runtime code is a single STOP.
+var deployCode = common.FromHex("0x600060005360016000f3")
+
+func TestAdmitKinds(t *testing.T) {
+	var (
+		eip155    = types.NewEIP155Signer(params.TestChainConfig.ChainID)
+		call      = transfer(t, testKey, 0, 1)
+		create    = signTx(t, eip155, types.NewContractCreation(0, new(big.Int), 100000, big.NewInt(1), deployCode))
+		toEOA     = signTx(t, eip155, types.NewTransaction(0, common.Address{0xee}, big.NewInt(1), 30000, big.NewInt(1), nil))
+		homestead = signTx(t, types.HomesteadSigner{}, types.NewTransaction(0, testContract, big.NewInt(1), 30000, big.NewInt(1), nil))
+	)
+	tests := []struct {
+		kinds []string
+		tx    *types.Transaction
+		err   error
+	}{
+		{[]string{KindCall}, call, nil},
+		{[]string{KindCreate, KindTransfer}, call, SimErrToContract},
+		{[]string{KindCreate}, create, nil},
+		{[]string{KindCall}, create, SimErrCreation},
+		{[]string{KindTransfer}, toEOA, nil},
+		{[]string{KindCall}, toEOA, SimErrToEOA},
+		{[]string{KindCall, KindUnprotected}, homestead, nil},
+		{[]string{KindCall}, homestead, SimErrUnprotected},
+	}
+	for i, tt := range tests {
+		simulator, _ := newTestSimulator(t, false)
+		simulator.kinds = newKindFilter(tt.kinds)
+
+		news, errs := simulator.admit([]*types.Transaction{tt.tx})
+		if errs[0] != tt.err {
+			t.Errorf("test %d: admission error mismatch: have %v, want %v", i, errs[0], tt.err)
+		}
+		if admitted := len(news) == 1; admitted != (tt.err == nil) {
+			t.Errorf("test %d: admission mismatch: have %t, want %t", i, admitted, tt.err == nil)
+		}
+	}
+}
+
+func TestSimulateUnprotected(t *testing.T) {
+	simulator, sink := newTestSimulator(t, false)
+
+	tx := signTx(t, types.HomesteadSigner{}, types.NewTransaction(0, testContract, big.NewInt(1), 30000, big.NewInt(1), nil))
+	if _, err := simulator.ExecuteTransaction(tx); err != nil {
+		t.Fatalf("failed to simulate unprotected transaction: %v", err)
+	}
+	if records := sink.Records(); len(records) != 1 || records[0].TxReceipt.FromAddr != testAddress {
+		t.Fatalf("unprotected simulation mismatch: have %d records", len(records))
+	}
+}
+
+func TestRollingDeployThenCall(t *testing.T) {
+	simulator, sink := newTestSimulator(t, true)
+	simulator.kinds = newKindFilter([]string{KindCall, KindCreate})
+
+	var (
+		signer   = types.NewEIP155Signer(params.TestChainConfig.ChainID)
+		deployed = crypto.CreateAddress(testAddress, 0)
+		deploy   = signTx(t, signer, types.NewContractCreation(0, new(big.Int), 100000, big.NewInt(1), deployCode))
+		call     = signTx(t, signer, types.NewTransaction(1, deployed, new(big.Int), 30000, big.NewInt(1), nil))
+	)
+	// Before the deployment is stacked, the recipient looks like an account
+	if _, errs := simulator.admit([]*types.Transaction{call}); errs[0] != SimErrToEOA {
+		t.Fatalf("call to undeployed contract admitted: %v", errs[0])
+	}
+	news, errs := simulator.admit([]*types.Transaction{deploy})
+	if len(news) != 1 || errs[0] != nil {
+		t.Fatalf("deployment not admitted: %v", errs[0])
+	}
+	if _, err := simulator.ExecuteTransaction(deploy); err != nil {
+		t.Fatalf("failed to simulate deployment: %v", err)
+	}
+	// Once it is, the call follows the deployment on the pending state
+	if news, errs := simulator.admit([]*types.Transaction{call}); len(news) != 1 || errs[0] != nil {
+		t.Fatalf("call to deployed contract not admitted: %v", errs[0])
+	}
+	if _, err := simulator.ExecuteTransaction(call); err != nil {
+		t.Fatalf("failed to simulate call: %v", err)
+	}
+	records := sink.Records()
+	if len(records) != 2 {
+		t.Fatalf("simulation records mismatch: have %d, want 2", len(records))
+	}
+	if created := records[0].TxTraces[0].CreateAddr; created == nil || *created != deployed {
+		t.Errorf("created address mismatch: have %v, want %x", created, deployed)
+	}
+	if to := records[1].TxReceipt.ToAddr; to == nil || *to != deployed || records[1].TxReceipt.Status != types.ReceiptStatusSuccessful {
+		t.Errorf("call mismatch: have to %v status %d", to, records[1].TxReceipt.Status)
+	}
+}
+
+func signTx(t *testing.T, signer types.Signer, tx *types.Transaction) *types.Transaction {
+	signed, err := types.SignTx(tx, signer, testKey)
+	if err != nil {
+		t.Fatalf("failed to sign transaction: %v", err)
+	}
+	return signed
+}
@@ -0,0 +1,226 @@
+package realtime
+
+import (
+	"errors"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/trace"
+)
+
+// pendingState is the pending block the simulated transactions are stacked on
+// in rolling mode. Like the miner's environment, transactions are applied
+// cumulatively, so each one sees the effects of those simulated before it.
+type pendingState struct {
+	signer  types.Signer
+	header  *types.Header
+	state   *state.StateDB
+	gasPool *core.GasPool
+	txs     []*types.Transaction // transactions applied so far, in order
+}
+
+// errNotStacked is returned if a transaction was left out of a rebuilt pending
+// state because an earlier transaction of its sender couldn't be included.
+var errNotStacked = errors.New("transaction not stacked")
+
+// stackedResult is the outcome of a transaction applied to the pending state.
+type stackedResult struct {
+	tx        *types.Transaction
+	receipt   *types.Receipt
+	collector *trace.TraceCollector
+}
+
+// resetPending rebuilds the pending state on top of the given head block. The
+// transactions of the previous pending state are replayed ordered by gas price
+// and nonce, the way the miner would include them; those mined in the meantime
+// or no longer executable are dropped. Replayed transactions are not recorded
+// again.
+func (simulator *Simulator) resetPending(head *types.Block) error {
+	_, err := simulator.rebuildPending(head, nil)
+	return err
+}
+
+// rebuildPending rebuilds the pending state on top of the given head block like
+// resetPending, adding insert, if given, at its gas price and nonce position
+// among the stacked transactions. The outcome of insert and of the stacked
+// ones which changed position is returned, or the error which kept it out.
+func (simulator *Simulator) rebuildPending(head *types.Block, insert *types.Transaction) ([]*stackedResult, error) {
+	statedb, err := simulator.chain.StateAt(head.Root())
+	if err != nil {
+		return nil, err
+	}
+	pending := &pendingState{
+		signer: types.MakeSigner(simulator.chainConfig, head.Number()),
+		header: simulator.simulationHeader(head),
+		state:  statedb.Copy(),
+	}
+	pending.gasPool = new(core.GasPool).AddGas(pending.header.GasLimit)
+
+	simulator.pendingLock.Lock()
+	defer simulator.pendingLock.Unlock()
+
+	var stacked []*types.Transaction
+	if simulator.pending != nil {
+		stacked = simulator.pending.txs
+	}
+	simulator.pending = pending
+
+	positions := make(map[common.Hash]int, len(stacked))
+	for i, tx := range stacked {
+		positions[tx.Hash()] = i
+	}
+	if insert != nil {
+		stacked = append(stacked[:len(stacked):len(stacked)], insert)
+	}
+	bySender := make(map[common.Address]types.Transactions)
+	for _, tx := range stacked {
+		from, err := types.Sender(pending.signer, tx)
+		if err != nil {
+			continue
+		}
+		bySender[from] = append(bySender[from], tx)
+	}
+	for _, list := range bySender {
+		sort.Sort(types.TxByNonce(list))
+	}
+	var (
+		results []*stackedResult
+		failure = errNotStacked
+	)
+	txs := types.NewTransactionsByPriceAndNonce(pending.signer, bySender)
+	for next := txs.Peek(); next != nil; next = txs.Peek() {
+		receipt, collector, err := simulator.applyPending(next)
+		if insert != nil {
+			if next.Hash() == insert.Hash() {
+				failure = err
+			}
+			if pos, ok := positions[next.Hash()]; err == nil && (!ok || pos != len(pending.txs)-1) {
+				results = append(results, &stackedResult{tx: next, receipt: receipt, collector: collector})
+			}
+		}
+		switch {
+		case errors.Is(err, core.ErrGasLimitReached), errors.Is(err, core.ErrNonceTooHigh):
+			// Skip the rest of the sender's transactions
+			txs.Pop()
+		default:
+			// Mined, replayed or failed, move on to the next one
+			txs.Shift()
+		}
+	}
+	log.Debug("Rebuilt pending simulation state", "number", pending.header.Number, "stacked", len(stacked), "replayed", len(pending.txs))
+
+	if insert != nil && failure != nil {
+		return nil, failure
+	}
+	return results, nil
+}
+
+// applyPending applies a transaction on top of the pending state, keeping its
+// effects for the transactions simulated later. Transactions which can't be
+// included leave the pending state untouched. The caller must hold the pending
+// lock.
+func (simulator *Simulator) applyPending(tx *types.Transaction) (*types.Receipt, *trace.TraceCollector, error) {
+	pending := simulator.pending
+
+	snap, gas := pending.state.Snapshot(), pending.gasPool.Gas()
+	pending.state.Prepare(tx.Hash(), common.Hash{}, len(pending.txs))
+
+	receipt, collector, err := core.RTApplyTransaction(simulator.chainConfig, simulator.chain, nil, pending.gasPool, pending.state, pending.header, tx, &pending.header.GasUsed, *simulator.chain.GetVMConfig())
+	if err != nil {
+		pending.state.RevertToSnapshot(snap)
+		*pending.gasPool = core.GasPool(gas)
+		return nil, nil, err
+	}
+	pending.state.Finalise(simulator.chainConfig.IsEIP158(pending.header.Number))
+	pending.txs = append(pending.txs, tx)
+	return receipt, collector, nil
+}
+
+// simulatePending simulates a transaction on a copy of the pending state,
+// leaving the pending state itself untouched.
+func (simulator *Simulator) simulatePending(tx *types.Transaction) (*types.Receipt, *trace.TraceCollector, error) {
+	simulator.pendingLock.Lock()
+	pending := simulator.pending
+	if pending == nil {
+		simulator.pendingLock.Unlock()
+		return simulator.executeIsolated(tx, nil)
+	}
+	var (
+		header  = types.CopyHeader(pending.header)
+		statedb = pending.state.Copy()
+		gasPool = *pending.gasPool
+		index   = len(pending.txs)
+	)
+	simulator.pendingLock.Unlock()
+
+	statedb.Prepare(tx.Hash(), common.Hash{}, index)
+	return core.RTApplyTransaction(simulator.chainConfig, simulator.chain, nil, &gasPool, statedb, header, tx, &header.GasUsed, *simulator.chain.GetVMConfig())
+}
+
+// executePending simulates a transaction on top of the pending state, building
+// the state first if there is none yet. A transaction the miner would include
+// ahead of stacked ones, or replacing one, is inserted at its position in the
+// rebuilt state instead. The outcome of the transaction comes first, followed
+// by the stacked transactions which changed position.
+func (simulator *Simulator) executePending(tx *types.Transaction) ([]*stackedResult, error) {
+	simulator.pendingLock.Lock()
+	if simulator.pending != nil {
+		for _, stacked := range simulator.pending.txs {
+			if stacked.Hash() == tx.Hash() {
+				simulator.pendingLock.Unlock()
+				return nil, SimErrAlreadyExecuted
+			}
+		}
+	}
+	exists := simulator.pending != nil
+	// A replacement takes the place of the transaction it supersedes, so the
+	// pending state is rebuilt without the latter. The sender's later
+	// transactions can't be replayed before the replacement and are dropped.
+	replaces := exists && simulator.pending.unstack(tx)
+	if exists && !replaces && !simulator.pending.outranks(tx) {
+		defer simulator.pendingLock.Unlock()
+
+		receipt, collector, err := simulator.applyPending(tx)
+		if err != nil {
+			return nil, err
+		}
+		return []*stackedResult{{tx: tx, receipt: receipt, collector: collector}}, nil
+	}
+	simulator.pendingLock.Unlock()
+
+	results, err := simulator.rebuildPending(simulator.chain.CurrentBlock(), tx)
+	if err != nil {
+		return nil, err
+	}
+	for i, result := range results {
+		if result.tx.Hash() == tx.Hash() {
+			results[0], results[i] = results[i], results[0]
+			break
+		}
+	}
+	return results, nil
+}
+
+// outranks reports whether the miner would include tx ahead of a stacked
+// transaction of another sender following the last one of its own sender, so
+// it can't simply be stacked on top.
+func (pending *pendingState) outranks(tx *types.Transaction) bool {
+	from, err := types.Sender(pending.signer, tx)
+	if err != nil {
+		return false
+	}
+	for i := len(pending.txs) - 1; i >= 0; i-- {
+		stacked := pending.txs[i]
+		if sender, _ := types.Sender(pending.signer, stacked); sender == from {
+			return false
+		}
+		if stacked.GasPriceCmp(tx) < 0 {
+			return true
+		}
+	}
+	return false
+}
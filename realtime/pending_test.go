@@ -0,0 +1,143 @@
+package realtime
+
+import (
+	"crypto/ecdsa"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/trace"
+)
+
+var (
+	testKey, _   = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+	testAddress  = crypto.PubkeyToAddress(testKey.PublicKey)
+	otherKey, _  = crypto.HexToECDSA("8a1f9a8f95be41cd7ccb6168179afb4504aefe388d1e14474d32c45c72ce7b7a")
+	testContract = common.Address{0xcc}
+)
+
+// testGenesis returns the genesis funding both test accounts.
+func testGenesis() *core.Genesis {
+	return &core.Genesis{
+		Config: params.TestChainConfig,
+		Alloc: core.GenesisAlloc{
+			testAddress: {Balance: big.NewInt(params.Ether)},
+			crypto.PubkeyToAddress(otherKey.PublicKey): {Balance: big.NewInt(params.Ether)},
+			testContract: {Balance: new(big.Int), Code: []byte{0x00}},
+		},
+	}
+}
+
+// newTestSimulator creates a simulator on top of a fresh chain funding both
+// test accounts, writing its records to the returned sink.
+func newTestSimulator(t *testing.T, rolling bool) (*Simulator, *trace.MemorySink) {
+	var (
+		db    = rawdb.NewMemoryDatabase()
+		gspec = testGenesis()
+	)
+	gspec.MustCommit(db)
+	chain, err := core.NewBlockChain(db, nil, gspec.Config, ethash.NewFaker(), vm.Config{}, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create chain: %v", err)
+	}
+	t.Cleanup(chain.Stop)
+
+	sink := trace.NewMemorySink()
+	actual, inclusions := newInclusionCaches()
+	return &Simulator{
+		chainConfig: gspec.Config,
+		chain:       chain,
+		simTxPool:   NewSimTxPool(SimTxPoolConfig{}, gspec.Config, chain),
+		sink:        sink,
+		results:     newResultCache(),
+		actual:      actual,
+		inclusions:  inclusions,
+		rolling:     rolling,
+		kinds:       newKindFilter(trace.DefaultConfig.Kinds),
+	}, sink
+}
+
+func transfer(t *testing.T, key *ecdsa.PrivateKey, nonce uint64, gasPrice int64) *types.Transaction {
+	signer := types.NewEIP155Signer(params.TestChainConfig.ChainID)
+	tx, err := types.SignTx(types.NewTransaction(nonce, testContract, big.NewInt(1000), 30000, big.NewInt(gasPrice), nil), signer, key)
+	if err != nil {
+		t.Fatalf("failed to sign transaction: %v", err)
+	}
+	return tx
+}
+
+func TestIsolatedSimulation(t *testing.T) {
+	simulator, sink := newTestSimulator(t, false)
+
+	if _, err := simulator.ExecuteTransaction(transfer(t, testKey, 0, 1)); err != nil {
+		t.Fatalf("failed to simulate first transaction: %v", err)
+	}
+	// Each transaction runs on the head state, so the follow-up can't execute
+	if _, err := simulator.ExecuteTransaction(transfer(t, testKey, 1, 1)); err == nil {
+		t.Fatal("follow-up transaction simulated in isolated mode")
+	}
+	if have := len(sink.Records()); have != 1 {
+		t.Errorf("record count mismatch: have %d, want 1", have)
+	}
+}
+
+func TestRollingSimulation(t *testing.T) {
+	simulator, sink := newTestSimulator(t, true)
+
+	cheap, first, second := transfer(t, otherKey, 0, 1), transfer(t, testKey, 0, 2), transfer(t, testKey, 1, 2)
+	for _, tx := range []*types.Transaction{cheap, first, second} {
+		if _, err := simulator.ExecuteTransaction(tx); err != nil {
+			t.Fatalf("failed to simulate transaction %x: %v", tx.Hash(), err)
+		}
+	}
+	if _, err := simulator.ExecuteTransaction(first); err != SimErrAlreadyExecuted {
+		t.Errorf("stacked transaction error mismatch: have %v, want %v", err, SimErrAlreadyExecuted)
+	}
+	// The pricier transactions arriving later are stacked ahead of the cheap one
+	want := []common.Hash{first.Hash(), second.Hash(), cheap.Hash()}
+	if len(simulator.pending.txs) != len(want) {
+		t.Fatalf("stacked transaction count mismatch: have %d, want %d", len(simulator.pending.txs), len(want))
+	}
+	for i, tx := range simulator.pending.txs {
+		if tx.Hash() != want[i] {
+			t.Errorf("stacked transaction %d mismatch: have %x, want %x", i, tx.Hash(), want[i])
+		}
+	}
+	// The records reflect the final positions, the cheap one being re-recorded
+	records := sink.Records()
+	if len(records) != 3 {
+		t.Fatalf("record count mismatch: have %d, want 3", len(records))
+	}
+	for _, record := range records {
+		for i, hash := range want {
+			if record.TxHash == hash && record.TxReceipt.TxIndex != uint64(i) {
+				t.Errorf("record %x: tx index mismatch: have %d, want %d", hash, record.TxReceipt.TxIndex, i)
+			}
+		}
+	}
+	// A new head replays the stacked transactions ordered by price and nonce
+	if err := simulator.resetPending(simulator.chain.CurrentBlock()); err != nil {
+		t.Fatalf("failed to rebuild pending state: %v", err)
+	}
+	if len(simulator.pending.txs) != len(want) {
+		t.Fatalf("replayed transaction count mismatch: have %d, want %d", len(simulator.pending.txs), len(want))
+	}
+	for i, tx := range simulator.pending.txs {
+		if tx.Hash() != want[i] {
+			t.Errorf("replayed transaction %d mismatch: have %x, want %x", i, tx.Hash(), want[i])
+		}
+	}
+	if have := len(sink.Records()); have != 3 {
+		t.Errorf("replayed transactions recorded again: have %d records, want 3", have)
+	}
+	if nonce := simulator.pending.state.GetNonce(testAddress); nonce != 2 {
+		t.Errorf("pending nonce mismatch: have %d, want 2", nonce)
+	}
+}
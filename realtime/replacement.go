@@ -0,0 +1,157 @@
+package realtime
+
+import (
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+)
+
+// replacedMeter counts the simulated transactions superseded by another one
+// with the same sender and nonce.
+var replacedMeter = metrics.NewRegisteredMeter("realtime/replaced", nil)
+
+// slotKey identifies the transactions sent by an account with a given nonce.
+type slotKey struct {
+	from  common.Address
+	nonce uint64
+}
+
+// nonceSlot is the replacement chain of a sender and nonce: all transactions
+// seen for it, in arrival order. Each one supersedes the previous, the last is
+// the current one.
+type nonceSlot []*types.Transaction
+
+// Replacement is a transaction of a replacement chain.
+type Replacement struct {
+	Hash     common.Hash  `json:"hash"`
+	GasPrice *hexutil.Big `json:"gasPrice"`
+	Time     time.Time    `json:"time"` // when the transaction was first seen
+	Replaced bool         `json:"replaced"`
+}
+
+// checkReplacement returns SimErrReplaceUnderpriced if the transaction would
+// replace the current one of its sender and nonce without the price bump the
+// transaction pool requires.
+func (pool *SimTxPool) checkReplacement(from common.Address, tx *types.Transaction) error {
+	pool.lock.RLock()
+	defer pool.lock.RUnlock()
+
+	slot := pool.slots[slotKey{from, tx.Nonce()}]
+	if len(slot) == 0 {
+		return nil
+	}
+	old := slot[len(slot)-1]
+	if old.Hash() == tx.Hash() {
+		return nil
+	}
+	// threshold = oldGP * (100 + priceBump) / 100
+	threshold := new(big.Int).Mul(old.GasPrice(), big.NewInt(100+int64(pool.config.PriceBump)))
+	threshold.Div(threshold, big.NewInt(100))
+	if old.GasPriceCmp(tx) >= 0 || tx.GasPriceIntCmp(threshold) < 0 {
+		return SimErrReplaceUnderpriced
+	}
+	return nil
+}
+
+// track indexes a transaction by sender and nonce, marking the transaction it
+// replaces, if any, as replaced. The caller must hold the lock.
+func (pool *SimTxPool) track(from common.Address, tx *types.Transaction) {
+	key := slotKey{from, tx.Nonce()}
+	slot := pool.slots[key]
+	if len(slot) > 0 {
+		old := slot[len(slot)-1]
+		if old.Hash() == tx.Hash() {
+			return
+		}
+		// The superseded transaction will never be mined, stop waiting for
+		// its nonce gap to be filled
+		delete(pool.queue, old.Hash())
+		pool.replaced[old.Hash()] = old
+		replacedMeter.Mark(1)
+		log.Debug("Simulated transaction replaced", "from", from, "nonce", tx.Nonce(), "old", old.Hash(), "new", tx.Hash(), "chain", len(slot)+1)
+	}
+	pool.slots[key] = append(slot, tx)
+	pool.slotOf[tx.Hash()] = key
+}
+
+// Replaced returns the hashes of the transactions the given one superseded,
+// oldest first.
+func (pool *SimTxPool) Replaced(hash common.Hash) []common.Hash {
+	pool.lock.RLock()
+	defer pool.lock.RUnlock()
+
+	key, ok := pool.slotOf[hash]
+	if !ok {
+		return nil
+	}
+	var replaced []common.Hash
+	for _, tx := range pool.slots[key] {
+		if tx.Hash() == hash {
+			break
+		}
+		replaced = append(replaced, tx.Hash())
+	}
+	return replaced
+}
+
+// Replacements returns the whole replacement chain the given transaction is
+// part of, oldest first, or nil if the transaction is unknown.
+func (pool *SimTxPool) Replacements(hash common.Hash) []Replacement {
+	pool.lock.RLock()
+	defer pool.lock.RUnlock()
+
+	key, ok := pool.slotOf[hash]
+	if !ok {
+		return nil
+	}
+	slot := pool.slots[key]
+	chain := make([]Replacement, len(slot))
+	for i, tx := range slot {
+		chain[i] = Replacement{
+			Hash:     tx.Hash(),
+			GasPrice: (*hexutil.Big)(tx.GasPrice()),
+			Time:     tx.Time(),
+			Replaced: i < len(slot)-1,
+		}
+	}
+	return chain
+}
+
+// resolve forgets all transactions of a sender and nonce once a transaction
+// with them was mined, returning them in arrival order. A transaction still
+// being simulated is recorded as executed once done, but never settled again.
+func (pool *SimTxPool) resolve(from common.Address, nonce uint64) []*types.Transaction {
+	pool.lock.Lock()
+	defer pool.lock.Unlock()
+
+	slot := pool.slots[slotKey{from, nonce}]
+	for _, tx := range slot {
+		delete(pool.currentExecuting, tx.Hash())
+		pool.forget(tx.Hash())
+	}
+	return slot
+}
+
+// unstack removes the stacked transaction with the same sender and nonce as
+// the given one, but a different hash, reporting whether there was one.
+func (pending *pendingState) unstack(tx *types.Transaction) bool {
+	from, err := types.Sender(pending.signer, tx)
+	if err != nil {
+		return false
+	}
+	for i, stacked := range pending.txs {
+		if stacked.Nonce() != tx.Nonce() || stacked.Hash() == tx.Hash() {
+			continue
+		}
+		if sender, _ := types.Sender(pending.signer, stacked); sender == from {
+			pending.txs = append(pending.txs[:i:i], pending.txs[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,115 @@
+package realtime
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+func TestReplacementChain(t *testing.T) {
+	simulator, sink := newTestSimulator(t, false)
+
+	var (
+		first  = transfer(t, testKey, 0, 100)
+		second = transfer(t, testKey, 0, 110)
+		cheap  = transfer(t, testKey, 0, 120) // below the 10% bump over second
+		third  = transfer(t, testKey, 0, 200)
+	)
+	for _, tx := range []*types.Transaction{first, second} {
+		if news, errs := simulator.admit([]*types.Transaction{tx}); len(news) != 1 {
+			t.Fatalf("transaction %x not admitted: %v", tx.Hash(), errs[0])
+		}
+	}
+	if status := simulator.simTxPool.Get(first.Hash()); status != TxStatusReplaced {
+		t.Fatalf("superseded transaction status mismatch: have %v, want %v", status, TxStatusReplaced)
+	}
+	if _, errs := simulator.admit([]*types.Transaction{first}); errs[0] != SimErrAlreadyReplaced {
+		t.Errorf("superseded transaction readmitted: %v", errs[0])
+	}
+	if _, errs := simulator.admit([]*types.Transaction{cheap}); errs[0] != SimErrReplaceUnderpriced {
+		t.Errorf("underpriced replacement error mismatch: have %v, want %v", errs[0], SimErrReplaceUnderpriced)
+	}
+	if news, errs := simulator.admit([]*types.Transaction{third}); len(news) != 1 {
+		t.Fatalf("replacement not admitted: %v", errs[0])
+	}
+	// The record of the replacement links to the whole chain before it
+	if _, err := simulator.ExecuteTransaction(third); err != nil {
+		t.Fatalf("failed to simulate replacement: %v", err)
+	}
+	want := []common.Hash{first.Hash(), second.Hash()}
+	if records := sink.Records(); len(records) != 1 || !equalHashes(records[0].TxReplaces, want) {
+		t.Fatalf("replaced hashes mismatch: have %v, want %v", records[0].TxReplaces, want)
+	}
+	chain := NewPublicRealtimeAPI(simulator).GetReplacements(second.Hash())
+	if len(chain) != 3 {
+		t.Fatalf("replacement chain length mismatch: have %d, want 3", len(chain))
+	}
+	for i, tx := range []*types.Transaction{first, second, third} {
+		if chain[i].Hash != tx.Hash() || chain[i].GasPrice.ToInt().Cmp(tx.GasPrice()) != 0 || chain[i].Replaced != (i < 2) {
+			t.Errorf("chain entry %d mismatch: have %+v", i, chain[i])
+		}
+	}
+}
+
+func TestRollingReplacement(t *testing.T) {
+	simulator, sink := newTestSimulator(t, true)
+
+	var (
+		other       = transfer(t, otherKey, 0, 1)
+		original    = transfer(t, testKey, 0, 1)
+		replacement = transfer(t, testKey, 0, 2)
+	)
+	for _, tx := range []*types.Transaction{original, other, replacement} {
+		simulator.simTxPool.Add(tx, 0)
+		if _, err := simulator.ExecuteTransaction(tx); err != nil {
+			t.Fatalf("failed to simulate transaction %x: %v", tx.Hash(), err)
+		}
+	}
+	// The replacement takes the place of the original on the pending state,
+	// ahead of the cheaper transaction stacked in the meantime
+	if len(simulator.pending.txs) != 2 || simulator.pending.txs[0] != replacement || simulator.pending.txs[1] != other {
+		t.Fatalf("stacked transactions mismatch: have %d", len(simulator.pending.txs))
+	}
+	if nonce := simulator.pending.state.GetNonce(testAddress); nonce != 1 {
+		t.Errorf("pending nonce mismatch: have %d, want 1", nonce)
+	}
+	records := sink.Records()
+	if len(records) != 3 || !equalHashes(records[2].TxReplaces, []common.Hash{original.Hash()}) {
+		t.Fatalf("replacement record mismatch: have %d records", len(records))
+	}
+	if balance := simulator.pending.state.GetBalance(testContract); balance.Cmp(big.NewInt(2000)) != 0 {
+		t.Errorf("pending contract balance mismatch: have %v, want 2000", balance)
+	}
+}
+
+func equalHashes(a, b []common.Hash) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestReplacementPriceBump(t *testing.T) {
+	simulator, _ := newTestSimulator(t, false)
+	pool := NewSimTxPool(SimTxPoolConfig{PriceBump: 50}, simulator.chainConfig, simulator.chain)
+
+	var (
+		original = transfer(t, testKey, 0, 100)
+		cheap    = transfer(t, testKey, 0, 120) // enough for the default 10% bump
+		bumped   = transfer(t, testKey, 0, 150)
+	)
+	pool.Add(original, 0)
+	if err := pool.checkReplacement(testAddress, cheap); err != SimErrReplaceUnderpriced {
+		t.Errorf("underpriced replacement error mismatch: have %v, want %v", err, SimErrReplaceUnderpriced)
+	}
+	if err := pool.checkReplacement(testAddress, bumped); err != nil {
+		t.Errorf("replacement rejected: %v", err)
+	}
+}
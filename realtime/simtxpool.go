@@ -0,0 +1,276 @@
+package realtime
+
+import (
+	"errors"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/ethereum/go-ethereum/trace"
+)
+
+var (
+	queuedEvictionMeter   = metrics.NewRegisteredMeter("realtime/pool/queued/eviction", nil)   // Dropped due to the limit or lifetime
+	executedEvictionMeter = metrics.NewRegisteredMeter("realtime/pool/executed/eviction", nil) // Forgotten due to the limit or lifetime
+)
+
+// errStaleJournalEntry is returned for journaled transactions which were mined
+// or expired while the node was down.
+var errStaleJournalEntry = errors.New("stale journal entry")
+
+// SimTxPoolConfig are the limits of the simulation pool.
+type SimTxPoolConfig struct {
+	Journal   string        // Journal of the queued and executed transactions to survive node restarts
+	Rejournal time.Duration // Time interval to regenerate the journal
+
+	QueueLimit    int           // Maximum number of transactions waiting for a nonce gap to be filled
+	ExecutedLimit int           // Maximum number of simulated transactions remembered
+	Lifetime      time.Duration // Maximum amount of time transactions are queued or remembered
+
+	PriceBump uint64 // Minimum price bump percentage to replace a transaction, as in the transaction pool
+}
+
+// DefaultSimTxPoolConfig contains the default simulation pool limits.
+var DefaultSimTxPoolConfig = SimTxPoolConfig{
+	Journal:   trace.DefaultConfig.PoolJournal,
+	Rejournal: trace.DefaultConfig.PoolRejournal,
+
+	QueueLimit:    trace.DefaultConfig.PoolQueue,
+	ExecutedLimit: trace.DefaultConfig.PoolExecuted,
+	Lifetime:      trace.DefaultConfig.PoolLifetime,
+
+	PriceBump: core.DefaultTxPoolConfig.PriceBump,
+}
+
+// newSimTxPoolConfig extracts the simulation pool limits from the trace
+// recorder configuration, replacing transactions like the node's transaction
+// pool does.
+func newSimTxPoolConfig(config *trace.Config, txPoolConfig *core.TxPoolConfig) SimTxPoolConfig {
+	return SimTxPoolConfig{
+		Journal:       config.PoolJournal,
+		Rejournal:     config.PoolRejournal,
+		QueueLimit:    config.PoolQueue,
+		ExecutedLimit: config.PoolExecuted,
+		Lifetime:      config.PoolLifetime,
+		PriceBump:     txPoolConfig.PriceBump,
+	}
+}
+
+// sanitize checks the provided limits and changes anything that's unreasonable
+// or unworkable.
+func (config *SimTxPoolConfig) sanitize() SimTxPoolConfig {
+	conf := *config
+	if conf.Rejournal < time.Second {
+		log.Warn("Sanitizing invalid simulation journal time", "provided", conf.Rejournal, "updated", time.Second)
+		conf.Rejournal = time.Second
+	}
+	if conf.QueueLimit < 1 {
+		log.Warn("Sanitizing invalid simulation queue limit", "provided", conf.QueueLimit, "updated", DefaultSimTxPoolConfig.QueueLimit)
+		conf.QueueLimit = DefaultSimTxPoolConfig.QueueLimit
+	}
+	if conf.ExecutedLimit < 1 {
+		log.Warn("Sanitizing invalid simulation executed limit", "provided", conf.ExecutedLimit, "updated", DefaultSimTxPoolConfig.ExecutedLimit)
+		conf.ExecutedLimit = DefaultSimTxPoolConfig.ExecutedLimit
+	}
+	if conf.Lifetime < 1 {
+		log.Warn("Sanitizing invalid simulation lifetime", "provided", conf.Lifetime, "updated", DefaultSimTxPoolConfig.Lifetime)
+		conf.Lifetime = DefaultSimTxPoolConfig.Lifetime
+	}
+	if conf.PriceBump < 1 {
+		log.Warn("Sanitizing invalid simulation price bump", "provided", conf.PriceBump, "updated", DefaultSimTxPoolConfig.PriceBump)
+		conf.PriceBump = DefaultSimTxPoolConfig.PriceBump
+	}
+	return conf
+}
+
+// journalTx adds a queued or executed transaction to the journal, if one is
+// configured. The caller must hold the lock.
+func (pool *SimTxPool) journalTx(tx *types.Transaction, status TxStatus) {
+	if pool.journal == nil {
+		return
+	}
+	entry := journalEntry{Tx: tx, Status: uint64(status), Time: uint64(pool.seen[tx.Hash()].Unix())}
+	if err := pool.journal.insert(entry); err != nil {
+		log.Warn("Failed to journal simulated transaction", "err", err)
+	}
+}
+
+// journaled returns the journal entries of the queued and executed
+// transactions, the executed ones in execution order.
+func (pool *SimTxPool) journaled() []journalEntry {
+	entries := make([]journalEntry, 0, len(pool.queue)+len(pool.executed))
+	for hash, tx := range pool.queue {
+		entries = append(entries, journalEntry{Tx: tx, Status: uint64(TxStatusQueued), Time: uint64(pool.seen[hash].Unix())})
+	}
+	for _, hash := range pool.executedList {
+		if tx := pool.executed[hash]; tx != nil {
+			entries = append(entries, journalEntry{Tx: tx, Status: uint64(TxStatusExecuted), Time: uint64(pool.seen[hash].Unix())})
+		}
+	}
+	return entries
+}
+
+// restore adds journaled transactions back into the pool, skipping those which
+// were mined or expired in the meantime.
+func (pool *SimTxPool) restore(entries []journalEntry) []error {
+	errs := make([]error, len(entries))
+
+	statedb, err := pool.chain.State()
+	if err != nil {
+		for i := range errs {
+			errs[i] = err
+		}
+		return errs
+	}
+	var (
+		signer = pool.Signer()
+		cutoff = time.Now().Add(-pool.config.Lifetime)
+	)
+	pool.lock.Lock()
+	defer pool.lock.Unlock()
+
+	for i, entry := range entries {
+		from, err := types.Sender(signer, entry.Tx)
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+		seen := time.Unix(int64(entry.Time), 0)
+		if entry.Tx.Nonce() < statedb.GetNonce(from) || seen.Before(cutoff) {
+			errs[i] = errStaleJournalEntry
+			continue
+		}
+		hash := entry.Tx.Hash()
+		pool.track(from, entry.Tx)
+		pool.seen[hash] = seen
+
+		switch TxStatus(entry.Status) {
+		case TxStatusQueued:
+			pool.queue[hash] = entry.Tx
+		case TxStatusExecuted:
+			if _, ok := pool.executed[hash]; !ok {
+				pool.executed[hash] = entry.Tx
+				pool.executedList = append(pool.executedList, hash)
+			}
+		}
+	}
+	pool.truncateQueue()
+	for len(pool.executed) > pool.config.ExecutedLimit {
+		pool.forget(pool.executedList[0])
+		pool.executedList = pool.executedList[1:]
+	}
+	return errs
+}
+
+// truncateQueue drops the oldest queued transactions beyond the queue limit.
+// The caller must hold the lock.
+func (pool *SimTxPool) truncateQueue() {
+	for len(pool.queue) > pool.config.QueueLimit {
+		var (
+			oldest common.Hash
+			at     time.Time
+		)
+		for hash := range pool.queue {
+			if seen := pool.seen[hash]; oldest == (common.Hash{}) || seen.Before(at) {
+				oldest, at = hash, seen
+			}
+		}
+		pool.forget(oldest)
+		queuedEvictionMeter.Mark(1)
+	}
+}
+
+// evict forgets the queued, executed and replaced transactions tracked for
+// longer than the configured lifetime, returning the simulated ones.
+func (pool *SimTxPool) evict() []common.Hash {
+	pool.lock.Lock()
+	defer pool.lock.Unlock()
+
+	var (
+		cutoff  = time.Now().Add(-pool.config.Lifetime)
+		evicted []common.Hash
+	)
+	for hash, seen := range pool.seen {
+		if !seen.Before(cutoff) {
+			continue
+		}
+		if _, ok := pool.currentExecuting[hash]; ok {
+			continue
+		}
+		if _, ok := pool.queue[hash]; ok {
+			queuedEvictionMeter.Mark(1)
+		}
+		if _, ok := pool.executed[hash]; ok {
+			executedEvictionMeter.Mark(1)
+			evicted = append(evicted, hash)
+		} else if _, ok := pool.replaced[hash]; ok {
+			evicted = append(evicted, hash)
+		}
+		pool.forget(hash)
+	}
+	// Drop the forgotten transactions from the execution order
+	executed := pool.executedList[:0]
+	for _, hash := range pool.executedList {
+		if _, ok := pool.executed[hash]; ok {
+			executed = append(executed, hash)
+		}
+	}
+	pool.executedList = executed
+
+	return evicted
+}
+
+// forget removes a transaction from the queued, executed and replaced sets and
+// the replacement index. The caller must hold the lock.
+func (pool *SimTxPool) forget(hash common.Hash) {
+	delete(pool.queue, hash)
+	delete(pool.executed, hash)
+	delete(pool.replaced, hash)
+	delete(pool.seen, hash)
+
+	key, ok := pool.slotOf[hash]
+	if !ok {
+		return
+	}
+	delete(pool.slotOf, hash)
+
+	slot := pool.slots[key]
+	for i, tx := range slot {
+		if tx.Hash() == hash {
+			slot = append(slot[:i:i], slot[i+1:]...)
+			break
+		}
+	}
+	if len(slot) == 0 {
+		delete(pool.slots, key)
+	} else {
+		pool.slots[key] = slot
+	}
+}
+
+// rejournal regenerates the journal from the current contents of the pool.
+func (pool *SimTxPool) rejournal() {
+	if pool.journal == nil {
+		return
+	}
+	pool.lock.Lock()
+	defer pool.lock.Unlock()
+
+	if err := pool.journal.rotate(pool.journaled()); err != nil {
+		log.Warn("Failed to rotate simulation journal", "err", err)
+	}
+}
+
+// Close flushes and closes the journal.
+func (pool *SimTxPool) Close() error {
+	pool.lock.Lock()
+	defer pool.lock.Unlock()
+
+	if pool.journal == nil {
+		return nil
+	}
+	return pool.journal.close()
+}
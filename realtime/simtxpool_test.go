@@ -0,0 +1,124 @@
+package realtime
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+func TestSimTxPoolLimits(t *testing.T) {
+	simulator, _ := newTestSimulator(t, false)
+	pool := NewSimTxPool(SimTxPoolConfig{QueueLimit: 2, ExecutedLimit: 2}, simulator.chainConfig, simulator.chain)
+
+	// The oldest transaction waiting for a nonce gap is dropped first
+	base := time.Now().Add(-time.Hour)
+	queued := [3]*types.Transaction{transfer(t, testKey, 5, 1), transfer(t, testKey, 6, 1), transfer(t, testKey, 7, 1)}
+	for i, tx := range queued {
+		pool.Add(tx, 1)
+		pool.seen[tx.Hash()] = base.Add(time.Duration(i) * time.Minute)
+	}
+	if status := pool.Get(queued[0].Hash()); status != TxStatusUnknown {
+		t.Errorf("oldest queued transaction retained: status %v", status)
+	}
+	for _, tx := range queued[1:] {
+		if status := pool.Get(tx.Hash()); status != TxStatusQueued {
+			t.Errorf("queued transaction status mismatch: have %v, want %v", status, TxStatusQueued)
+		}
+	}
+	// The executed transactions are forgotten in execution order
+	executed := [3]*types.Transaction{transfer(t, otherKey, 0, 1), transfer(t, otherKey, 1, 1), transfer(t, otherKey, 2, 1)}
+	for _, tx := range executed {
+		pool.Add(tx, 0)
+		pool.RemoveExecuted(tx)
+	}
+	if status := pool.Get(executed[0].Hash()); status != TxStatusUnknown {
+		t.Errorf("oldest executed transaction retained: status %v", status)
+	}
+	if _, _, n := pool.Stats(); n != 2 || len(pool.executedList) != 2 {
+		t.Errorf("executed count mismatch: have %d (list %d), want 2", n, len(pool.executedList))
+	}
+}
+
+func TestSimTxPoolLifetime(t *testing.T) {
+	simulator, _ := newTestSimulator(t, false)
+	pool := NewSimTxPool(SimTxPoolConfig{Lifetime: time.Hour}, simulator.chainConfig, simulator.chain)
+
+	var (
+		queued      = transfer(t, testKey, 5, 1)
+		original    = transfer(t, otherKey, 0, 1)
+		replacement = transfer(t, otherKey, 0, 2)
+		executing   = transfer(t, testKey, 0, 1)
+	)
+	pool.Add(queued, 1)
+	pool.Add(original, 0)
+	pool.RemoveExecuted(original)
+	pool.Add(replacement, 0)
+	pool.RemoveExecuted(replacement)
+	pool.Add(executing, 0)
+
+	expired := time.Now().Add(-2 * time.Hour)
+	for _, tx := range []*types.Transaction{queued, original, executing} {
+		pool.seen[tx.Hash()] = expired
+	}
+	pool.evict()
+
+	for _, tx := range []*types.Transaction{queued, original} {
+		if status := pool.Get(tx.Hash()); status != TxStatusUnknown {
+			t.Errorf("expired transaction retained: status %v", status)
+		}
+	}
+	if status := pool.Get(executing.Hash()); status != TxStatusExecuting {
+		t.Errorf("executing transaction evicted: status %v", status)
+	}
+	if status := pool.Get(replacement.Hash()); status != TxStatusExecuted {
+		t.Errorf("recent transaction evicted: status %v", status)
+	}
+	if replaced := pool.Replaced(replacement.Hash()); len(replaced) != 0 {
+		t.Errorf("expired replacement retained: %v", replaced)
+	}
+}
+
+func TestSimTxPoolJournal(t *testing.T) {
+	simulator, _ := newTestSimulator(t, false)
+	config := SimTxPoolConfig{Journal: filepath.Join(t.TempDir(), "simulations.rlp"), Lifetime: time.Hour}
+
+	var (
+		queued   = transfer(t, testKey, 1, 1)
+		executed = transfer(t, testKey, 0, 1)
+		expired  = transfer(t, otherKey, 0, 1)
+		running  = transfer(t, otherKey, 1, 1)
+	)
+	pool := NewSimTxPool(config, simulator.chainConfig, simulator.chain)
+	pool.Add(queued, 1)
+	for _, tx := range []*types.Transaction{executed, expired} {
+		pool.Add(tx, 0)
+		pool.RemoveExecuted(tx)
+	}
+	pool.Add(running, 0)
+	if err := pool.Close(); err != nil {
+		t.Fatalf("failed to close journal: %v", err)
+	}
+	// Queued and executed transactions survive a restart
+	pool = NewSimTxPool(config, simulator.chainConfig, simulator.chain)
+	for tx, want := range map[*types.Transaction]TxStatus{queued: TxStatusQueued, executed: TxStatusExecuted, expired: TxStatusExecuted, running: TxStatusUnknown} {
+		if status := pool.Get(tx.Hash()); status != want {
+			t.Errorf("restored transaction %x status mismatch: have %v, want %v", tx.Hash(), status, want)
+		}
+	}
+	// Regenerated journals keep the first seen time, so expired transactions
+	// are dropped when loading
+	pool.seen[expired.Hash()] = time.Now().Add(-2 * time.Hour)
+	pool.rejournal()
+	pool.Close()
+
+	pool = NewSimTxPool(config, simulator.chainConfig, simulator.chain)
+	defer pool.Close()
+	if status := pool.Get(expired.Hash()); status != TxStatusUnknown {
+		t.Errorf("expired transaction restored: status %v", status)
+	}
+	if status := pool.Get(executed.Hash()); status != TxStatusExecuted {
+		t.Errorf("executed transaction lost: status %v", status)
+	}
+}
@@ -3,40 +3,52 @@ package realtime
 // import "C"
 
 import (
-	"fmt"
+	"errors"
+	"math/big"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/consensus"
 	"github.com/ethereum/go-ethereum/core"
-	"github.com/ethereum/go-ethereum/params"
-	"github.com/ethereum/go-ethereum/core/types"
-	"github.com/ethereum/go-ethereum/common"
-	// "os"
-	"math/big"
-	// "github.com/ethereum/go-ethereum/trace"
-	"github.com/ethereum/go-ethereum/eth/downloader"
-
-	"errors"
-	"sync"
-	"sync/atomic"
 	"github.com/ethereum/go-ethereum/core/state"
-	// "github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/eth/syncstatus"
 	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/miner"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/trace"
+	lru "github.com/hashicorp/golang-lru"
 )
 
 // Backend wraps all methods required for mining.
 type Backend interface {
 	BlockChain() *core.BlockChain
 	TxPool() *core.TxPool
-	Downloader() *downloader.Downloader
+	SyncStatus() *syncstatus.Service
 }
 
 const (
 	// chainHeadChanSize is the size of channel listening to ChainHeadEvent.
 	chainHeadChanSize = 10
 
-	// 
-	MAXExecutedNum = 1000
+	// chainSideChanSize is the size of channel listening to ChainSideEvent.
+	chainSideChanSize = 10
+
+	// syncChanSize is the size of channel listening to sync status changes.
+	syncChanSize = 10
+
+	// txChanSize is the size of channel listening to NewTxsEvent.
+	// The number is referenced from the size of tx pool.
+	txChanSize = 4096
+
+	// evictionInterval is the time interval to check for expired simulations.
+	evictionInterval = time.Minute
+
+	// resultCacheLimit is the number of simulation results kept for the API.
+	resultCacheLimit = 1024
 
 	// txSlotSize is used to calculate how many data slots a single transaction
 	// takes up based on its size. The slots are used as DoS protection, ensuring
@@ -51,13 +63,16 @@ const (
 	txMaxSize = 4 * txSlotSize // 128KB
 )
 
-
 // Miner creates blocks and searches for proof-of-work values.
 // Simulates Miner, Simulator just executes the realtime transactions.
 type Simulator struct {
-	startCh  chan struct{}
-	newTxsCh chan []*types.Transaction
-	stopCh   chan struct{}
+	startCh chan struct{}
+	stopCh  chan struct{}
+
+	// bounded intake queue of the transactions to simulate, drained by the
+	// worker pool
+	taskCh  chan *types.Transaction
+	workers int
 
 	chainConfig *params.ChainConfig
 	engine      consensus.Engine
@@ -65,96 +80,250 @@ type Simulator struct {
 	chain       *core.BlockChain
 
 	// to store all the transactions
-	simTxPool   *SimTxPool	
+	simTxPool *SimTxPool
+
+	// destination of the trace records of simulated transactions (nil = disabled)
+	sink    trace.Sink
+	results *lru.Cache // recent simulation records by transaction hash
 
-	running		int32
+	// subscribers notified with every simulation record
+	simulationFeed event.Feed
+	scope          event.SubscriptionScope
+
+	// fate of the simulated transactions once a block consumes their nonce
+	actual        *lru.Cache // records of the imported transactions by hash
+	inclusions    *lru.Cache // inclusions of the simulated transactions by hash
+	inclusionFeed event.Feed
+	correlated    uint64 // number of the last block correlated, owned by the loop
+
+	// rolling mode stacks the simulated transactions on a shared pending state
+	// instead of executing each one in isolation on top of the head
+	rolling     bool
+	pending     *pendingState
+	pendingLock sync.Mutex
+
+	kinds   kindFilter   // kinds of transactions simulated
+	context blockContext // settings of the block the transactions are simulated in
+
+	running int32
+	synced  int32 // whether the node is caught up with the network
 
 	// to pretect the execution, currently used for now
 	// exe          sync.RWMutex
 
-
 	chainHeadCh  chan core.ChainHeadEvent
 	chainHeadSub event.Subscription
 
-}
+	// blocks which left the canonical chain, unmarking their inclusions
+	chainSideCh  chan core.ChainSideEvent
+	chainSideSub event.Subscription
 
-// New the simulator, do not worry 
-func New(eth Backend, chainConfig *params.ChainConfig, engine consensus.Engine) *Simulator {
-	fmt.Println("New the simulator")
-	simulator := &Simulator{
-		chainConfig:        chainConfig,
-		engine:             engine,
-		eth:                eth,
-		chain:              eth.BlockChain(),	
-		simTxPool:   		NewSimTxPool(chainConfig, eth.BlockChain()),
-		startCh:            make(chan struct{}, 1),
-		stopCh:  			make(chan struct{}),
+	// transactions accepted by the transaction pool
+	txsCh  chan core.NewTxsEvent
+	txsSub event.Subscription
+
+	// sync status changes, simulation pauses while the node is catching up
+	syncCh  chan syncstatus.Status
+	syncSub event.Subscription
 
-		// case 1.1: does not have buffer now
-		newTxsCh:			make(chan []*types.Transaction),
+	exitCh chan struct{}
+	wg     sync.WaitGroup // the event loop and the workers
+}
 
-		chainHeadCh:        make(chan core.ChainHeadEvent, chainHeadChanSize),
+// New the simulator, do not worry
+func New(eth Backend, chainConfig *params.ChainConfig, engine consensus.Engine, config *trace.Config, minerConfig *miner.Config, txPoolConfig *core.TxPoolConfig, sink trace.Sink) *Simulator {
+	workers, queue := config.Workers, config.QueueSize
+	if workers < 1 {
+		log.Warn("Sanitizing simulation workers", "provided", workers, "updated", 1)
+		workers = 1
+	}
+	if config.Rolling && workers > 1 {
+		// Stacked simulations depend on each other, they run in arrival order
+		log.Warn("Rolling simulation uses a single worker", "provided", workers)
+		workers = 1
+	}
+	if queue < 1 {
+		log.Warn("Sanitizing simulation queue size", "provided", queue, "updated", trace.DefaultConfig.QueueSize)
+		queue = trace.DefaultConfig.QueueSize
+	}
+	actual, inclusions := newInclusionCaches()
+	simulator := &Simulator{
+		chainConfig: chainConfig,
+		engine:      engine,
+		eth:         eth,
+		chain:       eth.BlockChain(),
+		simTxPool:   NewSimTxPool(newSimTxPoolConfig(config, txPoolConfig), chainConfig, eth.BlockChain()),
+		sink:        sink,
+		results:     newResultCache(),
+		actual:      actual,
+		inclusions:  inclusions,
+		rolling:     config.Rolling,
+		kinds:       newKindFilter(config.Kinds),
+		context:     newBlockContext(config, minerConfig),
+		startCh:     make(chan struct{}, 1),
+		stopCh:      make(chan struct{}),
+		taskCh:      make(chan *types.Transaction, queue),
+		workers:     workers,
+
+		chainHeadCh: make(chan core.ChainHeadEvent, chainHeadChanSize),
+		chainSideCh: make(chan core.ChainSideEvent, chainSideChanSize),
+		txsCh:       make(chan core.NewTxsEvent, txChanSize),
+		syncCh:      make(chan syncstatus.Status, syncChanSize),
+		exitCh:      make(chan struct{}),
 	}
 
 	simulator.chainHeadSub = simulator.chain.SubscribeChainHeadEvent(simulator.chainHeadCh)
+	simulator.chainSideSub = simulator.chain.SubscribeChainSideEvent(simulator.chainSideCh)
+	// Simulate exactly the transactions the pool accepts, whether they come
+	// from the network, the local APIs or the journal
+	simulator.txsSub = eth.TxPool().SubscribeNewTxsEvent(simulator.txsCh)
+	simulator.syncSub = eth.SyncStatus().SubscribeStatus(simulator.syncCh)
+	if eth.SyncStatus().Synced() {
+		atomic.StoreInt32(&simulator.synced, 1)
+	}
 
-
+	simulator.wg.Add(1 + workers)
 	go simulator.loop()
-
-	simulator.startCh <- struct{}{}
+	for i := 0; i < workers; i++ {
+		go (&worker{simulator: simulator}).loop()
+	}
 
 	return simulator
 }
 
+// Start begins simulating the incoming pending transactions. It is a no-op
+// once the simulator has been closed.
+func (simulator *Simulator) Start() {
+	select {
+	case simulator.startCh <- struct{}{}:
+	case <-simulator.exitCh:
+	}
+}
+
+// Stop pauses the simulation of pending transactions. It is a no-op once the
+// simulator has been closed.
+func (simulator *Simulator) Stop() {
+	select {
+	case simulator.stopCh <- struct{}{}:
+	case <-simulator.exitCh:
+	}
+}
+
+// Close terminates the simulator, flushes the trace records of the simulated
+// transactions and releases the sink they are written to.
+func (simulator *Simulator) Close() error {
+	close(simulator.exitCh)
+	simulator.wg.Wait()
+	simulator.scope.Close()
+	if err := simulator.simTxPool.Close(); err != nil {
+		log.Warn("Failed to close simulation journal", "err", err)
+	}
+	if simulator.sink == nil {
+		return nil
+	}
+	return simulator.sink.Close()
+}
 
 // isRunning returns an indicator whether worker is running or not.
 func (simulator *Simulator) isRunning() bool {
 	return atomic.LoadInt32(&simulator.running) == 1
 }
 
-
+// isSynced returns an indicator whether the node is caught up with the network.
+func (simulator *Simulator) isSynced() bool {
+	return atomic.LoadInt32(&simulator.synced) == 1
+}
 
 func (simulator *Simulator) loop() {
+	defer simulator.wg.Done()
+	defer simulator.syncSub.Unsubscribe()
+	defer simulator.txsSub.Unsubscribe()
+	defer simulator.chainHeadSub.Unsubscribe()
+	defer simulator.chainSideSub.Unsubscribe()
+
+	var (
+		evict   = time.NewTicker(evictionInterval)
+		journal = time.NewTicker(simulator.simTxPool.config.Rejournal)
+	)
+	defer evict.Stop()
+	defer journal.Stop()
+
 	for {
 		select {
 		case <-simulator.startCh:
-			fmt.Printf("%s start the simulator in the loop\n", time.Now())
+			log.Debug("Simulation started")
 			atomic.StoreInt32(&simulator.running, 1)
 		case <-simulator.stopCh:
-			fmt.Printf("%s stop the simulator in the loop\n", time.Now())
+			log.Debug("Simulation stopped")
 			atomic.StoreInt32(&simulator.running, 0)
-		case newTxs := <-simulator.newTxsCh:
-			// we do not need the lock right now
-			fmt.Printf("%s handle coming newTxs in the loop\n", time.Now())
-			if simulator.isRunning() == true {
-				for _, tx := range newTxs {
-					simulator.ExecuteTransaction(tx)
-					simulator.simTxPool.RemoveExecuted(tx)
+		case ev := <-simulator.txsCh:
+			if simulator.isRunning() && simulator.isSynced() {
+				news, _ := simulator.admit(ev.Txs)
+				simulator.enqueue(news)
+			}
+
+		case status := <-simulator.syncCh:
+			if !status.Synced {
+				log.Info("Pausing simulation while catching up", "head", uint64(status.Head), "highest", uint64(status.Highest))
+				atomic.StoreInt32(&simulator.synced, 0)
+				continue
+			}
+			log.Info("Resuming simulation at the chain head", "head", uint64(status.Head))
+			atomic.StoreInt32(&simulator.synced, 1)
+			if simulator.rolling {
+				if err := simulator.resetPending(simulator.chain.CurrentBlock()); err != nil {
+					log.Warn("Failed to rebuild pending simulation state", "err", err)
 				}
-				fmt.Printf("%s finished execution newTxs coming in the loop length %d\n", time.Now(), len(newTxs))
 			}
-			fmt.Println("\n\n\n\n\n\n")
 
 		case head := <-simulator.chainHeadCh:
-			fmt.Printf("%s new mined block number in the loop %d\n", time.Now(), head.Block.NumberU64())
-			// get highest head  if not euqal, continue, if equal, promote
-			if head.Block.NumberU64() == simulator.eth.Downloader().Progress().HighestBlock {
-				fmt.Printf("%s before PromoteQueue current block in the loop %d\n", time.Now(), head.Block.NumberU64())
-				promoted_txs := simulator.simTxPool.PromoteQueue()
-				if simulator.isRunning() == true {
-					for _, tx := range promoted_txs {
-						simulator.ExecuteTransaction(tx)
-						simulator.simTxPool.RemoveExecuted(tx)
-					}
-					fmt.Printf("%s finished execution promoted_txs coming in the loop length %d\n", time.Now(), len(promoted_txs))
+			// Blocks imported while catching up are irrelevant to the pending state
+			if !simulator.isSynced() {
+				continue
+			}
+			log.Debug("Correlating simulations with new head", "number", head.Block.NumberU64())
+			// Settle the simulations whose nonce got consumed before the
+			// stale queued transactions are forgotten by the promotion
+			simulator.correlateHead(head.Block)
+			if simulator.rolling {
+				if err := simulator.resetPending(head.Block); err != nil {
+					log.Warn("Failed to rebuild pending simulation state", "number", head.Block.Number(), "err", err)
 				}
 			}
-			fmt.Println("\n\n\n\n\n\n")
+			if simulator.isRunning() == true {
+				// Promoted transactions are marked as executing, so only
+				// promote them if they are going to be simulated
+				promoted_txs := simulator.simTxPool.PromoteQueue(simulator.nextNonce)
+				simulator.enqueue(promoted_txs)
+				log.Debug("Promoted queued simulations", "number", head.Block.NumberU64(), "count", len(promoted_txs))
+			}
+
+		case side := <-simulator.chainSideCh:
+			simulator.uncorrelate(side.Block)
+
+		// Forget the simulations tracked for too long
+		case <-evict.C:
+			simulator.expire(simulator.simTxPool.evict())
+
+		// Regenerate the journal so it doesn't grow without bound
+		case <-journal.C:
+			simulator.simTxPool.rejournal()
+
+		// System stopped
+		case <-simulator.exitCh:
+			return
+		case <-simulator.txsSub.Err():
+			return
+		case <-simulator.chainHeadSub.Err():
+			return
+		case <-simulator.chainSideSub.Err():
+			return
+		case <-simulator.syncSub.Err():
+			return
 		}
 	}
 }
 
-
 var (
 	// ErrAlreadyKnown is returned if the transactions is already contained
 	// within the pool.
@@ -163,12 +332,32 @@ var (
 	// ErrAlreadyKnown is returned if the transactions is already contained
 	// within the pool.
 	SimErrAlreadyExecuted = errors.New("already executed")
-	SimErrAlreadyMined = errors.New("already mined")
+	SimErrAlreadyMined    = errors.New("already mined")
+
+	// SimErrAlreadyReplaced is returned if the transaction was superseded by
+	// another one with the same sender and nonce.
+	SimErrAlreadyReplaced = errors.New("already replaced")
 
 	SimErrFailedBasicVal = errors.New("failed basic validation")
 
 	SimErrToEOA = errors.New("To address is EOA")
 
+	// SimErrToContract is returned for message calls to contracts if their
+	// simulation is disabled.
+	SimErrToContract = errors.New("To address is contract")
+
+	// SimErrCreation is returned for contract creations if their simulation is
+	// disabled.
+	SimErrCreation = errors.New("contract creation")
+
+	// SimErrUnprotected is returned for transactions without EIP155 replay
+	// protection if their simulation is disabled.
+	SimErrUnprotected = errors.New("unprotected transaction")
+
+	// SimErrQueueFull is returned if the simulation workers fall behind and the
+	// intake queue can't accept another transaction.
+	SimErrQueueFull = errors.New("simulation queue is full")
+
 	// ErrInvalidSender is returned if the transaction contains an invalid signature.
 	SimErrInvalidSender = errors.New("invalid sender")
 
@@ -214,15 +403,42 @@ var (
 	SimErrInsufficientFunds = errors.New("insufficient funds for gas * price + value")
 )
 
-
-
+// HandleMessages queues externally supplied transactions for simulation. The
+// transactions accepted by the transaction pool are simulated automatically.
+// It never blocks: transactions which don't fit into the intake queue are
+// rejected with SimErrQueueFull.
 func (simulator *Simulator) HandleMessages(txs []*types.Transaction) []error {
-	fmt.Printf("%s begin in the HandleMessages\n", time.Now())
+	news, errs := simulator.admit(txs)
+	if dropped := simulator.enqueue(news); len(dropped) > 0 {
+		full := make(map[common.Hash]struct{}, len(dropped))
+		for _, tx := range dropped {
+			full[tx.Hash()] = struct{}{}
+		}
+		for i, tx := range txs {
+			if _, ok := full[tx.Hash()]; ok && errs[i] == nil {
+				errs[i] = SimErrQueueFull
+			}
+		}
+	}
+	return errs
+}
 
+// admit filters out the transactions which are known, mined or invalid, and
+// queues those with a nonce gap until the gap is filled. The remaining ones
+// are marked as executing and returned for simulation.
+func (simulator *Simulator) admit(txs []*types.Transaction) ([]*types.Transaction, []error) {
 	var (
-		errs = make([]error, len(txs))
-		news = make([]*types.Transaction, 0, len(txs))
+		errs   = make([]error, len(txs))
+		news   = make([]*types.Transaction, 0, len(txs))
+		signer = simulator.simTxPool.Signer()
+		next   = make(map[common.Address]uint64) // next nonce of the senders admitted in this batch
 	)
+	// Step 2 and 3 check the transactions against the head state
+	current_state, state_err := simulator.chain.StateAt(simulator.chain.CurrentBlock().Root())
+	if state_err != nil {
+		log.Warn("Failed to retrieve the head state", "err", state_err)
+		return nil, errs
+	}
 	for i, tx := range txs {
 		// Setp 1: If the transaction already exists
 		tempt_status := simulator.simTxPool.Get(tx.Hash())
@@ -234,6 +450,10 @@ func (simulator *Simulator) HandleMessages(txs []*types.Transaction) []error {
 			errs[i] = SimErrAlreadyExecuted
 			continue
 		}
+		if tempt_status == TxStatusReplaced {
+			errs[i] = SimErrAlreadyReplaced
+			continue
+		}
 
 		// Step extra: check whether the transaction has already been mined?????
 		if simulator.chain.GetReceiptsByHash(tx.Hash()) != nil {
@@ -242,194 +462,263 @@ func (simulator *Simulator) HandleMessages(txs []*types.Transaction) []error {
 		}
 
 		// Step 2: If the transaction fails basic validation, discard it, cheks whether the nonce too low
-		current_state, state_err := simulator.chain.StateAt(simulator.chain.CurrentBlock().Root())
-		if state_err != nil {
-			fmt.Printf("%s Get current state error \n", time.Now())
-			return nil
-		}
-
 		if valerr := simulator.simTxPool.validateTx(tx, current_state, simulator.chain.CurrentBlock().Number()); valerr != nil {
 			errs[i] = SimErrFailedBasicVal
 			errs[i] = valerr
 			continue
 		}
 
-		// Stpe 3: If the to address is EOA, discard it.
-		code := current_state.GetCode(*tx.To())
-		if len(code) == 0 {
-			errs[i] = SimErrToEOA
+		// Stpe 3: If the kind of the transaction is not simulated, discard it.
+		if kinderr := simulator.checkKind(tx, current_state); kinderr != nil {
+			errs[i] = kinderr
 			continue
 		}
 
-		// Step 5: replaced tx????
-		// let us forget the replaced for now,
-
+		// Step 5: If the transaction replaces a known one, it has to pay
+		// enough more for the transaction pool to accept it
+		from, _ := types.Sender(signer, tx) // already passed in the Step2 ValidateTx
+		if replerr := simulator.simTxPool.checkReplacement(from, tx); replerr != nil {
+			errs[i] = replerr
+			continue
+		}
 
 		// Step 4: If the nonce is too high, add it to the queue
-		from, _ := types.Sender(simulator.simTxPool.signer, tx) // already passed in the Step2 ValidateTx
-		if current_state.GetNonce(from) < tx.Nonce() { // nonce is too high, add it to the queue
+		nonce, ok := next[from]
+		if !ok {
+			nonce = simulator.nextNonce(from, current_state)
+		}
+		if nonce < tx.Nonce() { // nonce is too high, add it to the queue
 			simulator.simTxPool.Add(tx, 1)
 			continue
 		}
+		if simulator.rolling {
+			// Stacked in order, so a deployment and the calls following it
+			// from the same sender can all be simulated right away
+			next[from] = tx.Nonce() + 1
+		}
 
 		// Accumulate all unknown transactions for deeper processing
 		news = append(news, tx)
 	}
 
-	for i, tempt_err := range errs {
-		fmt.Printf("%s txhash %s error %s \n", time.Now(), txs[i].Hash().String(), tempt_err.Error())
-	}
-
-
-	if len(news) == 0 {
-		fmt.Printf("%s How many time messages %d new txs %d\n", time.Now(), len(txs), 0)
-		return errs
+	for i, err := range errs {
+		if err != nil {
+			log.Trace("Skipping transaction simulation", "hash", txs[i].Hash(), "err", err)
+		}
 	}
-
-	for _, newtx := range news{
+	for _, newtx := range news {
 		simulator.simTxPool.Add(newtx, 0)
 	}
-
-	fmt.Printf("%s How many time messages %d new txs %d\n", time.Now(), len(txs), len(news))
-
-	// we do not use the pending pool, 
-	simulator.newTxsCh <- news
-
-	return errs
+	return news, errs
 }
 
+// nextNonce returns the nonce of the sender's next transaction to simulate, as
+// of the pending state in rolling mode or the head state otherwise.
+func (simulator *Simulator) nextNonce(from common.Address, head *state.StateDB) uint64 {
+	if simulator.rolling {
+		simulator.pendingLock.Lock()
+		defer simulator.pendingLock.Unlock()
 
+		if simulator.pending != nil {
+			return simulator.pending.state.GetNonce(from)
+		}
+	}
+	return head.GetNonce(from)
+}
 
-// execute one transaction
-// Modify from commitTransaction
+// ExecuteTransaction simulates a pending transaction and records its trace. In
+// rolling mode the transaction is stacked on the pending state, otherwise it is
+// executed in isolation on top of the current head.
 func (simulator *Simulator) ExecuteTransaction(tx *types.Transaction) ([]*types.Log, error) {
-	// trace.SimFlag = true
-	// fmt.Println("test simulation begin")
-	start := time.Now()
-	// fmt.Printf("ExecuteTransaction start time %s \n", start)
-	// fmt.Println("ExecuteTransaction?")
-	parent := simulator.chain.CurrentBlock()
-	// fmt.Println("ExecuteTransaction??")
-	current_state, err := simulator.chain.StateAt(parent.Root())
+	return simulator.executeTransaction(tx, nil)
+}
+
+// executeTransaction implements ExecuteTransaction. Isolated simulations run on
+// statedb, the caller's copy of the head state, or on a fresh copy if nil.
+func (simulator *Simulator) executeTransaction(tx *types.Transaction, statedb *state.StateDB) ([]*types.Log, error) {
+	if simulator.rolling {
+		results, err := simulator.executePending(tx)
+		if err != nil {
+			log.Debug("Failed to simulate transaction", "hash", tx.Hash(), "err", err)
+			return nil, err
+		}
+		// The stacked transactions which had to make room for this one are
+		// recorded again, as their positions and traces changed
+		for _, result := range results {
+			simulator.publish(result.receipt, result.collector, nil)
+		}
+		return results[0].receipt.Logs, nil
+	}
+	var (
+		receipt   *types.Receipt
+		collector *trace.TraceCollector
+		err       error
+	)
+	var sensitive []string
+	switch {
+	case simulator.context.probe:
+		receipt, collector, sensitive, err = simulator.executeProbed(tx, statedb)
+	default:
+		receipt, collector, err = simulator.executeIsolated(tx, statedb)
+	}
 	if err != nil {
-		fmt.Printf("%s Get current state error \n", time.Now())
-	}
-	current_state = current_state.Copy()
-	// fmt.Printf("ExecuteTransaction Curent len of revisions %s %s %d\n", time.Now(), current_state.GetOriginalRoot().String(), len(current_state.GetRevisionList()))
-	// fmt.Println("ExecuteTransaction???")
-	
-	snap := current_state.Snapshot()
-	// fmt.Printf("ExecuteTransaction Curent len of revisions %s %s %d\n", time.Now(), current_state.GetOriginalRoot().String(), len(current_state.GetRevisionList()))
-	
-	// fmt.Println("ExecuteTransaction????")
-	// fmt.Println("snap id %d", snap)
-	num := parent.Number()
-	// fmt.Println("ExecuteTransaction?????")
-	// fmt.Printf("ExecuteTransaction Current state obtained \n")
-	// fmt.Printf("ExecuteTransaction Tx hash  %s\n", tx.Hash().String())
-	// fmt.Printf("ExecuteTransaction Curent number (parent number from the blockchain) %s %d\n", time.Now(), num)
-	// fmt.Printf("ExecuteTransaction downloader highest number %s %d\n", time.Now(), simulator.eth.Downloader().Progress().HighestBlock)
-	// fmt.Printf("ExecuteTransaction downloader current number %s %d\n", time.Now(), simulator.eth.Downloader().Progress().CurrentBlock)
-
-	header := &types.Header{
-		ParentHash: parent.Hash(),
-		Number:     num.Add(num, common.Big1),
-		// GasLimit:   core.CalcGasLimit(parent, e.config.GasFloor, e.config.GasCeil),
-		GasLimit:   10000000000,
-		// Extra:      e.extra,
-		Extra:		nil,
-		Time:       uint64(time.Now().Unix()),
-		// for now
-		Difficulty:  big.NewInt(0),
-	}
-	// fmt.Println("ExecuteTransaction??????")
-	// fmt.Printf("ExecuteTransaction header time now  %s\n", time.Now())
-
-	gasPool := new(core.GasPool).AddGas(header.GasLimit)
-	// gasPool := new(core.GasPool).AddGas(math.MaxUint64)
-
-	// fmt.Printf("Start RTApplyTransaction\n")
-	receipt, err := core.RTApplyTransaction(simulator.chainConfig, simulator.chain, nil, gasPool, current_state, header, tx, &header.GasUsed, *simulator.chain.GetVMConfig())
-	// fmt.Printf("End RTApplyTransaction\n")
-
-	// detect the attacks
-	// C.SayHello(C.CString("Hello, World"))
-	
-	// fmt.Printf("ExecuteTransaction current parent num %s %d\n", time.Now(), simulator.chain.CurrentBlock().Number())
-	// fmt.Printf("ExecuteTransaction Curent len of revisions %s %s %d\n", time.Now(), current_state.GetOriginalRoot().String(), len(current_state.GetRevisionList()))
-	current_state.RevertToSnapshot(snap)
-	// fmt.Printf("ExecuteTransaction after revert time %s \n", time.Now())
+		log.Debug("Failed to simulate transaction", "hash", tx.Hash(), "err", err)
+		return nil, err
+	}
+	simulator.publish(receipt, collector, sensitive)
+	return receipt.Logs, nil
+}
+
+// publish records the trace of a simulated transaction, making it available to
+// the result lookup, the subscribers and the sink.
+func (simulator *Simulator) publish(receipt *types.Receipt, collector *trace.TraceCollector, sensitive []string) {
+	record := collector.Record(receipt.TxHash)
+	record.TxReplaces = simulator.simTxPool.Replaced(receipt.TxHash)
+	record.TxContext = sensitive
+	simulator.results.Add(record.TxHash, &record)
+	simulator.simulationFeed.Send(&record)
+	if simulator.sink != nil {
+		if err := simulator.sink.Write(record); err != nil {
+			log.Warn("Failed to write simulation record", "hash", receipt.TxHash, "err", err)
+		}
+	}
+}
 
+// Simulate runs a transaction on top of the pending state in rolling mode, or
+// the head state otherwise, and returns its trace record. Unlike
+// ExecuteTransaction the transaction is neither stacked nor recorded.
+func (simulator *Simulator) Simulate(tx *types.Transaction) (*trace.TransactionAll, error) {
+	var (
+		receipt   *types.Receipt
+		collector *trace.TraceCollector
+		err       error
+	)
+	if simulator.rolling {
+		receipt, collector, err = simulator.simulatePending(tx)
+	} else {
+		receipt, collector, err = simulator.executeIsolated(tx, nil)
+	}
 	if err != nil {
-		fmt.Println("core.RTApplyTransaction error ", err.Error())
 		return nil, err
-	} 
+	}
+	record := collector.Record(receipt.TxHash)
+	return &record, nil
+}
 
-	// fmt.Printf("ExecuteTransaction end time %s \n", time.Now())
-	fmt.Printf("time %s tx hash %s execution time %s  current number %d\n", time.Now(), tx.Hash().String(), time.Since(start), num)
-	// fmt.Println("test simulation end")
-	// trace.SimFlag = false
-	// os.Exit(1)
-	return receipt.Logs, nil
+// Result returns the trace record of a recently simulated transaction, or nil
+// if it is unknown.
+func (simulator *Simulator) Result(hash common.Hash) *trace.TransactionAll {
+	if record, ok := simulator.results.Get(hash); ok {
+		return record.(*trace.TransactionAll)
+	}
+	return nil
+}
+
+// newResultCache creates the cache of recent simulation records.
+func newResultCache() *lru.Cache {
+	cache, _ := lru.New(resultCacheLimit)
+	return cache
 }
 
+// executeIsolated applies a single transaction on a copy of the head state and
+// reverts it afterwards. The copy is either the given one, which must belong to
+// the current head, or a fresh one if nil.
+// Modify from commitTransaction
+func (simulator *Simulator) executeIsolated(tx *types.Transaction, current_state *state.StateDB) (*types.Receipt, *trace.TraceCollector, error) {
+	parent := simulator.chain.CurrentBlock()
+	if current_state == nil {
+		statedb, err := simulator.chain.StateAt(parent.Root())
+		if err != nil {
+			return nil, nil, err
+		}
+		current_state = statedb
+	}
+	return simulator.applyIsolated(tx, current_state, simulator.simulationHeader(parent))
+}
 
 type SimTxPool struct {
 	// general info
 	// config      TxPoolConfig
 	chainconfig *params.ChainConfig
 	chain       *core.BlockChain
-	signer      types.Signer
-
 
 	// case 1: remove the pending for now
 	// pending transactions are ones to be executed
 	// pending  map[common.Hash]*types.Transaction
 
-	// queue transactions have not reached requirements, like the message nonce, 
+	// queue transactions have not reached requirements, like the message nonce,
 	// queue and executed should be trucated from time to time
-	executedList  []common.Hash
+	executedList []common.Hash
 
-	queue  map[common.Hash]*types.Transaction
-	executed  map[common.Hash]*types.Transaction
+	queue    map[common.Hash]*types.Transaction
+	executed map[common.Hash]*types.Transaction
 	// current executing transactions (in the executing phase)
 	// just the messages related newTxs
 	currentExecuting map[common.Hash]*types.Transaction
-	lock          sync.RWMutex // to protect all
 
+	// transactions indexed by sender and nonce, to detect replacements
+	slots    map[slotKey]nonceSlot
+	slotOf   map[common.Hash]slotKey
+	replaced map[common.Hash]*types.Transaction // superseded by a later transaction
+
+	config  SimTxPoolConfig
+	seen    map[common.Hash]time.Time // when the tracked transactions were first tracked
+	journal *simJournal               // journal of the queued and executed transactions
+
+	lock sync.RWMutex // to protect all
 
 	// sort by the from address
 	// sortedQueue   map[common.Address][]*types.Transaction
 	// queLock       sync.RWMutex // to protect sortedQueue
 
 	// Current gas limit for transaction caps
-	currentMaxGas uint64 
+	currentMaxGas uint64
 }
 
+// NewSimTxPool creates the lookup of the simulated transactions, restoring the
+// journaled ones if a journal is configured.
+func NewSimTxPool(config SimTxPoolConfig, chainconfig *params.ChainConfig, chain *core.BlockChain) *SimTxPool {
+	config = config.sanitize()
 
-
-func NewSimTxPool(chainconfig *params.ChainConfig, chain *core.BlockChain) *SimTxPool {
 	// Create the transaction pool with its initial settings
 	pool := &SimTxPool{
-		// config:          config,
-		chainconfig:     chainconfig,
-		chain:           chain,
-		signer:          types.NewEIP155Signer(chainconfig.ChainID),
-
-		currentExecuting:         make(map[common.Hash]*types.Transaction),
-		queue:           make(map[common.Hash]*types.Transaction),
-		executed: 		 make(map[common.Hash]*types.Transaction),
+		config:      config,
+		chainconfig: chainconfig,
+		chain:       chain,
+
+		currentExecuting: make(map[common.Hash]*types.Transaction),
+		queue:            make(map[common.Hash]*types.Transaction),
+		executed:         make(map[common.Hash]*types.Transaction),
+		slots:            make(map[slotKey]nonceSlot),
+		slotOf:           make(map[common.Hash]slotKey),
+		replaced:         make(map[common.Hash]*types.Transaction),
+		seen:             make(map[common.Hash]time.Time),
 
 		// executedList: 		 make([]common.Hash)
 
-		currentMaxGas:   chain.CurrentBlock().Header().GasLimit, 
+		currentMaxGas: chain.CurrentBlock().Header().GasLimit,
 	}
 
-	
+	// If a journal was specified, load the simulations from the previous run
+	if config.Journal != "" {
+		pool.journal = newSimJournal(config.Journal)
+
+		if err := pool.journal.load(pool.restore); err != nil {
+			log.Warn("Failed to load simulation journal", "err", err)
+		}
+		if err := pool.journal.rotate(pool.journaled()); err != nil {
+			log.Warn("Failed to rotate simulation journal", "err", err)
+		}
+	}
 
 	return pool
 }
 
+// Signer returns the signer of the transactions in the block following the
+// current head, which pending transactions are simulated in.
+func (pool *SimTxPool) Signer() types.Signer {
+	return types.MakeSigner(pool.chainconfig, new(big.Int).Add(pool.chain.CurrentBlock().Number(), common.Big1))
+}
 
 type TxStatus uint
 
@@ -438,14 +727,18 @@ const (
 	TxStatusExecuting
 	TxStatusQueued
 	TxStatusExecuted
+	TxStatusReplaced
 )
 
-
 // Get returns a transaction if it exists in the lookup, or nil if not found.
 func (pool *SimTxPool) Get(hash common.Hash) TxStatus {
 	pool.lock.RLock()
 	defer pool.lock.RUnlock()
 
+	if tx := pool.replaced[hash]; tx != nil {
+		return TxStatusReplaced
+	}
+
 	if tx := pool.currentExecuting[hash]; tx != nil {
 		return TxStatusExecuting
 	}
@@ -461,21 +754,48 @@ func (pool *SimTxPool) Get(hash common.Hash) TxStatus {
 	return TxStatusUnknown
 }
 
+// Stats returns the number of queued, executing and executed transactions.
+func (pool *SimTxPool) Stats() (int, int, int) {
+	pool.lock.RLock()
+	defer pool.lock.RUnlock()
+
+	return len(pool.queue), len(pool.currentExecuting), len(pool.executed)
+}
 
-// Add adds a transaction to the lookup.
+// Add adds a transaction to the lookup. A transaction with the same sender and
+// nonce as a known one replaces it.
 func (pool *SimTxPool) Add(tx *types.Transaction, status int) {
+	from, err := types.Sender(pool.Signer(), tx)
+	if err != nil {
+		return
+	}
 	pool.lock.Lock()
 	defer pool.lock.Unlock()
 
+	pool.track(from, tx)
+	if _, ok := pool.seen[tx.Hash()]; !ok {
+		pool.seen[tx.Hash()] = time.Now()
+	}
+
 	if status == 0 {
 		pool.currentExecuting[tx.Hash()] = tx
 	}
 
 	if status == 1 {
 		pool.queue[tx.Hash()] = tx
+		pool.journalTx(tx, TxStatusQueued)
+		pool.truncateQueue()
 	}
 }
 
+// Discard forgets a transaction which was marked as executing but will not be
+// simulated, so it can be admitted again later.
+func (pool *SimTxPool) Discard(tx *types.Transaction) {
+	pool.lock.Lock()
+	defer pool.lock.Unlock()
+
+	delete(pool.currentExecuting, tx.Hash())
+}
 
 // Remove a transaction from the executing
 func (pool *SimTxPool) RemoveExecuted(tx *types.Transaction) {
@@ -483,52 +803,62 @@ func (pool *SimTxPool) RemoveExecuted(tx *types.Transaction) {
 	defer pool.lock.Unlock()
 
 	delete(pool.currentExecuting, tx.Hash())
+	if _, ok := pool.executed[tx.Hash()]; ok {
+		return
+	}
+	// add the executed to the executed map and list, forgetting the oldest
+	// ones beyond the limit
+	pool.executed[tx.Hash()] = tx
+	pool.executedList = append(pool.executedList, tx.Hash())
+	if _, ok := pool.seen[tx.Hash()]; !ok {
+		pool.seen[tx.Hash()] = time.Now()
+	}
+	pool.journalTx(tx, TxStatusExecuted)
 
-	// add the executed to the executed map and list
-	if len(pool.executed) == MAXExecutedNum {
+	for len(pool.executed) > pool.config.ExecutedLimit {
 		removed_hash := pool.executedList[0]
 		pool.executedList = pool.executedList[1:]
-		pool.executedList = append(pool.executedList, tx.Hash())
-		delete(pool.executed, removed_hash)
-		pool.executed[tx.Hash()] = tx
-
-	} else {
-		pool.executed[tx.Hash()] = tx
-		pool.executedList = append(pool.executedList, tx.Hash())
+		if _, ok := pool.executed[removed_hash]; ok {
+			pool.forget(removed_hash)
+			executedEvictionMeter.Mark(1)
+		}
 	}
-	
 }
 
-
-// Promote transactions
-func (pool *SimTxPool) PromoteQueue() []*types.Transaction {
+// PromoteQueue hands over the queued transactions whose nonce gap is filled,
+// as reported by next for their sender given the head state, and forgets those
+// whose nonce got consumed on chain.
+func (pool *SimTxPool) PromoteQueue(next func(from common.Address, head *state.StateDB) uint64) []*types.Transaction {
 	pool.lock.Lock()
 	defer pool.lock.Unlock()
 
 	news := []*types.Transaction{}
 
-	// check the queue one by one 
+	// check the queue one by one
 	current_block := pool.chain.CurrentBlock()
-	fmt.Printf("PromoteQueue current block %d\n", current_block.Number())
+	log.Trace("Promoting queued simulations", "number", current_block.Number())
 	current_state, err := pool.chain.StateAt(current_block.Root())
 	if err != nil {
-		fmt.Printf("%s Get current state error\n", time.Now())
+		log.Warn("Failed to retrieve head state for promotion", "number", current_block.Number(), "err", err)
 		return nil
 	}
 
+	signer := pool.Signer()
 	for _, tx := range pool.queue {
-		from, _ := types.Sender(pool.signer, tx)
-		if tx.Nonce() == current_state.GetNonce(from) {
+		from, _ := types.Sender(signer, tx)
+		if tx.Nonce() == next(from, current_state) {
+			// The gap is filled, hand the transaction over for simulation
 			news = append(news, tx)
+			delete(pool.queue, tx.Hash())
+			pool.currentExecuting[tx.Hash()] = tx
 		}
 		if tx.Nonce() < current_state.GetNonce(from) {
-			delete(pool.queue, tx.Hash())
+			pool.forget(tx.Hash())
 		}
 	}
 	return news
-	
-}
 
+}
 
 // validateTx checks whether a transaction is valid according to the consensus
 // rules and adheres to some heuristic limits of the local node (price and size).
@@ -547,7 +877,7 @@ func (pool *SimTxPool) validateTx(tx *types.Transaction, current_state *state.St
 		return SimErrGasLimit
 	}
 	// Make sure the transaction is signed properly
-	from, err := types.Sender(pool.signer, tx)
+	from, err := types.Sender(pool.Signer(), tx)
 	if err != nil {
 		return SimErrInvalidSender
 	}
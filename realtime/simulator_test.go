@@ -0,0 +1,101 @@
+package realtime
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/eth/downloader"
+	"github.com/ethereum/go-ethereum/eth/syncstatus"
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/trace"
+)
+
+// testBackend is the Backend of a simulator without networking.
+type testBackend struct {
+	chain      *core.BlockChain
+	txPool     *core.TxPool
+	syncStatus *syncstatus.Service
+}
+
+func (b *testBackend) BlockChain() *core.BlockChain    { return b.chain }
+func (b *testBackend) TxPool() *core.TxPool            { return b.txPool }
+func (b *testBackend) SyncStatus() *syncstatus.Service { return b.syncStatus }
+
+func TestSimulatePoolTransactions(t *testing.T) {
+	base, _ := newTestSimulator(t, false)
+	config := core.DefaultTxPoolConfig
+	config.Journal = ""
+	pool := core.NewTxPool(config, base.chainConfig, base.chain)
+	defer pool.Stop()
+
+	mux := new(event.TypeMux)
+	defer mux.Stop()
+	status := syncstatus.New(syncstatus.Config{}, mux, base.chain, nil)
+	status.Start()
+	defer status.Stop()
+
+	sink := trace.NewMemorySink()
+	simulator := New(&testBackend{base.chain, pool, status}, base.chainConfig, nil, &trace.Config{Kinds: trace.DefaultConfig.Kinds, Workers: 2, QueueSize: 16}, nil, &core.DefaultTxPoolConfig, sink)
+	defer simulator.Close()
+	simulator.Start()
+
+	// Nothing is simulated while the node is catching up
+	early := transfer(t, otherKey, 0, 1)
+	if err := pool.AddLocal(early); err != nil {
+		t.Fatalf("failed to add transaction to the pool: %v", err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if status := simulator.simTxPool.Get(early.Hash()); status != TxStatusUnknown {
+		t.Fatalf("transaction simulated before the node synced: status %v", status)
+	}
+	mux.Post(downloader.DoneEvent{})
+	for deadline := time.Now().Add(5 * time.Second); !simulator.isSynced(); time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("simulator not resumed after the node synced")
+		}
+	}
+	// Locally submitted transactions never pass the protocol handler
+	tx := transfer(t, testKey, 0, 1)
+	if err := pool.AddLocal(tx); err != nil {
+		t.Fatalf("failed to add transaction to the pool: %v", err)
+	}
+	for deadline := time.Now().Add(5 * time.Second); simulator.simTxPool.Get(tx.Hash()) != TxStatusExecuted; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("pool transaction not simulated")
+		}
+	}
+	records := sink.Records()
+	if len(records) != 1 || records[0].TxHash != tx.Hash() {
+		t.Fatalf("simulation records mismatch: have %d records, want 1 of %x", len(records), tx.Hash())
+	}
+}
+
+func TestControlAfterClose(t *testing.T) {
+	base, _ := newTestSimulator(t, false)
+	config := core.DefaultTxPoolConfig
+	config.Journal = ""
+	pool := core.NewTxPool(config, base.chainConfig, base.chain)
+	defer pool.Stop()
+
+	mux := new(event.TypeMux)
+	defer mux.Stop()
+	status := syncstatus.New(syncstatus.Config{}, mux, base.chain, nil)
+
+	simulator := New(&testBackend{base.chain, pool, status}, base.chainConfig, nil, &trace.Config{Kinds: trace.DefaultConfig.Kinds, Workers: 1, QueueSize: 1}, nil, &core.DefaultTxPoolConfig, trace.NewMemorySink())
+	if err := simulator.Close(); err != nil {
+		t.Fatalf("failed to close simulator: %v", err)
+	}
+	// Control requests arriving after shutdown must not block the caller
+	done := make(chan struct{})
+	go func() {
+		simulator.Start()
+		simulator.Stop()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("control request blocked after close")
+	}
+}
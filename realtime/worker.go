@@ -0,0 +1,124 @@
+package realtime
+
+import (
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+)
+
+var (
+	// Metrics of the simulation intake queue
+	queueInMeter      = metrics.NewRegisteredMeter("realtime/queue/in", nil)
+	queueDroppedMeter = metrics.NewRegisteredMeter("realtime/queue/dropped", nil) // Dropped due to a full queue
+	queueSkippedMeter = metrics.NewRegisteredMeter("realtime/queue/skipped", nil) // Dequeued while paused
+	queueGauge        = metrics.NewRegisteredGauge("realtime/queue", nil)
+
+	// Metrics of the simulations themselves
+	simulatedMeter  = metrics.NewRegisteredMeter("realtime/simulated", nil)
+	failedMeter     = metrics.NewRegisteredMeter("realtime/failed", nil)
+	simulationTimer = metrics.NewRegisteredTimer("realtime/duration", nil)
+)
+
+// worker simulates the transactions taken from the intake queue. Each worker
+// keeps its own copy of the head state, which isolated simulations run on and
+// revert afterwards, so workers never contend on state and the copy's caches
+// stay warm between the transactions of a block.
+type worker struct {
+	simulator *Simulator
+
+	root  common.Hash    // state root of the head the state copy belongs to
+	state *state.StateDB // head state copy, nil until the first simulation
+}
+
+// headState returns the worker's copy of the given head's state, replacing it
+// if the chain moved on since the last simulation.
+func (w *worker) headState(head *types.Block) (*state.StateDB, error) {
+	if w.state == nil || w.root != head.Root() {
+		statedb, err := w.simulator.chain.StateAt(head.Root())
+		if err != nil {
+			return nil, err
+		}
+		w.root, w.state = head.Root(), statedb
+	}
+	return w.state, nil
+}
+
+// loop simulates queued transactions until the simulator is closed.
+func (w *worker) loop() {
+	defer w.simulator.wg.Done()
+
+	for {
+		select {
+		case tx := <-w.simulator.taskCh:
+			queueGauge.Update(int64(len(w.simulator.taskCh)))
+			w.simulate(tx)
+		case <-w.simulator.exitCh:
+			return
+		}
+	}
+}
+
+// simulate executes a dequeued transaction, unless the simulator was paused
+// since it was queued.
+func (w *worker) simulate(tx *types.Transaction) {
+	simulator := w.simulator
+	if !simulator.isRunning() || !simulator.isSynced() {
+		queueSkippedMeter.Mark(1)
+		simulator.simTxPool.Discard(tx)
+		return
+	}
+	var statedb *state.StateDB
+	if !simulator.rolling {
+		var err error
+		if statedb, err = w.headState(simulator.chain.CurrentBlock()); err != nil {
+			log.Warn("Failed to retrieve the head state", "err", err)
+			simulator.simTxPool.Discard(tx)
+			return
+		}
+	}
+	start := time.Now()
+	_, err := simulator.executeTransaction(tx, statedb)
+	if err != nil {
+		failedMeter.Mark(1)
+	} else {
+		simulatedMeter.Mark(1)
+	}
+	simulationTimer.UpdateSince(start)
+	simulator.simTxPool.RemoveExecuted(tx)
+
+	// A transaction stacked on the pending state may fill the nonce gap of
+	// queued ones, which don't have to wait for it to be mined
+	if simulator.rolling && err == nil {
+		simulator.enqueue(simulator.simTxPool.PromoteQueue(simulator.nextNonce))
+	}
+}
+
+// enqueue hands transactions over to the workers without blocking. When the
+// workers fall behind and the queue is full, the excess transactions are
+// dropped and returned, so that callers feel the backpressure instead of
+// stalling the transaction pool or the peer handlers feeding the simulator.
+func (simulator *Simulator) enqueue(txs []*types.Transaction) []*types.Transaction {
+	var dropped []*types.Transaction
+	for _, tx := range txs {
+		select {
+		case simulator.taskCh <- tx:
+			queueInMeter.Mark(1)
+		default:
+			dropped = append(dropped, tx)
+		}
+	}
+	queueGauge.Update(int64(len(simulator.taskCh)))
+
+	if len(dropped) > 0 {
+		queueDroppedMeter.Mark(int64(len(dropped)))
+		for _, tx := range dropped {
+			simulator.simTxPool.Discard(tx)
+		}
+		log.Debug("Simulation queue full, dropping transactions", "dropped", len(dropped), "capacity", cap(simulator.taskCh))
+	}
+	return dropped
+}
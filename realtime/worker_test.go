@@ -0,0 +1,112 @@
+package realtime
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+func TestWorkerQueueBackpressure(t *testing.T) {
+	simulator, sink := newTestSimulator(t, false)
+	simulator.taskCh = make(chan *types.Transaction, 1)
+	simulator.exitCh = make(chan struct{})
+	simulator.running, simulator.synced = 1, 1
+
+	// Without workers, only the first transaction fits into the queue
+	queued, dropped := transfer(t, testKey, 0, 1), transfer(t, otherKey, 0, 1)
+	errs := simulator.HandleMessages([]*types.Transaction{queued, dropped})
+	if errs[0] != nil || errs[1] != SimErrQueueFull {
+		t.Fatalf("intake errors mismatch: have %v, want [<nil> %v]", errs, SimErrQueueFull)
+	}
+	if status := simulator.simTxPool.Get(dropped.Hash()); status != TxStatusUnknown {
+		t.Fatalf("dropped transaction retained: status %v", status)
+	}
+	// Once the workers drain the queue, the dropped transaction is accepted again
+	simulator.wg.Add(2)
+	for i := 0; i < 2; i++ {
+		go (&worker{simulator: simulator}).loop()
+	}
+	defer func() {
+		close(simulator.exitCh)
+		simulator.wg.Wait()
+	}()
+	waitExecuted(t, simulator, queued)
+
+	if errs := simulator.HandleMessages([]*types.Transaction{dropped}); errs[0] != nil {
+		t.Fatalf("failed to queue transaction: %v", errs[0])
+	}
+	waitExecuted(t, simulator, dropped)
+
+	if records := sink.Records(); len(records) != 2 {
+		t.Fatalf("simulation records mismatch: have %d, want 2", len(records))
+	}
+}
+
+func TestWorkerSkipsWhilePaused(t *testing.T) {
+	simulator, sink := newTestSimulator(t, false)
+	w := &worker{simulator: simulator}
+
+	tx := transfer(t, testKey, 0, 1)
+	simulator.simTxPool.Add(tx, 0)
+	w.simulate(tx)
+	if status := simulator.simTxPool.Get(tx.Hash()); status != TxStatusUnknown {
+		t.Fatalf("transaction simulated while paused: status %v", status)
+	}
+	// Simulations reuse the worker's head state without leaking their effects
+	simulator.running, simulator.synced = 1, 1
+	for i := 0; i < 2; i++ {
+		simulator.simTxPool.Add(tx, 0)
+		w.simulate(tx)
+	}
+	// The record of the second simulation supersedes the first one
+	if records := sink.Records(); len(records) != 1 || records[0].TxReceipt.Status != types.ReceiptStatusSuccessful {
+		t.Fatalf("repeated simulation mismatch: have %d records", len(records))
+	}
+	if nonce := w.state.GetNonce(testAddress); nonce != 0 {
+		t.Errorf("worker state modified: nonce %d, want 0", nonce)
+	}
+}
+
+func TestWorkerPromotesStackedGap(t *testing.T) {
+	simulator, _ := newTestSimulator(t, true)
+	simulator.taskCh = make(chan *types.Transaction, 4)
+	simulator.running, simulator.synced = 1, 1
+	w := &worker{simulator: simulator}
+
+	// The follow-up arrives before the transaction it depends on is stacked
+	first, second := transfer(t, testKey, 0, 1), transfer(t, testKey, 1, 1)
+	if errs := simulator.HandleMessages([]*types.Transaction{first}); errs[0] != nil {
+		t.Fatalf("failed to queue transaction: %v", errs[0])
+	}
+	if errs := simulator.HandleMessages([]*types.Transaction{second}); errs[0] != nil {
+		t.Fatalf("failed to queue transaction: %v", errs[0])
+	}
+	if status := simulator.simTxPool.Get(second.Hash()); status != TxStatusQueued {
+		t.Fatalf("follow-up status mismatch: have %v, want %v", status, TxStatusQueued)
+	}
+	// Stacking the first one promotes the follow-up without a new head
+	w.simulate(<-simulator.taskCh)
+	select {
+	case tx := <-simulator.taskCh:
+		if tx.Hash() != second.Hash() {
+			t.Fatalf("promoted transaction mismatch: have %x, want %x", tx.Hash(), second.Hash())
+		}
+		w.simulate(tx)
+	default:
+		t.Fatal("follow-up not promoted after the gap was filled")
+	}
+	if nonce := simulator.pending.state.GetNonce(testAddress); nonce != 2 {
+		t.Errorf("pending nonce mismatch: have %d, want 2", nonce)
+	}
+}
+
+// waitExecuted waits until the simulation of the transaction completes.
+func waitExecuted(t *testing.T, simulator *Simulator, tx *types.Transaction) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); simulator.simTxPool.Get(tx.Hash()) != TxStatusExecuted; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("transaction %x not simulated", tx.Hash())
+		}
+	}
+}
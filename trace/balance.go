@@ -0,0 +1,137 @@
+package trace
+
+import (
+	"io"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+//go:generate gencodec -type BalanceDelta -field-override balanceDeltaMarshaling -out gen_balancedelta_json.go
+
+// BalanceDelta is the change of an address' holdings of a single asset caused
+// by the value transfers of a transaction. Received and Sent are the gross
+// amounts, the net change is Received - Sent. Gas payments are not included,
+// see TxReceipt.GasFee instead.
+type BalanceDelta struct {
+	Address  common.Address `json:"address"`
+	Standard string         `json:"standard"`
+	Token    common.Address `json:"token"`        // zero for ETH
+	ID       *big.Int       `json:"id,omitempty"` // token id, only meaningful for ERC721 and ERC1155
+	Received *big.Int       `json:"received"`
+	Sent     *big.Int       `json:"sent"`
+}
+
+type balanceDeltaMarshaling struct {
+	ID       *hexutil.Big
+	Received *hexutil.Big
+	Sent     *hexutil.Big
+}
+
+// balanceDeltaRLP is the RLP encoding of a BalanceDelta.
+type balanceDeltaRLP struct {
+	Address  common.Address
+	Standard string
+	Token    common.Address
+	ID       []*big.Int
+	Received *big.Int
+	Sent     *big.Int
+}
+
+// EncodeRLP implements rlp.Encoder.
+func (d *BalanceDelta) EncodeRLP(w io.Writer) error {
+	return rlp.Encode(w, balanceDeltaRLP{
+		Address:  d.Address,
+		Standard: d.Standard,
+		Token:    d.Token,
+		ID:       encodeTokenID(d.ID),
+		Received: d.Received,
+		Sent:     d.Sent,
+	})
+}
+
+// DecodeRLP implements rlp.Decoder.
+func (d *BalanceDelta) DecodeRLP(s *rlp.Stream) error {
+	var dec balanceDeltaRLP
+	if err := s.Decode(&dec); err != nil {
+		return err
+	}
+	id, err := decodeTokenID(dec.ID)
+	if err != nil {
+		return err
+	}
+	*d = BalanceDelta{
+		Address:  dec.Address,
+		Standard: dec.Standard,
+		Token:    dec.Token,
+		ID:       id,
+		Received: dec.Received,
+		Sent:     dec.Sent,
+	}
+	return nil
+}
+
+// Net returns the signed balance change, Received - Sent.
+func (d *BalanceDelta) Net() *big.Int {
+	return new(big.Int).Sub(d.Received, d.Sent)
+}
+
+// assetKey identifies a single asset held by an address.
+type assetKey struct {
+	addr     common.Address
+	standard string
+	token    common.Address
+	id       string
+}
+
+// BalanceDeltas nets the given transfers into per address and asset balance
+// changes, ordered by first appearance. Reverted transfers are skipped, as are
+// the zero address counterparties of token mints and burns. The result is nil
+// if no balance changes.
+func BalanceDeltas(transfers []AssetTransfer) []BalanceDelta {
+	var (
+		deltas []BalanceDelta
+		index  = make(map[assetKey]int)
+	)
+	get := func(addr common.Address, t *AssetTransfer) *BalanceDelta {
+		key := assetKey{addr: addr, standard: t.Standard, token: t.Token}
+		if t.ID != nil {
+			key.id = t.ID.String()
+		}
+		if i, ok := index[key]; ok {
+			return &deltas[i]
+		}
+		index[key] = len(deltas)
+		delta := BalanceDelta{
+			Address:  addr,
+			Standard: t.Standard,
+			Token:    t.Token,
+			Received: new(big.Int),
+			Sent:     new(big.Int),
+		}
+		if t.ID != nil {
+			delta.ID = new(big.Int).Set(t.ID)
+		}
+		deltas = append(deltas, delta)
+		return &deltas[len(deltas)-1]
+	}
+	for i := range transfers {
+		t := &transfers[i]
+		if t.Reverted || t.Amount == nil {
+			continue
+		}
+		// Ether sent to the zero address is burnt for good, but tokens "sent"
+		// from or to it are minted or burnt by the token contract.
+		if t.Standard == StandardETH || t.From != (common.Address{}) {
+			sent := get(t.From, t).Sent
+			sent.Add(sent, t.Amount)
+		}
+		if t.Standard == StandardETH || t.To != (common.Address{}) {
+			received := get(t.To, t).Received
+			received.Add(received, t.Amount)
+		}
+	}
+	return deltas
+}
@@ -0,0 +1,81 @@
+package trace
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+func TestBalanceDeltas(t *testing.T) {
+	var (
+		alice = common.Address{0xaa}
+		bob   = common.Address{0xbb}
+		weth  = common.Address{0xee}
+		nft   = common.Address{0xcc}
+	)
+	transfers := []AssetTransfer{
+		// alice wraps 10 wei
+		{Standard: StandardETH, From: alice, To: weth, Amount: big.NewInt(10)},
+		{Standard: StandardWETH, Token: weth, To: alice, Amount: big.NewInt(10)},
+		// and sends 4 of them to bob, who sends 1 back
+		{Standard: StandardERC20, Token: weth, From: alice, To: bob, Amount: big.NewInt(4)},
+		{Standard: StandardERC20, Token: weth, From: bob, To: alice, Amount: big.NewInt(1)},
+		// a reverted payment has no effect
+		{Standard: StandardETH, From: bob, To: alice, Amount: big.NewInt(100), Reverted: true},
+		// nft ids are tracked separately
+		{Standard: StandardERC721, Token: nft, From: bob, To: alice, ID: big.NewInt(1), Amount: big.NewInt(1)},
+		{Standard: StandardERC721, Token: nft, From: bob, To: alice, ID: big.NewInt(2), Amount: big.NewInt(1)},
+	}
+	want := []struct {
+		addr     common.Address
+		standard string
+		token    common.Address
+		id       int64
+		net      int64
+	}{
+		{alice, StandardETH, common.Address{}, -1, -10},
+		{weth, StandardETH, common.Address{}, -1, 10},
+		{alice, StandardWETH, weth, -1, 10},
+		{alice, StandardERC20, weth, -1, -3},
+		{bob, StandardERC20, weth, -1, 3},
+		{bob, StandardERC721, nft, 1, -1},
+		{alice, StandardERC721, nft, 1, 1},
+		{bob, StandardERC721, nft, 2, -1},
+		{alice, StandardERC721, nft, 2, 1},
+	}
+	deltas := BalanceDeltas(transfers)
+	if len(deltas) != len(want) {
+		t.Fatalf("delta count mismatch: have %d, want %d", len(deltas), len(want))
+	}
+	for i, w := range want {
+		have := deltas[i]
+		if have.Address != w.addr || have.Standard != w.standard || have.Token != w.token || have.Net().Int64() != w.net {
+			t.Errorf("delta %d mismatch: have %+v (net %v), want %+v", i, have, have.Net(), w)
+		}
+		if (w.id < 0) != (have.ID == nil) || (have.ID != nil && have.ID.Int64() != w.id) {
+			t.Errorf("delta %d id mismatch: have %v, want %d", i, have.ID, w.id)
+		}
+	}
+}
+
+// Tests that the deltas of fungible assets don't come back from the record
+// encoding as holdings of token id 0.
+func TestBalanceDeltaRLPRoundtrip(t *testing.T) {
+	deltas := []BalanceDelta{
+		{Address: common.Address{0xaa}, Standard: StandardETH, Received: big.NewInt(1), Sent: big.NewInt(0)},
+		{Address: common.Address{0xaa}, Standard: StandardERC721, Token: common.Address{0xcc}, ID: big.NewInt(0), Received: big.NewInt(1), Sent: big.NewInt(0)},
+	}
+	blob, err := rlp.EncodeToBytes(deltas)
+	if err != nil {
+		t.Fatalf("failed to encode: %v", err)
+	}
+	var have []BalanceDelta
+	if err := rlp.DecodeBytes(blob, &have); err != nil {
+		t.Fatalf("failed to decode: %v", err)
+	}
+	if len(have) != 2 || have[0].ID != nil || have[1].ID == nil || have[1].ID.Sign() != 0 {
+		t.Errorf("token ids mismatch: have %+v", have)
+	}
+}
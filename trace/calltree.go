@@ -0,0 +1,63 @@
+package trace
+
+import (
+	"fmt"
+)
+
+// CallNode is a call frame together with the frames it invoked, in the order
+// they were invoked.
+type CallNode struct {
+	Frame TraceN      `json:"frame"`
+	Calls []*CallNode `json:"calls,omitempty"`
+}
+
+// BuildCallTree rebuilds the call tree of a transaction from its flat list of
+// frames, as stored in TransactionAll.TxTraces. It returns nil if the
+// transaction executed no frames.
+func BuildCallTree(traces []TraceN) (*CallNode, error) {
+	if len(traces) == 0 {
+		return nil, nil
+	}
+	nodes := make([]*CallNode, len(traces))
+	for i, t := range traces {
+		if t.TraceIndex != uint64(i) {
+			return nil, fmt.Errorf("frame %d out of order: trace index %d", i, t.TraceIndex)
+		}
+		nodes[i] = &CallNode{Frame: t}
+		if i == 0 {
+			if len(t.TraceAddress) != 0 {
+				return nil, fmt.Errorf("root frame has trace address %v", t.TraceAddress)
+			}
+			continue
+		}
+		if len(t.TraceAddress) == 0 {
+			return nil, fmt.Errorf("frame %d is a second root", i)
+		}
+		if t.ParentIndex >= uint64(i) {
+			return nil, fmt.Errorf("frame %d follows its parent %d", i, t.ParentIndex)
+		}
+		parent := nodes[t.ParentIndex]
+		parent.Calls = append(parent.Calls, nodes[i])
+	}
+	return nodes[0], nil
+}
+
+// Flatten returns the frames of the tree rooted at n in pre-order, which is
+// the flat view stored in TransactionAll.TxTraces.
+func (n *CallNode) Flatten() []TraceN {
+	var traces []TraceN
+	var walk func(*CallNode)
+	walk = func(node *CallNode) {
+		traces = append(traces, node.Frame)
+		for _, child := range node.Calls {
+			walk(child)
+		}
+	}
+	walk(n)
+	return traces
+}
+
+// CallTree rebuilds the call tree of the transaction from its flat trace list.
+func (tx *TransactionAll) CallTree() (*CallNode, error) {
+	return BuildCallTree(tx.TxTraces)
+}
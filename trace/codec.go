@@ -0,0 +1,59 @@
+package trace
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// EncodeRecord returns the canonical RLP encoding of a trace record.
+func EncodeRecord(tx *TransactionAll) ([]byte, error) {
+	return rlp.EncodeToBytes(tx)
+}
+
+// DecodeRecord decodes an RLP encoded trace record.
+func DecodeRecord(blob []byte) (*TransactionAll, error) {
+	tx := new(TransactionAll)
+	if err := rlp.DecodeBytes(blob, tx); err != nil {
+		return nil, err
+	}
+	if tx.Version != RecordVersion {
+		return nil, fmt.Errorf("unsupported trace record version %d", tx.Version)
+	}
+	// RLP can't tell a missing list from an empty one, restore the nil lists
+	// the collector records when there's nothing to report.
+	if len(tx.TxTransfers) == 0 {
+		tx.TxTransfers = nil
+	}
+	if len(tx.TxBalances) == 0 {
+		tx.TxBalances = nil
+	}
+	if len(tx.TxCreatedSC) == 0 {
+		tx.TxCreatedSC = nil
+	}
+	if len(tx.TxReplaces) == 0 {
+		tx.TxReplaces = nil
+	}
+	if len(tx.TxContext) == 0 {
+		tx.TxContext = nil
+	}
+	return tx, nil
+}
+
+// EncodeRecordJSON returns the JSON encoding of a trace record.
+func EncodeRecordJSON(tx *TransactionAll) ([]byte, error) {
+	return json.Marshal(tx)
+}
+
+// DecodeRecordJSON decodes a JSON encoded trace record.
+func DecodeRecordJSON(blob []byte) (*TransactionAll, error) {
+	tx := new(TransactionAll)
+	if err := json.Unmarshal(blob, tx); err != nil {
+		return nil, err
+	}
+	if tx.Version != RecordVersion {
+		return nil, fmt.Errorf("unsupported trace record version %d", tx.Version)
+	}
+	return tx, nil
+}
@@ -0,0 +1,129 @@
+package trace
+
+import (
+	"bytes"
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func TestRecordRLPRoundtrip(t *testing.T) {
+	for i := range testRecords {
+		blob, err := EncodeRecord(&testRecords[i])
+		if err != nil {
+			t.Fatalf("record %d: failed to encode: %v", i, err)
+		}
+		have, err := DecodeRecord(blob)
+		if err != nil {
+			t.Fatalf("record %d: failed to decode: %v", i, err)
+		}
+		if !sameRecord(have, &testRecords[i]) {
+			t.Errorf("record %d mismatch: have %v, want %v", i, *have, testRecords[i])
+		}
+	}
+}
+
+// Tests that optional fields missing from a record aren't decoded as zero
+// values, which would turn fungible transfers into token id 0 transfers.
+func TestRecordRLPMissingFields(t *testing.T) {
+	want := &TransactionAll{
+		Version: RecordVersion,
+		TxHash:  common.Hash{0x03},
+		TxReceipt: &TxReceipt{
+			BlockNum: big.NewInt(102),
+			FromAddr: common.Address{0xaa},
+			ToAddr:   &testContract,
+			GasPrice: big.NewInt(1),
+			GasFee:   big.NewInt(0),
+			Value:    big.NewInt(0),
+			Status:   1,
+		},
+		TxTransfers: []AssetTransfer{{
+			Standard: StandardERC20,
+			Token:    testContract,
+			From:     common.Address{0xaa},
+			To:       common.Address{0xbb},
+			Amount:   big.NewInt(100),
+		}},
+		TxTraces: []TraceN{{CallType: "CALL", FromAddr: common.Address{0xaa}, ToAddr: &testContract, Value: new(big.Int), TraceAddress: []uint64{}}},
+	}
+	blob, err := EncodeRecord(want)
+	if err != nil {
+		t.Fatalf("failed to encode: %v", err)
+	}
+	have, err := DecodeRecord(blob)
+	if err != nil {
+		t.Fatalf("failed to decode: %v", err)
+	}
+	if have.TxTransfers[0].ID != nil {
+		t.Errorf("transfer id mismatch: have %v, want nil", have.TxTransfers[0].ID)
+	}
+	if have.TxBalances != nil || have.TxCreatedSC != nil {
+		t.Errorf("missing lists decoded: balances %v, created contracts %v", have.TxBalances, have.TxCreatedSC)
+	}
+	haveJSON, _ := EncodeRecordJSON(have)
+	wantJSON, _ := EncodeRecordJSON(want)
+	if !bytes.Equal(haveJSON, wantJSON) {
+		t.Errorf("record mismatch: have %s, want %s", haveJSON, wantJSON)
+	}
+}
+
+func TestRecordJSONRoundtrip(t *testing.T) {
+	for i := range testRecords {
+		blob, err := EncodeRecordJSON(&testRecords[i])
+		if err != nil {
+			t.Fatalf("record %d: failed to encode: %v", i, err)
+		}
+		have, err := DecodeRecordJSON(blob)
+		if err != nil {
+			t.Fatalf("record %d: failed to decode: %v", i, err)
+		}
+		if !sameRecord(have, &testRecords[i]) {
+			t.Errorf("record %d mismatch: have %v, want %v", i, *have, testRecords[i])
+		}
+	}
+}
+
+func TestRecordJSONFormat(t *testing.T) {
+	blob, err := EncodeRecordJSON(&testRecords[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc struct {
+		TxReceipt map[string]interface{} `json:"txReceipt"`
+	}
+	if err := json.Unmarshal(blob, &doc); err != nil {
+		t.Fatal(err)
+	}
+	for field, want := range map[string]string{
+		"blockNum": "0x64",
+		"gasUsed":  "0x5208",
+		"input":    "0xa9059cbb",
+		"toAddr":   "0xcc00000000000000000000000000000000000000",
+	} {
+		if have := doc.TxReceipt[field]; have != want {
+			t.Errorf("receipt field %s mismatch: have %v, want %v", field, have, want)
+		}
+	}
+}
+
+func TestRecordUnknownVersion(t *testing.T) {
+	tx := testRecords[0]
+	tx.Version = RecordVersion + 1
+
+	blob, err := EncodeRecord(&tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := DecodeRecord(blob); err == nil {
+		t.Error("expected error decoding RLP record with unknown version")
+	}
+	if blob, err = EncodeRecordJSON(&tx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := DecodeRecordJSON(blob); err == nil {
+		t.Error("expected error decoding JSON record with unknown version")
+	}
+}
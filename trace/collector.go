@@ -0,0 +1,174 @@
+package trace
+
+import (
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// TraceCollector gathers the call frames, token transfers and contract
+// creations observed while executing a single transaction. A collector is
+// created per transaction and attached to the EVM running it, so several
+// transactions can be traced concurrently without sharing any state.
+//
+// Frames are kept in the order they were entered, which is a pre-order walk of
+// the call tree: every frame is followed by the frames it invoked.
+//
+// A TraceCollector is not safe for concurrent use; it belongs to the goroutine
+// that drives the EVM it is attached to.
+type TraceCollector struct {
+	Transfers []AssetTransfer
+	CreatedSC []common.Address
+	Receipt   *TxReceipt
+
+	frames []*TraceN      // all frames opened so far, in pre-order
+	stack  []*TraceN      // frames currently executing, innermost last
+	state  *stateRecorder // read and write sets, nil unless enabled
+}
+
+// NewTraceCollector creates an empty collector for a single transaction.
+func NewTraceCollector() *TraceCollector {
+	return &TraceCollector{
+		Transfers: []AssetTransfer{},
+		CreatedSC: []common.Address{},
+		Receipt:   &TxReceipt{},
+	}
+}
+
+// EnterFrame opens a new call frame as a child of the currently executing one
+// and stamps the given trace with its position in the call tree. Any ether the
+// frame carries is recorded as a transfer. It must be paired with a call to
+// ExitFrame.
+func (c *TraceCollector) EnterFrame(t *TraceN) {
+	t.TraceIndex = uint64(len(c.frames))
+	t.TraceAddress = []uint64{}
+	t.Subtraces = 0
+	if parent := c.current(); parent != nil {
+		t.ParentIndex = parent.TraceIndex
+		t.TraceAddress = make([]uint64, len(parent.TraceAddress), len(parent.TraceAddress)+1)
+		copy(t.TraceAddress, parent.TraceAddress)
+		t.TraceAddress = append(t.TraceAddress, parent.Subtraces)
+		parent.Subtraces++
+	}
+	c.frames = append(c.frames, t)
+	c.stack = append(c.stack, t)
+	t.CallDepth = uint64(len(c.stack))
+
+	if t.Value != nil && t.Value.Sign() > 0 {
+		transfer := AssetTransfer{
+			Standard: StandardETH,
+			From:     t.FromAddr,
+			Amount:   new(big.Int).Set(t.Value),
+		}
+		switch t.CallType {
+		case "CALL":
+			transfer.To = *t.ToAddr
+		case "CREATE", "CREATE2":
+			transfer.To = *t.CreateAddr
+		case "SELFDESTRUCT":
+			transfer.From, transfer.To = *t.SuicideContract, *t.Beneficiary
+		default:
+			// CALLCODE keeps the value with the caller
+			return
+		}
+		c.addTransfer(transfer)
+	}
+}
+
+// ExitFrame closes the frame opened by EnterFrame, recording its output, the
+// gas left unused and the error it ended with. A failed frame has its state
+// changes rolled back, so it is marked as reverted together with every frame
+// and transfer recorded within it.
+func (c *TraceCollector) ExitFrame(t *TraceN, output []byte, gasLeft uint64, err error) {
+	t.Output = common.CopyBytes(output)
+	if gasLeft <= t.Gas {
+		t.GasUsed = t.Gas - gasLeft
+	}
+	if err != nil {
+		t.Error = err.Error()
+		t.Reverted = true
+		if reason, unpackErr := abi.UnpackRevert(output); unpackErr == nil {
+			t.RevertReason = reason
+		}
+		c.revertSince(t.TraceIndex)
+	}
+	c.stack = c.stack[:len(c.stack)-1]
+}
+
+// revertSince marks everything recorded since the frame with the given index
+// was opened as reverted. Frames are stored in pre-order, so these are exactly
+// the frames following it.
+func (c *TraceCollector) revertSince(index uint64) {
+	for _, t := range c.frames[index+1:] {
+		t.Reverted = true
+	}
+	for i := range c.Transfers {
+		if c.Transfers[i].TraceIndex >= index {
+			c.Transfers[i].Reverted = true
+		}
+	}
+}
+
+// AddSuicide records a self-destruct, which executes no code of its own and
+// therefore opens and closes its frame immediately.
+func (c *TraceCollector) AddSuicide(t *TraceN) {
+	c.EnterFrame(t)
+	c.stack = c.stack[:len(c.stack)-1]
+}
+
+// AddLog records the asset transfers described by an event emitted by the
+// current frame, as extracted by the registered event decoders.
+func (c *TraceCollector) AddLog(log *types.Log) {
+	for _, transfer := range DecodeTransfers(log) {
+		c.addTransfer(transfer)
+	}
+}
+
+// addTransfer records a transfer performed by the current frame.
+func (c *TraceCollector) addTransfer(transfer AssetTransfer) {
+	if frame := c.current(); frame != nil {
+		transfer.CallDepth = frame.CallDepth
+		transfer.TraceIndex = frame.TraceIndex
+	}
+	c.Transfers = append(c.Transfers, transfer)
+}
+
+// AddCreatedSC records the address of a contract created by the transaction.
+func (c *TraceCollector) AddCreatedSC(addr common.Address) {
+	c.CreatedSC = append(c.CreatedSC, addr)
+}
+
+// current returns the innermost executing frame, or nil outside of any frame.
+func (c *TraceCollector) current() *TraceN {
+	if len(c.stack) == 0 {
+		return nil
+	}
+	return c.stack[len(c.stack)-1]
+}
+
+// Traces returns the flat view of the call tree: a copy of every recorded
+// frame, in pre-order.
+func (c *TraceCollector) Traces() []TraceN {
+	traces := make([]TraceN, len(c.frames))
+	for i, t := range c.frames {
+		traces[i] = *t
+	}
+	return traces
+}
+
+// Record assembles the collected data into the record stored for the
+// transaction with the given hash, netting the transfers into balance deltas.
+func (c *TraceCollector) Record(txHash common.Hash) TransactionAll {
+	return TransactionAll{
+		Version:     RecordVersion,
+		TxHash:      txHash,
+		TxReceipt:   c.Receipt,
+		TxTransfers: c.Transfers,
+		TxBalances:  BalanceDeltas(c.Transfers),
+		TxTraces:    c.Traces(),
+		TxCreatedSC: c.CreatedSC,
+		TxState:     c.StateAccess(),
+	}
+}
@@ -0,0 +1,166 @@
+package trace
+
+import (
+	"bytes"
+	"errors"
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func TestCollectorFrames(t *testing.T) {
+	c := NewTraceCollector()
+
+	outer := &TraceN{CallType: "CALL", Value: new(big.Int)}
+	c.EnterFrame(outer)
+	inner := &TraceN{CallType: "STATICCALL", Value: new(big.Int)}
+	c.EnterFrame(inner)
+	c.AddLog(erc20Transfer(common.Address{0x01}, common.Address{0xaa}, common.Address{0xbb}, 1))
+	c.ExitFrame(inner, []byte{0x01}, 0, nil)
+	c.ExitFrame(outer, []byte{0x02}, 0, nil)
+
+	traces := c.Traces()
+	if len(traces) != 2 {
+		t.Fatalf("trace count mismatch: have %d, want %d", len(traces), 2)
+	}
+	if have := traces[0]; have.CallType != "CALL" || have.CallDepth != 1 || have.TraceIndex != 0 || !bytes.Equal(have.Output, []byte{0x02}) {
+		t.Errorf("outer frame mismatch: %+v", have)
+	}
+	if have := traces[1]; have.CallType != "STATICCALL" || have.CallDepth != 2 || have.TraceIndex != 1 || !bytes.Equal(have.Output, []byte{0x01}) {
+		t.Errorf("inner frame mismatch: %+v", have)
+	}
+	if have := c.Transfers[0]; have.CallDepth != 2 || have.TraceIndex != 1 {
+		t.Errorf("transfer position mismatch: %+v", have)
+	}
+}
+
+func TestCollectorIsolation(t *testing.T) {
+	a, b := NewTraceCollector(), NewTraceCollector()
+
+	a.EnterFrame(&TraceN{Value: new(big.Int)})
+	frame := &TraceN{Value: new(big.Int)}
+	b.EnterFrame(frame)
+
+	if frame.TraceIndex != 0 || frame.CallDepth != 1 || len(frame.TraceAddress) != 0 {
+		t.Errorf("collectors share state: %+v", frame)
+	}
+}
+
+func TestCollectorRevert(t *testing.T) {
+	c := NewTraceCollector()
+
+	// Revert reason "nope", abi encoded as a call to Error(string)
+	reason := common.FromHex("0x08c379a0" +
+		"0000000000000000000000000000000000000000000000000000000000000020" +
+		"0000000000000000000000000000000000000000000000000000000000000004" +
+		"6e6f706500000000000000000000000000000000000000000000000000000000")
+
+	outer := &TraceN{CallType: "CALL", Value: new(big.Int), Gas: 100000}
+	c.EnterFrame(outer)
+	reverted := &TraceN{CallType: "CALL", ToAddr: &testContract, Value: big.NewInt(1), Gas: 50000}
+	c.EnterFrame(reverted)
+	nested := &TraceN{CallType: "CALL", ToAddr: &testContract, Value: big.NewInt(2), Gas: 20000}
+	c.EnterFrame(nested)
+	c.AddLog(erc20Transfer(common.Address{0x01}, common.Address{0xaa}, common.Address{0xbb}, 1))
+	c.ExitFrame(nested, nil, 15000, nil)
+	c.ExitFrame(reverted, reason, 30000, errors.New("execution reverted"))
+	sibling := &TraceN{CallType: "CALL", ToAddr: &testContract, Value: big.NewInt(3), Gas: 40000}
+	c.EnterFrame(sibling)
+	c.AddLog(erc20Transfer(common.Address{0x02}, common.Address{0xaa}, common.Address{0xbb}, 1))
+	c.ExitFrame(sibling, nil, 40000, nil)
+	c.ExitFrame(outer, nil, 10000, nil)
+
+	want := map[uint64]struct {
+		gasUsed  uint64
+		reverted bool
+		reason   string
+	}{
+		0: {90000, false, ""},
+		1: {20000, true, "nope"},
+		2: {5000, true, ""},
+		3: {0, false, ""},
+	}
+	for _, have := range c.Traces() {
+		w := want[have.TraceIndex]
+		if have.GasUsed != w.gasUsed || have.Reverted != w.reverted || have.RevertReason != w.reason {
+			t.Errorf("frame %d mismatch: have gasUsed %d reverted %t reason %q, want %d %t %q",
+				have.TraceIndex, have.GasUsed, have.Reverted, have.RevertReason, w.gasUsed, w.reverted, w.reason)
+		}
+	}
+	// ether carried by reverted, ether carried by nested, token moved by nested,
+	// ether carried by sibling, token moved by sibling
+	wantReverted := []bool{true, true, true, false, false}
+	if len(c.Transfers) != len(wantReverted) {
+		t.Fatalf("transfer count mismatch: have %d, want %d", len(c.Transfers), len(wantReverted))
+	}
+	for i, want := range wantReverted {
+		if c.Transfers[i].Reverted != want {
+			t.Errorf("transfer %d revert flag mismatch: have %t, want %t", i, c.Transfers[i].Reverted, want)
+		}
+	}
+}
+
+func TestCollectorCallTree(t *testing.T) {
+	c := NewTraceCollector()
+
+	// root -> [a -> [a0, a1 (suicide)], b (create) -> [b0]], with a transfer
+	// emitted by root after its first child returned.
+	root := &TraceN{CallType: "CALL", Value: new(big.Int)}
+	c.EnterFrame(root)
+	a := &TraceN{CallType: "CALL", Value: new(big.Int)}
+	c.EnterFrame(a)
+	a0 := &TraceN{CallType: "STATICCALL", Value: new(big.Int)}
+	c.EnterFrame(a0)
+	c.ExitFrame(a0, nil, 0, nil)
+	c.AddSuicide(&TraceN{CallType: "SELFDESTRUCT", Value: new(big.Int)})
+	c.ExitFrame(a, nil, 0, nil)
+	c.AddLog(erc20Transfer(common.Address{0x01}, common.Address{0xaa}, common.Address{0xbb}, 1))
+	b := &TraceN{CallType: "CREATE", Value: new(big.Int)}
+	c.EnterFrame(b)
+	b0 := &TraceN{CallType: "DELEGATECALL", Value: new(big.Int)}
+	c.EnterFrame(b0)
+	c.ExitFrame(b0, nil, 0, nil)
+	c.ExitFrame(b, nil, 0, nil)
+	c.ExitFrame(root, nil, 0, nil)
+
+	want := []struct {
+		callType  string
+		parent    uint64
+		address   []uint64
+		subtraces uint64
+		depth     uint64
+	}{
+		{"CALL", 0, []uint64{}, 2, 1},
+		{"CALL", 0, []uint64{0}, 2, 2},
+		{"STATICCALL", 1, []uint64{0, 0}, 0, 3},
+		{"SELFDESTRUCT", 1, []uint64{0, 1}, 0, 3},
+		{"CREATE", 0, []uint64{1}, 1, 2},
+		{"DELEGATECALL", 4, []uint64{1, 0}, 0, 3},
+	}
+	traces := c.Traces()
+	if len(traces) != len(want) {
+		t.Fatalf("trace count mismatch: have %d, want %d", len(traces), len(want))
+	}
+	for i, w := range want {
+		have := traces[i]
+		if have.TraceIndex != uint64(i) || have.CallType != w.callType || have.ParentIndex != w.parent ||
+			!reflect.DeepEqual(have.TraceAddress, w.address) || have.Subtraces != w.subtraces || have.CallDepth != w.depth {
+			t.Errorf("frame %d mismatch: have %+v", i, have)
+		}
+	}
+	if have := c.Transfers[0]; have.TraceIndex != 0 || have.CallDepth != 1 {
+		t.Errorf("transfer attributed to wrong frame: %+v", have)
+	}
+	tree, err := BuildCallTree(traces)
+	if err != nil {
+		t.Fatalf("failed to build call tree: %v", err)
+	}
+	if len(tree.Calls) != 2 || len(tree.Calls[0].Calls) != 2 || len(tree.Calls[1].Calls) != 1 {
+		t.Errorf("call tree shape mismatch")
+	}
+	if flat := tree.Flatten(); !reflect.DeepEqual(flat, traces) {
+		t.Errorf("flattened tree mismatch: have %+v, want %+v", flat, traces)
+	}
+}
@@ -0,0 +1,78 @@
+package trace
+
+import (
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Config are the configuration parameters of the trace recorder.
+type Config struct {
+	Sync     bool // Whether to record the traces of the transactions in imported blocks
+	Realtime bool // Whether to simulate pending transactions and record their traces
+	Rolling  bool // Whether to stack simulated transactions on a shared pending state
+	State    bool // Whether to record the state read and write sets of the transactions
+
+	// Sink is the url of the backend trace records are written to, see
+	// OpenSink for the supported schemes.
+	Sink string `toml:",omitempty"`
+
+	Database string // MongoDB database name, overriding the one in the sink url
+	History  string // Collection (or file) name of the imported transaction records
+	Pending  string // Collection (or file) name of the simulated transaction records
+
+	BatchSize int    // Number of records inserted into the database at once
+	ErrorLog  string // File to log the records which could not be stored to
+
+	PauseLag  uint64 // Number of blocks behind the network after which recording pauses
+	ResumeLag uint64 // Number of blocks behind the network within which recording resumes
+
+	// Kinds of pending transactions simulated: "call" (to contracts), "create"
+	// (contract deployments), "transfer" (to externally owned accounts) and
+	// "unprotected" (signed without EIP155 replay protection)
+	Kinds []string `toml:",omitempty"`
+
+	Workers   int // Number of pending transactions simulated in parallel
+	QueueSize int // Maximum number of pending transactions waiting for a simulation worker
+
+	PoolJournal   string        // Journal of the queued and simulated transactions to survive node restarts
+	PoolRejournal time.Duration // Time interval to regenerate the simulation journal
+	PoolQueue     int           // Maximum number of transactions waiting for a nonce gap to be filled
+	PoolExecuted  int           // Maximum number of simulated transactions remembered
+	PoolLifetime  time.Duration // Maximum amount of time transactions are queued or remembered
+
+	Coinbase      common.Address `toml:",omitempty"` // Coinbase of the simulated blocks, the miner's etherbase if zero
+	BlockInterval time.Duration  // Expected time between blocks, simulated blocks are timestamped that long after their parent
+	Probe         bool           // Whether to simulate pending transactions again under alternative block contexts
+	Correlate     bool           // Whether to trace imported blocks to compare simulations with the mined executions, implied by Sync
+
+	// WETH are the wrapped ether contracts whose Deposit and Withdrawal events
+	// are recorded as mints and burns, see SetWETHTokens.
+	WETH []common.Address `toml:",omitempty"`
+}
+
+// DefaultConfig contains the default trace recorder settings. Recording is
+// disabled by default; once enabled, records go to the local MongoDB server.
+var DefaultConfig = Config{
+	Sink:      "mongodb://localhost",
+	Database:  "simulation",
+	History:   "history",
+	Pending:   "pending",
+	BatchSize: 100,
+	ErrorLog:  "db_error.log",
+	PauseLag:  8,
+	ResumeLag: 1,
+	Kinds:     []string{"call", "create", "transfer", "unprotected"},
+	Workers:   4,
+	QueueSize: 4096,
+
+	PoolJournal:   "simulations.rlp",
+	PoolRejournal: time.Hour,
+	PoolQueue:     4096,
+	PoolExecuted:  16384,
+	PoolLifetime:  3 * time.Hour,
+
+	BlockInterval: 13 * time.Second,
+
+	WETH: []common.Address{mainnetWETH},
+}
@@ -0,0 +1,90 @@
+package trace
+
+import (
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/ethdb/leveldb"
+)
+
+// DatabaseSink is a Sink storing RLP encoded records in a key-value store, keyed
+// by transaction hash. Writing a record for an already stored transaction
+// overwrites the previous one.
+type DatabaseSink struct {
+	db    ethdb.KeyValueStore
+	batch ethdb.Batch
+	lock  sync.Mutex
+}
+
+// NewDatabaseSink creates a sink on top of the given key-value store. The
+// store is closed together with the sink.
+func NewDatabaseSink(db ethdb.KeyValueStore) *DatabaseSink {
+	return &DatabaseSink{db: db, batch: db.NewBatch()}
+}
+
+// NewLevelDBSink opens (or creates) a LevelDB database at path for storing
+// records.
+func NewLevelDBSink(path string) (*DatabaseSink, error) {
+	db, err := leveldb.New(path, 16, 16, "trace/")
+	if err != nil {
+		return nil, err
+	}
+	return NewDatabaseSink(db), nil
+}
+
+// Write implements Sink, adding the record to the pending write batch.
+func (s *DatabaseSink) Write(tx TransactionAll) error {
+	blob, err := EncodeRecord(&tx)
+	if err != nil {
+		return err
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if err := s.batch.Put(tx.TxHash.Bytes(), blob); err != nil {
+		return err
+	}
+	if s.batch.ValueSize() < ethdb.IdealBatchSize {
+		return nil
+	}
+	return s.flush()
+}
+
+// Flush implements Sink, writing the pending batch to the store.
+func (s *DatabaseSink) Flush() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.flush()
+}
+
+// Close implements Sink, writing the pending batch and closing the store.
+func (s *DatabaseSink) Close() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if err := s.flush(); err != nil {
+		s.db.Close()
+		return err
+	}
+	return s.db.Close()
+}
+
+// flush writes the pending batch to the store. The caller must hold the lock.
+func (s *DatabaseSink) flush() error {
+	if err := s.batch.Write(); err != nil {
+		return err
+	}
+	s.batch.Reset()
+	return nil
+}
+
+// Get retrieves the record stored for the given transaction hash.
+func (s *DatabaseSink) Get(txHash common.Hash) (*TransactionAll, error) {
+	blob, err := s.db.Get(txHash.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	return DecodeRecord(blob)
+}
@@ -0,0 +1,229 @@
+package trace
+
+import (
+	"math/big"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// EventDecoder extracts the asset transfers described by a contract event. It
+// returns nil if the log does not have the layout the decoder understands. The
+// position fields of the returned transfers are filled in by the collector.
+type EventDecoder func(log *types.Log) []AssetTransfer
+
+// mainnetWETH is the address of the WETH9 contract on mainnet.
+var mainnetWETH = common.HexToAddress("0xC02aaA39b223FE8D0A0e5C4F27eAD9083C756Cc2")
+
+var (
+	decoders     = make(map[common.Hash][]EventDecoder)
+	wethTokens   = map[common.Address]bool{mainnetWETH: true}
+	decodersLock sync.RWMutex
+)
+
+// RegisterEventDecoder adds a decoder for the events whose first topic is the
+// given signature hash. Several decoders may be registered for one signature;
+// they all run, in registration order.
+func RegisterEventDecoder(topic common.Hash, decoder EventDecoder) {
+	decodersLock.Lock()
+	defer decodersLock.Unlock()
+
+	decoders[topic] = append(decoders[topic], decoder)
+}
+
+// SetWETHTokens sets the wrapped ether contracts whose Deposit and Withdrawal
+// events are decoded as mints and burns. The same events emitted by any other
+// contract, e.g. staking vaults or bridges, are ignored.
+func SetWETHTokens(tokens []common.Address) {
+	decodersLock.Lock()
+	defer decodersLock.Unlock()
+
+	wethTokens = make(map[common.Address]bool, len(tokens))
+	for _, token := range tokens {
+		wethTokens[token] = true
+	}
+}
+
+// isWETHToken reports whether the given contract is a wrapped ether token.
+func isWETHToken(addr common.Address) bool {
+	decodersLock.RLock()
+	defer decodersLock.RUnlock()
+
+	return wethTokens[addr]
+}
+
+// DecodeTransfers runs the decoders registered for the signature of the log,
+// returning all the transfers they extracted.
+func DecodeTransfers(log *types.Log) []AssetTransfer {
+	if len(log.Topics) == 0 {
+		return nil
+	}
+	decodersLock.RLock()
+	registered := decoders[log.Topics[0]]
+	decodersLock.RUnlock()
+
+	var transfers []AssetTransfer
+	for _, decode := range registered {
+		transfers = append(transfers, decode(log)...)
+	}
+	return transfers
+}
+
+var (
+	// Transfer(address indexed from, address indexed to, uint256 value), or
+	// Transfer(address indexed from, address indexed to, uint256 indexed tokenId)
+	transferTopic = crypto.Keccak256Hash([]byte("Transfer(address,address,uint256)"))
+
+	// TransferSingle(address indexed operator, address indexed from, address indexed to, uint256 id, uint256 value)
+	transferSingleTopic = crypto.Keccak256Hash([]byte("TransferSingle(address,address,address,uint256,uint256)"))
+
+	// TransferBatch(address indexed operator, address indexed from, address indexed to, uint256[] ids, uint256[] values)
+	transferBatchTopic = crypto.Keccak256Hash([]byte("TransferBatch(address,address,address,uint256[],uint256[])"))
+
+	// Deposit(address indexed dst, uint256 wad)
+	depositTopic = crypto.Keccak256Hash([]byte("Deposit(address,uint256)"))
+
+	// Withdrawal(address indexed src, uint256 wad)
+	withdrawalTopic = crypto.Keccak256Hash([]byte("Withdrawal(address,uint256)"))
+)
+
+func init() {
+	RegisterEventDecoder(transferTopic, decodeTransfer)
+	RegisterEventDecoder(transferSingleTopic, decodeTransferSingle)
+	RegisterEventDecoder(transferBatchTopic, decodeTransferBatch)
+	RegisterEventDecoder(depositTopic, decodeDeposit)
+	RegisterEventDecoder(withdrawalTopic, decodeWithdrawal)
+}
+
+// decodeTransfer decodes the Transfer event shared by ERC20 and ERC721, which
+// differ only in whether the last parameter is indexed.
+func decodeTransfer(log *types.Log) []AssetTransfer {
+	switch {
+	case len(log.Topics) == 3 && len(log.Data) >= 32:
+		return []AssetTransfer{{
+			Standard: StandardERC20,
+			Token:    log.Address,
+			From:     topicAddress(log.Topics[1]),
+			To:       topicAddress(log.Topics[2]),
+			Amount:   new(big.Int).SetBytes(log.Data[:32]),
+		}}
+	case len(log.Topics) == 4:
+		return []AssetTransfer{{
+			Standard: StandardERC721,
+			Token:    log.Address,
+			From:     topicAddress(log.Topics[1]),
+			To:       topicAddress(log.Topics[2]),
+			ID:       log.Topics[3].Big(),
+			Amount:   big.NewInt(1),
+		}}
+	}
+	return nil
+}
+
+func decodeTransferSingle(log *types.Log) []AssetTransfer {
+	if len(log.Topics) != 4 || len(log.Data) < 64 {
+		return nil
+	}
+	return []AssetTransfer{{
+		Standard: StandardERC1155,
+		Token:    log.Address,
+		From:     topicAddress(log.Topics[2]),
+		To:       topicAddress(log.Topics[3]),
+		ID:       new(big.Int).SetBytes(log.Data[:32]),
+		Amount:   new(big.Int).SetBytes(log.Data[32:64]),
+	}}
+}
+
+func decodeTransferBatch(log *types.Log) []AssetTransfer {
+	if len(log.Topics) != 4 {
+		return nil
+	}
+	ids, ok := abiWordArray(log.Data, 0)
+	if !ok {
+		return nil
+	}
+	amounts, ok := abiWordArray(log.Data, 1)
+	if !ok || len(ids) != len(amounts) {
+		return nil
+	}
+	transfers := make([]AssetTransfer, len(ids))
+	for i := range ids {
+		transfers[i] = AssetTransfer{
+			Standard: StandardERC1155,
+			Token:    log.Address,
+			From:     topicAddress(log.Topics[2]),
+			To:       topicAddress(log.Topics[3]),
+			ID:       ids[i],
+			Amount:   amounts[i],
+		}
+	}
+	return transfers
+}
+
+// decodeDeposit decodes a WETH deposit, which mints wrapped ether to dst.
+func decodeDeposit(log *types.Log) []AssetTransfer {
+	if len(log.Topics) != 2 || len(log.Data) < 32 || !isWETHToken(log.Address) {
+		return nil
+	}
+	return []AssetTransfer{{
+		Standard: StandardWETH,
+		Token:    log.Address,
+		To:       topicAddress(log.Topics[1]),
+		Amount:   new(big.Int).SetBytes(log.Data[:32]),
+	}}
+}
+
+// decodeWithdrawal decodes a WETH withdrawal, which burns wrapped ether of src.
+func decodeWithdrawal(log *types.Log) []AssetTransfer {
+	if len(log.Topics) != 2 || len(log.Data) < 32 || !isWETHToken(log.Address) {
+		return nil
+	}
+	return []AssetTransfer{{
+		Standard: StandardWETH,
+		Token:    log.Address,
+		From:     topicAddress(log.Topics[1]),
+		Amount:   new(big.Int).SetBytes(log.Data[:32]),
+	}}
+}
+
+// topicAddress extracts the address stored in an indexed event parameter.
+func topicAddress(topic common.Hash) common.Address {
+	return common.BytesToAddress(topic.Bytes())
+}
+
+// abiWordArray decodes the dynamic uint256[] which is the n-th parameter of
+// the ABI encoded data.
+func abiWordArray(data []byte, n int) ([]*big.Int, bool) {
+	offset, ok := abiWord(data, uint64(n)*32)
+	if !ok {
+		return nil, false
+	}
+	length, ok := abiWord(data, offset)
+	if !ok || length > uint64(len(data))/32 {
+		return nil, false
+	}
+	words := make([]*big.Int, length)
+	for i := range words {
+		pos := offset + 32 + uint64(i)*32
+		if pos+32 > uint64(len(data)) {
+			return nil, false
+		}
+		words[i] = new(big.Int).SetBytes(data[pos : pos+32])
+	}
+	return words, true
+}
+
+// abiWord decodes the 32 byte word at the given position as an offset or
+// length, rejecting values which cannot point into the data.
+func abiWord(data []byte, pos uint64) (uint64, bool) {
+	if pos > uint64(len(data)) || uint64(len(data))-pos < 32 {
+		return 0, false
+	}
+	word := new(big.Int).SetBytes(data[pos : pos+32])
+	if !word.IsUint64() || word.Uint64() > uint64(len(data)) {
+		return 0, false
+	}
+	return word.Uint64(), true
+}
@@ -0,0 +1,189 @@
+package trace
+
+import (
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// erc20Transfer creates the log of an ERC20 Transfer event.
+func erc20Transfer(token, from, to common.Address, amount int64) *types.Log {
+	return &types.Log{
+		Address: token,
+		Topics:  []common.Hash{transferTopic, addressTopic(from), addressTopic(to)},
+		Data:    math.U256Bytes(big.NewInt(amount)),
+	}
+}
+
+func addressTopic(addr common.Address) common.Hash {
+	return common.BytesToHash(addr.Bytes())
+}
+
+func words(values ...int64) []byte {
+	var data []byte
+	for _, v := range values {
+		data = append(data, math.U256Bytes(big.NewInt(v))...)
+	}
+	return data
+}
+
+func TestDecodeTransfers(t *testing.T) {
+	var (
+		token    = common.Address{0xcc}
+		operator = common.Address{0x0f}
+		from     = common.Address{0xaa}
+		to       = common.Address{0xbb}
+	)
+	tests := []struct {
+		name string
+		log  *types.Log
+		want []AssetTransfer
+	}{
+		{
+			name: "erc20",
+			log:  erc20Transfer(token, from, to, 500),
+			want: []AssetTransfer{{Standard: StandardERC20, Token: token, From: from, To: to, Amount: big.NewInt(500)}},
+		},
+		{
+			name: "erc721",
+			log: &types.Log{
+				Address: token,
+				Topics:  []common.Hash{transferTopic, addressTopic(from), addressTopic(to), common.BigToHash(big.NewInt(7))},
+			},
+			want: []AssetTransfer{{Standard: StandardERC721, Token: token, From: from, To: to, ID: big.NewInt(7), Amount: big.NewInt(1)}},
+		},
+		{
+			name: "erc1155 single",
+			log: &types.Log{
+				Address: token,
+				Topics:  []common.Hash{transferSingleTopic, addressTopic(operator), addressTopic(from), addressTopic(to)},
+				Data:    words(7, 20),
+			},
+			want: []AssetTransfer{{Standard: StandardERC1155, Token: token, From: from, To: to, ID: big.NewInt(7), Amount: big.NewInt(20)}},
+		},
+		{
+			name: "erc1155 batch",
+			log: &types.Log{
+				Address: token,
+				Topics:  []common.Hash{transferBatchTopic, addressTopic(operator), addressTopic(from), addressTopic(to)},
+				// offsets of ids and values, then ids [7, 8] and values [20, 30]
+				Data: words(64, 160, 2, 7, 8, 2, 20, 30),
+			},
+			want: []AssetTransfer{
+				{Standard: StandardERC1155, Token: token, From: from, To: to, ID: big.NewInt(7), Amount: big.NewInt(20)},
+				{Standard: StandardERC1155, Token: token, From: from, To: to, ID: big.NewInt(8), Amount: big.NewInt(30)},
+			},
+		},
+		{
+			name: "weth deposit",
+			log: &types.Log{
+				Address: mainnetWETH,
+				Topics:  []common.Hash{depositTopic, addressTopic(to)},
+				Data:    words(1000),
+			},
+			want: []AssetTransfer{{Standard: StandardWETH, Token: mainnetWETH, To: to, Amount: big.NewInt(1000)}},
+		},
+		{
+			name: "weth withdrawal",
+			log: &types.Log{
+				Address: mainnetWETH,
+				Topics:  []common.Hash{withdrawalTopic, addressTopic(from)},
+				Data:    words(1000),
+			},
+			want: []AssetTransfer{{Standard: StandardWETH, Token: mainnetWETH, From: from, Amount: big.NewInt(1000)}},
+		},
+		{
+			name: "non-weth deposit",
+			log: &types.Log{
+				Address: token,
+				Topics:  []common.Hash{depositTopic, addressTopic(to)},
+				Data:    words(1000),
+			},
+		},
+		{
+			name: "non-weth withdrawal",
+			log: &types.Log{
+				Address: token,
+				Topics:  []common.Hash{withdrawalTopic, addressTopic(from)},
+				Data:    words(1000),
+			},
+		},
+		{
+			name: "malformed batch",
+			log: &types.Log{
+				Address: token,
+				Topics:  []common.Hash{transferBatchTopic, addressTopic(operator), addressTopic(from), addressTopic(to)},
+				Data:    words(64, 1<<40),
+			},
+		},
+		{
+			name: "unknown event",
+			log: &types.Log{
+				Address: token,
+				Topics:  []common.Hash{{0x01}, addressTopic(from)},
+				Data:    words(1),
+			},
+		},
+		{
+			name: "anonymous event",
+			log:  &types.Log{Address: token},
+		},
+	}
+	for _, tt := range tests {
+		if have := DecodeTransfers(tt.log); !reflect.DeepEqual(have, tt.want) {
+			t.Errorf("%s: transfers mismatch: have %+v, want %+v", tt.name, have, tt.want)
+		}
+	}
+}
+
+func TestRegisterEventDecoder(t *testing.T) {
+	topic := common.Hash{0xee}
+	RegisterEventDecoder(topic, func(log *types.Log) []AssetTransfer {
+		return []AssetTransfer{{Standard: "CUSTOM", Token: log.Address, Amount: new(big.Int).SetBytes(log.Data)}}
+	})
+	c := NewTraceCollector()
+	frame := &TraceN{CallType: "STATICCALL", Value: new(big.Int)}
+	c.EnterFrame(frame)
+	c.AddLog(&types.Log{Address: common.Address{0xcc}, Topics: []common.Hash{topic}, Data: []byte{0x05}})
+	c.ExitFrame(frame, nil, 0, nil)
+
+	if len(c.Transfers) != 1 {
+		t.Fatalf("transfer count mismatch: have %d, want 1", len(c.Transfers))
+	}
+	if have := c.Transfers[0]; have.Standard != "CUSTOM" || have.Amount.Int64() != 5 || have.CallDepth != 1 {
+		t.Errorf("custom transfer mismatch: %+v", have)
+	}
+}
+
+func TestCollectorEtherTransfers(t *testing.T) {
+	var (
+		eoa      = common.Address{0xaa}
+		contract = common.Address{0xcc}
+		created  = common.Address{0xdd}
+		heir     = common.Address{0xee}
+	)
+	c := NewTraceCollector()
+	root := &TraceN{CallType: "CALL", FromAddr: eoa, ToAddr: &contract, Value: big.NewInt(10)}
+	c.EnterFrame(root)
+	callcode := &TraceN{CallType: "CALLCODE", FromAddr: contract, ToAddr: &heir, Value: big.NewInt(1)}
+	c.EnterFrame(callcode)
+	c.ExitFrame(callcode, nil, 0, nil)
+	create := &TraceN{CallType: "CREATE", FromAddr: contract, CreateAddr: &created, Value: big.NewInt(3)}
+	c.EnterFrame(create)
+	c.AddSuicide(&TraceN{CallType: "SELFDESTRUCT", FromAddr: contract, SuicideContract: &created, Beneficiary: &heir, Value: big.NewInt(3)})
+	c.ExitFrame(create, nil, 0, nil)
+	c.ExitFrame(root, nil, 0, nil)
+
+	want := []AssetTransfer{
+		{Standard: StandardETH, From: eoa, To: contract, Amount: big.NewInt(10), CallDepth: 1, TraceIndex: 0},
+		{Standard: StandardETH, From: contract, To: created, Amount: big.NewInt(3), CallDepth: 2, TraceIndex: 2},
+		{Standard: StandardETH, From: created, To: heir, Amount: big.NewInt(3), CallDepth: 3, TraceIndex: 3},
+	}
+	if !reflect.DeepEqual(c.Transfers, want) {
+		t.Errorf("ether transfers mismatch: have %+v, want %+v", c.Transfers, want)
+	}
+}
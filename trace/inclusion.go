@@ -0,0 +1,216 @@
+package trace
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// Fates of a simulated pending transaction, as recorded in Inclusion.Status.
+const (
+	InclusionIncluded = "included" // mined in the given block
+	InclusionReplaced = "replaced" // superseded by a known transaction mined with the same sender and nonce
+	InclusionDropped  = "dropped"  // nonce consumed by an unknown transaction, or never mined within the lifetime
+	InclusionReorged  = "reorged"  // the block it was mined in left the canonical chain
+)
+
+// Aspects of the outcome of a transaction compared by DiffRecords.
+const (
+	MismatchStatus    = "status"
+	MismatchGasUsed   = "gasUsed"
+	MismatchTraces    = "traces"
+	MismatchTransfers = "transfers"
+)
+
+// Inclusion is the eventual fate of a simulated pending transaction on chain.
+type Inclusion struct {
+	Status      string       `json:"status"`
+	BlockNumber uint64       `json:"blockNumber"` // block the transaction, or the one replacing it, was mined in
+	BlockHash   common.Hash  `json:"blockHash"`
+	TxIndex     uint64       `json:"txIndex"`              // position in the block
+	SimIndex    *uint64      `json:"simIndex,omitempty"`   // position on the rolling pending state, nil if simulated in isolation
+	ReplacedBy  *common.Hash `json:"replacedBy,omitempty"` // transaction mined with the same sender and nonce
+	Diff        *OutcomeDiff `json:"diff,omitempty"`       // simulated against actual outcome, if included
+}
+
+// IndexDelta returns how many positions later the transaction was mined than
+// simulated, and whether it was simulated at a position at all.
+func (i *Inclusion) IndexDelta() (int64, bool) {
+	if i.SimIndex == nil {
+		return 0, false
+	}
+	return int64(i.TxIndex) - int64(*i.SimIndex), true
+}
+
+// MarshalJSON marshals as JSON, adding the position delta if known.
+func (i Inclusion) MarshalJSON() ([]byte, error) {
+	type inclusion Inclusion
+	enc := struct {
+		inclusion
+		IndexDelta *int64 `json:"indexDelta,omitempty"`
+	}{inclusion: inclusion(i)}
+	if delta, ok := i.IndexDelta(); ok {
+		enc.IndexDelta = &delta
+	}
+	return json.Marshal(enc)
+}
+
+// inclusionRLP is the RLP encoding of an Inclusion.
+type inclusionRLP struct {
+	Status      string
+	BlockNumber uint64
+	BlockHash   common.Hash
+	TxIndex     uint64
+	SimIndex    []uint64
+	ReplacedBy  *common.Hash `rlp:"nil"`
+	Diff        *OutcomeDiff `rlp:"nil"`
+}
+
+// EncodeRLP implements rlp.Encoder.
+func (i *Inclusion) EncodeRLP(w io.Writer) error {
+	enc := inclusionRLP{
+		Status:      i.Status,
+		BlockNumber: i.BlockNumber,
+		BlockHash:   i.BlockHash,
+		TxIndex:     i.TxIndex,
+		ReplacedBy:  i.ReplacedBy,
+		Diff:        i.Diff,
+	}
+	// A nil index would otherwise be encoded the same as index 0
+	if i.SimIndex != nil {
+		enc.SimIndex = []uint64{*i.SimIndex}
+	}
+	return rlp.Encode(w, &enc)
+}
+
+// DecodeRLP implements rlp.Decoder.
+func (i *Inclusion) DecodeRLP(s *rlp.Stream) error {
+	var dec inclusionRLP
+	if err := s.Decode(&dec); err != nil {
+		return err
+	}
+	*i = Inclusion{
+		Status:      dec.Status,
+		BlockNumber: dec.BlockNumber,
+		BlockHash:   dec.BlockHash,
+		TxIndex:     dec.TxIndex,
+		ReplacedBy:  dec.ReplacedBy,
+		Diff:        dec.Diff,
+	}
+	switch len(dec.SimIndex) {
+	case 0:
+	case 1:
+		i.SimIndex = &dec.SimIndex[0]
+	default:
+		return fmt.Errorf("invalid simulation index list of %d items", len(dec.SimIndex))
+	}
+	return nil
+}
+
+// OutcomeDiff compares the simulated outcome of a transaction with the actual
+// one. Mismatches are where the state the transaction ran on changed between
+// simulation and mining, e.g. because it was front-run.
+type OutcomeDiff struct {
+	SimulatedStatus  uint64   `json:"simulatedStatus"`
+	ActualStatus     uint64   `json:"actualStatus"`
+	SimulatedGasUsed uint64   `json:"simulatedGasUsed"`
+	ActualGasUsed    uint64   `json:"actualGasUsed"`
+	Traced           bool     `json:"traced"`     // whether the traces and transfers were compared
+	Mismatches       []string `json:"mismatches"` // aspects of the outcome which differ
+}
+
+// DiffRecords compares the simulated record of a transaction with the record
+// of its actual execution. Call frames are compared without their gas, which
+// depends on the state accessed before; transfers are compared in full.
+func DiffRecords(simulated, actual *TransactionAll) *OutcomeDiff {
+	diff := &OutcomeDiff{
+		SimulatedStatus:  simulated.TxReceipt.Status,
+		ActualStatus:     actual.TxReceipt.Status,
+		SimulatedGasUsed: simulated.TxReceipt.GasUsed,
+		ActualGasUsed:    actual.TxReceipt.GasUsed,
+		Traced:           true,
+	}
+	diff.compare()
+	if !sameFrames(simulated.TxTraces, actual.TxTraces) {
+		diff.Mismatches = append(diff.Mismatches, MismatchTraces)
+	}
+	if !sameTransfers(simulated.TxTransfers, actual.TxTransfers) {
+		diff.Mismatches = append(diff.Mismatches, MismatchTransfers)
+	}
+	return diff
+}
+
+// DiffReceipt compares the simulated record of a transaction with the status
+// and gas used of its actual execution, when no record of the latter exists.
+func DiffReceipt(simulated *TransactionAll, status, gasUsed uint64) *OutcomeDiff {
+	diff := &OutcomeDiff{
+		SimulatedStatus:  simulated.TxReceipt.Status,
+		ActualStatus:     status,
+		SimulatedGasUsed: simulated.TxReceipt.GasUsed,
+		ActualGasUsed:    gasUsed,
+	}
+	diff.compare()
+	return diff
+}
+
+// compare records the mismatching status and gas used.
+func (d *OutcomeDiff) compare() {
+	d.Mismatches = []string{}
+	if d.SimulatedStatus != d.ActualStatus {
+		d.Mismatches = append(d.Mismatches, MismatchStatus)
+	}
+	if d.SimulatedGasUsed != d.ActualGasUsed {
+		d.Mismatches = append(d.Mismatches, MismatchGasUsed)
+	}
+}
+
+func sameFrames(a, b []TraceN) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		x, y := &a[i], &b[i]
+		if x.CallType != y.CallType || x.FromAddr != y.FromAddr || !sameAddr(x.ToAddr, y.ToAddr) ||
+			!sameAddr(x.CreateAddr, y.CreateAddr) || !sameAddr(x.SuicideContract, y.SuicideContract) ||
+			!sameAddr(x.Beneficiary, y.Beneficiary) || !bytes.Equal(x.Input, y.Input) ||
+			!bytes.Equal(x.Output, y.Output) || !sameInt(x.Value, y.Value) || x.Error != y.Error ||
+			x.Reverted != y.Reverted || x.TraceIndex != y.TraceIndex || x.ParentIndex != y.ParentIndex {
+			return false
+		}
+	}
+	return true
+}
+
+func sameTransfers(a, b []AssetTransfer) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		x, y := &a[i], &b[i]
+		if x.Standard != y.Standard || x.Token != y.Token || x.From != y.From || x.To != y.To ||
+			!sameInt(x.ID, y.ID) || !sameInt(x.Amount, y.Amount) || x.Reverted != y.Reverted ||
+			x.TraceIndex != y.TraceIndex {
+			return false
+		}
+	}
+	return true
+}
+
+func sameAddr(a, b *common.Address) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+func sameInt(a, b *big.Int) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Cmp(b) == 0
+}
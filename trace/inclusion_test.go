@@ -0,0 +1,98 @@
+package trace
+
+import (
+	"encoding/json"
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+func TestDiffRecords(t *testing.T) {
+	simulated := testRecords[0]
+	tests := []struct {
+		name   string
+		modify func(actual *TransactionAll)
+		want   []string
+	}{
+		{"identical", func(actual *TransactionAll) {}, []string{}},
+		{"frame gas", func(actual *TransactionAll) { actual.TxTraces[0].Gas = 1 }, []string{}},
+		{"status", func(actual *TransactionAll) { actual.TxReceipt.Status = 0 }, []string{MismatchStatus}},
+		{"gas used", func(actual *TransactionAll) { actual.TxReceipt.GasUsed++ }, []string{MismatchGasUsed}},
+		{"frame output", func(actual *TransactionAll) { actual.TxTraces[0].Output = []byte{0x00} }, []string{MismatchTraces}},
+		{"frame count", func(actual *TransactionAll) { actual.TxTraces = nil }, []string{MismatchTraces}},
+		{"amount", func(actual *TransactionAll) { actual.TxTransfers[0].Amount = big.NewInt(2) }, []string{MismatchTransfers}},
+	}
+	for _, tt := range tests {
+		actual := simulated
+		receipt := *simulated.TxReceipt
+		actual.TxReceipt = &receipt
+		actual.TxTraces = append([]TraceN{}, simulated.TxTraces...)
+		actual.TxTransfers = append([]AssetTransfer{}, simulated.TxTransfers...)
+		tt.modify(&actual)
+
+		diff := DiffRecords(&simulated, &actual)
+		if !diff.Traced || !reflect.DeepEqual(diff.Mismatches, tt.want) {
+			t.Errorf("%s: mismatches: have %v, want %v", tt.name, diff.Mismatches, tt.want)
+		}
+	}
+}
+
+func TestDiffReceipt(t *testing.T) {
+	diff := DiffReceipt(&testRecords[0], 0, 21000)
+	if diff.Traced || !reflect.DeepEqual(diff.Mismatches, []string{MismatchStatus}) {
+		t.Errorf("mismatches: have %v, want [%s]", diff.Mismatches, MismatchStatus)
+	}
+}
+
+func TestInclusionJSON(t *testing.T) {
+	index := uint64(4)
+	blob, err := json.Marshal(&Inclusion{Status: InclusionIncluded, TxIndex: 1, SimIndex: &index})
+	if err != nil {
+		t.Fatalf("failed to encode inclusion: %v", err)
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(blob, &fields); err != nil {
+		t.Fatalf("failed to decode inclusion: %v", err)
+	}
+	if fields["indexDelta"] != float64(-3) {
+		t.Errorf("index delta mismatch: have %v, want -3", fields["indexDelta"])
+	}
+	if _, ok := fields["replacedBy"]; ok {
+		t.Errorf("unset replacement encoded: %s", blob)
+	}
+	// Isolated simulations have no position to compare against
+	if blob, err = json.Marshal(&Inclusion{Status: InclusionIncluded, TxIndex: 1}); err != nil {
+		t.Fatalf("failed to encode inclusion: %v", err)
+	}
+	fields = nil
+	if err := json.Unmarshal(blob, &fields); err != nil {
+		t.Fatalf("failed to decode inclusion: %v", err)
+	}
+	for _, field := range []string{"simIndex", "indexDelta"} {
+		if _, ok := fields[field]; ok {
+			t.Errorf("unset %s encoded: %s", field, blob)
+		}
+	}
+}
+
+func TestInclusionRLPSimIndex(t *testing.T) {
+	zero := uint64(0)
+	for _, want := range []*Inclusion{
+		{Status: InclusionIncluded, TxIndex: 3},
+		{Status: InclusionIncluded, TxIndex: 3, SimIndex: &zero},
+	} {
+		blob, err := rlp.EncodeToBytes(want)
+		if err != nil {
+			t.Fatalf("failed to encode inclusion: %v", err)
+		}
+		have := new(Inclusion)
+		if err := rlp.DecodeBytes(blob, have); err != nil {
+			t.Fatalf("failed to decode inclusion: %v", err)
+		}
+		if !reflect.DeepEqual(have, want) {
+			t.Errorf("inclusion mismatch: have %+v, want %+v", have, want)
+		}
+	}
+}
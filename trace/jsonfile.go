@@ -0,0 +1,64 @@
+package trace
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// JSONFileSink is a Sink appending records to a file as newline-delimited JSON.
+// The file is a log: a record written again for the same transaction is
+// appended, and supersedes the earlier lines of that transaction.
+type JSONFileSink struct {
+	file *os.File
+	buf  *bufio.Writer
+	enc  *json.Encoder
+	lock sync.Mutex
+}
+
+// NewJSONFileSink opens (or creates) the file at path for appending records,
+// creating any missing parent directories.
+func NewJSONFileSink(path string) (*JSONFileSink, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	buf := bufio.NewWriter(file)
+	return &JSONFileSink{file: file, buf: buf, enc: json.NewEncoder(buf)}, nil
+}
+
+// Write implements Sink, encoding the record onto its own line.
+func (s *JSONFileSink) Write(tx TransactionAll) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.enc.Encode(tx)
+}
+
+// Flush implements Sink, writing the buffered lines out to the file.
+func (s *JSONFileSink) Flush() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if err := s.buf.Flush(); err != nil {
+		return err
+	}
+	return s.file.Sync()
+}
+
+// Close implements Sink, flushing the buffered lines and closing the file.
+func (s *JSONFileSink) Close() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if err := s.buf.Flush(); err != nil {
+		s.file.Close()
+		return err
+	}
+	return s.file.Close()
+}
@@ -0,0 +1,262 @@
+package trace
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// LegacyRecord is the untyped record written before RecordVersion 1, where
+// every part of the record was a separately JSON encoded string. Documents in
+// MongoDB used the lowercased field names (txhash, txreceipt, ...), newline
+// delimited JSON files the json tags below.
+type LegacyRecord struct {
+	TxHash         string `json:"txHash"`
+	TxReceipt      string `json:"txReceipt"`
+	TxTransferLogs string `json:"txTransferLogs"`
+	TxTraces       string `json:"txTraces"`
+	TxCreatedSC    string `json:"txCreatedSC"`
+}
+
+type legacyTrace struct {
+	CallType        string   `json:"callType"`
+	FromAddr        string   `json:"fromAddr"`
+	ToAddr          string   `json:"toAddr"`
+	CreateAddr      string   `json:"createAddr"`
+	SuicideContract string   `json:"suicideContract"`
+	Beneficiary     string   `json:"beneficiary"`
+	Input           string   `json:"input"`
+	Output          string   `json:"output"`
+	Value           *big.Int `json:"value"`
+	CallDepth       uint64   `json:"callDepth"`
+	TraceIndex      uint64   `json:"traceIndex"`
+	Type            string   `json:"type"`
+}
+
+type legacyTransferLog struct {
+	FromAddr   string `json:"fromAddr"`
+	ToAddr     string `json:"toAddr"`
+	Value      string `json:"value"`
+	TokenAddr  string `json:"tokenAddr"`
+	CallDepth  uint64 `json:"callDepth"`
+	TraceIndex uint64 `json:"traceIndex"`
+}
+
+type legacyReceipt struct {
+	BlockNum string `json:"blockNum"`
+	FromAddr string `json:"fromAddr"`
+	ToAddr   string `json:"toAddr"`
+	Gas      string `json:"gas"`
+	GasUsed  string `json:"gasUsed"`
+	GasPrice string `json:"gasPrice"`
+	TxIndex  uint64 `json:"txIndex"`
+	Value    string `json:"value"`
+	Input    string `json:"input"`
+	Status   string `json:"status"`
+	Err      string `json:"err"`
+}
+
+// Upgrade converts a legacy record into the current typed schema.
+func (r *LegacyRecord) Upgrade() (*TransactionAll, error) {
+	tx := &TransactionAll{
+		Version:     RecordVersion,
+		TxHash:      common.HexToHash(r.TxHash),
+		TxTransfers: []AssetTransfer{},
+		TxTraces:    []TraceN{},
+		TxCreatedSC: []common.Address{},
+	}
+	receipt, err := r.upgradeReceipt()
+	if err != nil {
+		return nil, fmt.Errorf("tx %s: receipt: %v", r.TxHash, err)
+	}
+	tx.TxReceipt = receipt
+
+	if r.TxTraces != "" {
+		var traces []legacyTrace
+		if err := json.Unmarshal([]byte(r.TxTraces), &traces); err != nil {
+			return nil, fmt.Errorf("tx %s: traces: %v", r.TxHash, err)
+		}
+		for _, t := range traces {
+			input, err := legacyBytes(t.Input)
+			if err != nil {
+				return nil, fmt.Errorf("tx %s: trace %d input: %v", r.TxHash, t.TraceIndex, err)
+			}
+			output, err := legacyBytes(t.Output)
+			if err != nil {
+				return nil, fmt.Errorf("tx %s: trace %d output: %v", r.TxHash, t.TraceIndex, err)
+			}
+			tx.TxTraces = append(tx.TxTraces, TraceN{
+				CallType:        t.CallType,
+				FromAddr:        common.HexToAddress(t.FromAddr),
+				ToAddr:          legacyAddress(t.ToAddr),
+				CreateAddr:      legacyAddress(t.CreateAddr),
+				SuicideContract: legacyAddress(t.SuicideContract),
+				Beneficiary:     legacyAddress(t.Beneficiary),
+				Input:           input,
+				Output:          output,
+				Value:           legacyValue(t.Value),
+				CallDepth:       t.CallDepth,
+				TraceIndex:      t.TraceIndex,
+				Type:            t.Type,
+			})
+		}
+		if err := linkLegacyTraces(tx.TxTraces); err != nil {
+			return nil, fmt.Errorf("tx %s: traces: %v", r.TxHash, err)
+		}
+	}
+	if r.TxTransferLogs != "" {
+		var logs []legacyTransferLog
+		if err := json.Unmarshal([]byte(r.TxTransferLogs), &logs); err != nil {
+			return nil, fmt.Errorf("tx %s: transfer logs: %v", r.TxHash, err)
+		}
+		for _, l := range logs {
+			value, err := legacyBytes(l.Value)
+			if err != nil {
+				return nil, fmt.Errorf("tx %s: transfer log value: %v", r.TxHash, err)
+			}
+			// Legacy logs stored the raw indexed topics as the sender and recipient.
+			tx.TxTransfers = append(tx.TxTransfers, AssetTransfer{
+				Standard:   StandardERC20,
+				Token:      common.HexToAddress(l.TokenAddr),
+				From:       topicAddress(common.HexToHash(l.FromAddr)),
+				To:         topicAddress(common.HexToHash(l.ToAddr)),
+				Amount:     new(big.Int).SetBytes(value),
+				CallDepth:  l.CallDepth,
+				TraceIndex: legacyIndex(l.TraceIndex),
+			})
+		}
+	}
+	if r.TxCreatedSC != "" && r.TxCreatedSC != "null" {
+		var created []string
+		if err := json.Unmarshal([]byte(r.TxCreatedSC), &created); err != nil {
+			return nil, fmt.Errorf("tx %s: created contracts: %v", r.TxHash, err)
+		}
+		for _, addr := range created {
+			tx.TxCreatedSC = append(tx.TxCreatedSC, common.HexToAddress(addr))
+		}
+	}
+	tx.TxBalances = BalanceDeltas(tx.TxTransfers)
+	return tx, nil
+}
+
+func (r *LegacyRecord) upgradeReceipt() (*TxReceipt, error) {
+	if r.TxReceipt == "" {
+		return new(TxReceipt), nil
+	}
+	var lr legacyReceipt
+	if err := json.Unmarshal([]byte(r.TxReceipt), &lr); err != nil {
+		return nil, err
+	}
+	receipt := &TxReceipt{
+		FromAddr: common.HexToAddress(lr.FromAddr),
+		ToAddr:   legacyAddress(lr.ToAddr),
+		TxIndex:  lr.TxIndex,
+		Err:      lr.Err,
+	}
+	var err error
+	if receipt.BlockNum, err = legacyDecimal(lr.BlockNum); err != nil {
+		return nil, fmt.Errorf("block number: %v", err)
+	}
+	if receipt.GasPrice, err = legacyDecimal(lr.GasPrice); err != nil {
+		return nil, fmt.Errorf("gas price: %v", err)
+	}
+	if receipt.Value, err = legacyDecimal(lr.Value); err != nil {
+		return nil, fmt.Errorf("value: %v", err)
+	}
+	for _, field := range []struct {
+		name string
+		str  string
+		dst  *uint64
+	}{
+		{"gas", lr.Gas, &receipt.Gas},
+		{"gas used", lr.GasUsed, &receipt.GasUsed},
+		{"status", lr.Status, &receipt.Status},
+	} {
+		n, err := legacyDecimal(field.str)
+		if err != nil || !n.IsUint64() {
+			return nil, fmt.Errorf("invalid %s %q", field.name, field.str)
+		}
+		*field.dst = n.Uint64()
+	}
+	if receipt.Input, err = legacyBytes(lr.Input); err != nil {
+		return nil, fmt.Errorf("input: %v", err)
+	}
+	receipt.GasFee = new(big.Int).Mul(new(big.Int).SetUint64(receipt.GasUsed), receipt.GasPrice)
+	return receipt, nil
+}
+
+// legacyAddress parses an optional address, which legacy records stored as
+// "0x" (or, for simulated calls, an empty string) when missing.
+func legacyAddress(s string) *common.Address {
+	if s == "" || s == "0x" {
+		return nil
+	}
+	addr := common.HexToAddress(s)
+	return &addr
+}
+
+// legacyBytes parses a hex string which may or may not carry a 0x prefix.
+func legacyBytes(s string) ([]byte, error) {
+	return hex.DecodeString(strings.TrimPrefix(s, "0x"))
+}
+
+// legacyDecimal parses a base 10 quantity, treating an empty string as zero.
+func legacyDecimal(s string) (*big.Int, error) {
+	if s == "" {
+		return new(big.Int), nil
+	}
+	n, ok := new(big.Int).SetString(s, 10)
+	if !ok {
+		return nil, fmt.Errorf("invalid number %q", s)
+	}
+	return n, nil
+}
+
+func legacyValue(v *big.Int) *big.Int {
+	if v == nil {
+		return new(big.Int)
+	}
+	return v
+}
+
+// linkLegacyTraces restores the pre-order of legacy frames, which were stored
+// in completion order, and derives the call tree links from their depths.
+func linkLegacyTraces(traces []TraceN) error {
+	sort.SliceStable(traces, func(i, j int) bool {
+		return traces[i].TraceIndex < traces[j].TraceIndex
+	})
+	var stack []*TraceN
+	for i := range traces {
+		t := &traces[i]
+		t.TraceIndex = uint64(i)
+		t.TraceAddress = []uint64{}
+		if t.CallDepth == 0 || t.CallDepth > uint64(len(stack))+1 {
+			return fmt.Errorf("frame %d jumps from depth %d to %d", i, len(stack), t.CallDepth)
+		}
+		stack = stack[:t.CallDepth-1]
+		if len(stack) > 0 {
+			parent := stack[len(stack)-1]
+			t.ParentIndex = parent.TraceIndex
+			t.TraceAddress = append(append([]uint64{}, parent.TraceAddress...), parent.Subtraces)
+			parent.Subtraces++
+		} else if i > 0 {
+			return fmt.Errorf("frame %d is a second root", i)
+		}
+		stack = append(stack, t)
+	}
+	return nil
+}
+
+// legacyIndex maps a legacy trace index, which counted frames from one, onto
+// the pre-order position of the frame.
+func legacyIndex(n uint64) uint64 {
+	if n == 0 {
+		return 0
+	}
+	return n - 1
+}
@@ -0,0 +1,51 @@
+package trace
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func TestLegacyUpgrade(t *testing.T) {
+	legacy := &LegacyRecord{
+		TxHash:         "0x0100000000000000000000000000000000000000000000000000000000000000",
+		TxReceipt:      `{"blockNum":"100","fromAddr":"0xaa00000000000000000000000000000000000000","toAddr":"0x","gas":"50000","gasUsed":"21000","gasPrice":"1000000000","txIndex":3,"value":"1","input":"6080","status":"1","err":""}`,
+		TxTransferLogs: `[{"fromAddr":"0x000000000000000000000000aa00000000000000000000000000000000000000","toAddr":"0x000000000000000000000000bb00000000000000000000000000000000000000","value":"00000000000000000000000000000000000000000000000000000000000001f4","tokenAddr":"0xcc00000000000000000000000000000000000000","callDepth":1,"callNum":0,"traceIndex":1}]`,
+		TxTraces:       `[{"callType":"CREATE","fromAddr":"0xaa00000000000000000000000000000000000000","toAddr":"0x","createAddr":"0xcc00000000000000000000000000000000000000","suicideContract":"0x","beneficiary":"0x","input":"6080","output":"","value":1,"callDepth":1,"callNum":0,"traceIndex":1,"type":"CREATE"}]`,
+		TxCreatedSC:    `["0xcc00000000000000000000000000000000000000"]`,
+	}
+	tx, err := legacy.Upgrade()
+	if err != nil {
+		t.Fatalf("failed to upgrade record: %v", err)
+	}
+	if tx.Version != RecordVersion || tx.TxHash != (common.Hash{0x01}) {
+		t.Errorf("header mismatch: version %d, hash %x", tx.Version, tx.TxHash)
+	}
+	if r := tx.TxReceipt; r.BlockNum.Uint64() != 100 || r.ToAddr != nil || r.GasUsed != 21000 || r.Status != 1 || !bytes.Equal(r.Input, []byte{0x60, 0x80}) {
+		t.Errorf("receipt mismatch: %+v", r)
+	}
+	if len(tx.TxTransfers) != 1 {
+		t.Fatalf("transfer count mismatch: have %d, want 1", len(tx.TxTransfers))
+	}
+	if l := tx.TxTransfers[0]; l.Standard != StandardERC20 || l.From != (common.Address{0xaa}) || l.To != (common.Address{0xbb}) || l.Amount.Cmp(big.NewInt(500)) != 0 {
+		t.Errorf("transfer log mismatch: %+v", l)
+	}
+	if len(tx.TxTraces) != 1 {
+		t.Fatalf("trace count mismatch: have %d, want 1", len(tx.TxTraces))
+	}
+	if tr := tx.TxTraces[0]; tr.ToAddr != nil || tr.CreateAddr == nil || *tr.CreateAddr != (common.Address{0xcc}) || len(tr.Output) != 0 {
+		t.Errorf("trace mismatch: %+v", tr)
+	}
+	if len(tx.TxCreatedSC) != 1 || tx.TxCreatedSC[0] != (common.Address{0xcc}) {
+		t.Errorf("created contracts mismatch: %v", tx.TxCreatedSC)
+	}
+}
+
+func TestLegacyUpgradeInvalid(t *testing.T) {
+	legacy := &LegacyRecord{TxReceipt: `{"gas":"lots"}`}
+	if _, err := legacy.Upgrade(); err == nil {
+		t.Error("expected error for malformed receipt")
+	}
+}
@@ -1,64 +1,154 @@
 package trace
 
 import (
-	// "bytes"
+	"encoding/json"
+	"fmt"
 	"os"
+	"sync"
+
 	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
 )
 
+// MongoSink is a Sink storing records in a MongoDB collection. Records are
+// stored as documents mirroring their JSON encoding, keyed by transaction hash,
+// and upserted in batches; the ones which cannot be stored are appended to an
+// error log file instead of being dropped silently.
+type MongoSink struct {
+	session *mgo.Session
+	coll    *mgo.Collection
+	errFile *os.File
+
+	batch []interface{}
+	size  int
+	lock  sync.Mutex
+}
 
-// Need for the sync
-var SessionGlobal *mgo.Session
-var CurrentTx string
-var CurrentBlockNum uint64
-var TxVMErr string
-var ErrorFile *os.File
-var DBAll *mgo.Collection
-var BashNum int = 100
-var BashTxs = make([]interface{}, BashNum)
-var CurrentNum int = 0
-// var Round int = 0
-
-func InitMongoDb() {
-	var err error
-    	if SessionGlobal, err = mgo.Dial(""); err != nil {
-        	panic(err)
-   	}
-
-	ErrorFile, err = os.OpenFile("db_error.log", os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+// NewMongoSink connects to the MongoDB server at rawurl and stores records in
+// the given collection. If database is empty, the one named by the url is used,
+// falling back to "simulation".
+func NewMongoSink(rawurl string, database string, collection string, batch int, errLog string) (*MongoSink, error) {
+	info, err := mgo.ParseURL(rawurl)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
-
-	DBAll = SessionGlobal.DB("simulation").C("history")
+	session, err := mgo.DialWithInfo(info)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to trace database: %v", err)
+	}
+	errFile, err := os.OpenFile(errLog, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		session.Close()
+		return nil, err
+	}
+	if database == "" {
+		database = info.Database
+	}
+	if database == "" {
+		database = DefaultConfig.Database
+	}
+	if batch <= 0 {
+		batch = DefaultConfig.BatchSize
+	}
+	return &MongoSink{
+		session: session,
+		coll:    session.DB(database).C(collection),
+		errFile: errFile,
+		batch:   make([]interface{}, 0, batch),
+		size:    batch,
+	}, nil
 }
 
+// Write implements Sink, queueing the record and inserting the batch once it
+// is full.
+func (s *MongoSink) Write(tx TransactionAll) error {
+	doc, err := recordDocument(&tx)
+	if err != nil {
+		return err
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
 
+	s.batch = append(s.batch, doc)
+	if len(s.batch) < s.size {
+		return nil
+	}
+	return s.flush()
+}
 
-// Need for the simulation
-var RTSessionGlobal *mgo.Session
-var SimErrorFile *os.File
-var Realtime *mgo.Collection
-
-var SimBashNum int = 100
-var SimBashTxs = make([]interface{}, SimBashNum)
-var SimCurrentNum int = 0
+// Flush implements Sink, inserting all queued records.
+func (s *MongoSink) Flush() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
 
-func InitRealtimeDB() {
-	var err error
-    	if RTSessionGlobal, err = mgo.Dial(""); err != nil {
-        	panic(err)
-   	}
+	return s.flush()
+}
 
-	SimErrorFile, err = os.OpenFile("realtime.log", os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-	if err != nil {
-		panic(err)
-	}
+// Close implements Sink, inserting all queued records and disconnecting.
+func (s *MongoSink) Close() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
 
-	Realtime = RTSessionGlobal.DB("simulation").C("pending")
+	err := s.flush()
+	s.session.Close()
+	s.errFile.Close()
+	return err
 }
 
+// flush upserts the queued batch in one go, replacing the documents already
+// stored for the same transactions. If that fails, the session is refreshed
+// and the records are retried one by one, logging the ones which still cannot
+// be stored. The caller must hold the lock.
+func (s *MongoSink) flush() error {
+	if len(s.batch) == 0 {
+		return nil
+	}
+	defer func() { s.batch = s.batch[:0] }()
 
+	bulk := s.coll.Bulk()
+	for i := range s.batch {
+		bulk.Upsert(recordSelector(s.batch[i]), s.batch[i])
+	}
+	if _, err := bulk.Run(); err == nil {
+		return nil
+	}
+	s.session.Refresh()
+
+	var failed int
+	for i := range s.batch {
+		if _, err := s.coll.Upsert(recordSelector(s.batch[i]), s.batch[i]); err != nil {
+			failed++
+			jsonTx, jsonErr := json.Marshal(s.batch[i])
+			if jsonErr != nil {
+				s.errFile.WriteString(fmt.Sprintf("Transaction;%s;%s\n", s.batch[i].(bson.M)["txHash"], jsonErr))
+				continue
+			}
+			s.errFile.WriteString(fmt.Sprintf("Transaction|%s|%s\n", jsonTx, err))
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("failed to insert %d of %d trace records", failed, len(s.batch))
+	}
+	return nil
+}
 
+// recordSelector returns the query matching the stored document of a record.
+func recordSelector(doc interface{}) bson.M {
+	return bson.M{"txHash": doc.(bson.M)["txHash"]}
+}
 
-
+// recordDocument converts a record into a MongoDB document. The BSON encoder
+// knows nothing about big integers and fixed size byte arrays, so the record
+// is routed through its JSON form, keeping quantities and addresses as hex
+// strings.
+func recordDocument(tx *TransactionAll) (bson.M, error) {
+	blob, err := EncodeRecordJSON(tx)
+	if err != nil {
+		return nil, err
+	}
+	var doc bson.M
+	if err := json.Unmarshal(blob, &doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
@@ -0,0 +1,154 @@
+package trace
+
+import (
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Sink is a destination for trace records. Implementations may buffer writes
+// internally; buffered records are only guaranteed to be persisted after Flush
+// or Close returns.
+//
+// Records are keyed by transaction hash: writing a record for a transaction
+// already stored supersedes the previous one, e.g. when a simulation record is
+// written again along with the inclusion of the transaction.
+//
+// Sinks are safe for concurrent use.
+type Sink interface {
+	// Write queues a transaction record for storage.
+	Write(tx TransactionAll) error
+
+	// Flush persists all queued records.
+	Flush() error
+
+	// Close flushes any queued records and releases the resources held by the
+	// sink. The sink must not be used afterwards.
+	Close() error
+}
+
+// MultiSink is a Sink writing every record to several sinks.
+type MultiSink []Sink
+
+// NewMultiSink creates a sink duplicating the records written to it into all
+// the given sinks.
+func NewMultiSink(sinks ...Sink) MultiSink {
+	return MultiSink(sinks)
+}
+
+// Write implements Sink, writing the record to all sinks. The first error is
+// returned, after all sinks were written to.
+func (s MultiSink) Write(tx TransactionAll) error {
+	var failure error
+	for _, sink := range s {
+		if err := sink.Write(tx); err != nil && failure == nil {
+			failure = err
+		}
+	}
+	return failure
+}
+
+// Flush implements Sink, flushing all sinks.
+func (s MultiSink) Flush() error {
+	var failure error
+	for _, sink := range s {
+		if err := sink.Flush(); err != nil && failure == nil {
+			failure = err
+		}
+	}
+	return failure
+}
+
+// Close implements Sink, closing all sinks.
+func (s MultiSink) Close() error {
+	var failure error
+	for _, sink := range s {
+		if err := sink.Close(); err != nil && failure == nil {
+			failure = err
+		}
+	}
+	return failure
+}
+
+// SyncStatus reports whether the node has caught up with the network. Traces
+// are only recorded at the chain head, not while the node is catching up.
+type SyncStatus interface {
+	Synced() bool
+}
+
+// OpenSink opens the sink described by the configured url for the named record
+// set, which is either config.History or config.Pending. The supported schemes
+// are:
+//
+//	mongodb://host[:port][/database]  stores records in the named MongoDB collection
+//	file:///path/to/dir               appends newline-delimited JSON to dir/name.jsonl, the last line of a transaction superseding earlier ones
+//	leveldb:///path/to/dir            stores records in a LevelDB database at dir/name
+//	memory://                         keeps records in memory, useful for tests
+func OpenSink(config *Config, name string) (Sink, error) {
+	u, err := url.Parse(config.Sink)
+	if err != nil {
+		return nil, fmt.Errorf("invalid trace sink url %q: %v", config.Sink, err)
+	}
+	switch u.Scheme {
+	case "mongodb":
+		return NewMongoSink(config.Sink, config.Database, name, config.BatchSize, config.ErrorLog)
+	case "file":
+		return NewJSONFileSink(filepath.Join(sinkPath(u), name+".jsonl"))
+	case "leveldb":
+		return NewLevelDBSink(filepath.Join(sinkPath(u), name))
+	case "memory":
+		return NewMemorySink(), nil
+	default:
+		return nil, fmt.Errorf("unsupported trace sink scheme %q", u.Scheme)
+	}
+}
+
+// sinkPath returns the filesystem path of a file:// or leveldb:// url,
+// accepting both the absolute (file:///dir) and relative (file://dir) forms.
+func sinkPath(u *url.URL) string {
+	return filepath.FromSlash(u.Host + u.Path)
+}
+
+// MemorySink is a Sink keeping all records in memory.
+type MemorySink struct {
+	records []TransactionAll
+	index   map[common.Hash]int // position of the record of each transaction
+	lock    sync.RWMutex
+}
+
+// NewMemorySink creates an empty in-memory sink.
+func NewMemorySink() *MemorySink {
+	return &MemorySink{index: make(map[common.Hash]int)}
+}
+
+// Write implements Sink, appending the record to the in-memory list or
+// replacing the one previously written for the same transaction.
+func (s *MemorySink) Write(tx TransactionAll) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if i, ok := s.index[tx.TxHash]; ok {
+		s.records[i] = tx
+		return nil
+	}
+	s.index[tx.TxHash] = len(s.records)
+	s.records = append(s.records, tx)
+	return nil
+}
+
+// Flush implements Sink. Records are stored immediately, so it is a noop.
+func (s *MemorySink) Flush() error { return nil }
+
+// Close implements Sink. The records remain available after closing.
+func (s *MemorySink) Close() error { return nil }
+
+// Records returns a copy of all the records written to the sink so far.
+func (s *MemorySink) Records() []TransactionAll {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	return append([]TransactionAll(nil), s.records...)
+}
@@ -0,0 +1,213 @@
+package trace
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+var (
+	testContract = common.Address{0xcc}
+	testSimIndex = uint64(2)
+
+	testRecords = []TransactionAll{
+		{
+			Version: RecordVersion,
+			TxHash:  common.Hash{0x01},
+			TxReceipt: &TxReceipt{
+				BlockNum: big.NewInt(100),
+				FromAddr: common.Address{0xaa},
+				ToAddr:   &testContract,
+				Gas:      50000,
+				GasUsed:  21000,
+				GasPrice: big.NewInt(1000000000),
+				TxIndex:  3,
+				Value:    big.NewInt(1),
+				Input:    []byte{0xa9, 0x05, 0x9c, 0xbb},
+				Status:   1,
+			},
+			TxTransfers: []AssetTransfer{{
+				Standard:  StandardETH,
+				From:      common.Address{0xaa},
+				To:        testContract,
+				Amount:    big.NewInt(1),
+				CallDepth: 1,
+			}, {
+				Standard:  StandardERC721,
+				Token:     testContract,
+				From:      common.Address{0xaa},
+				To:        common.Address{0xbb},
+				ID:        big.NewInt(7),
+				Amount:    big.NewInt(1),
+				CallDepth: 1,
+			}},
+			TxTraces: []TraceN{{
+				CallType:  "CALL",
+				FromAddr:  common.Address{0xaa},
+				ToAddr:    &testContract,
+				Input:     []byte{0xa9, 0x05, 0x9c, 0xbb},
+				Output:    []byte{0x01},
+				Value:     big.NewInt(1),
+				CallDepth: 1,
+				Type:      "CALL",
+			}},
+			TxCreatedSC: []common.Address{},
+		},
+		{
+			Version: RecordVersion,
+			TxHash:  common.Hash{0x02},
+			TxReceipt: &TxReceipt{
+				BlockNum: big.NewInt(101),
+				FromAddr: common.Address{0xbb},
+				Gas:      100000,
+				GasUsed:  100000,
+				GasPrice: big.NewInt(2000000000),
+				Value:    big.NewInt(0),
+				Input:    []byte{0x60, 0x80},
+				Status:   0,
+				Err:      "out of gas",
+			},
+			TxTransfers: []AssetTransfer{},
+			TxTraces: []TraceN{{
+				CallType:   "CREATE",
+				FromAddr:   common.Address{0xbb},
+				CreateAddr: &testContract,
+				Input:      []byte{0x60, 0x80},
+				Output:     []byte{},
+				Value:      big.NewInt(0),
+				CallDepth:  1,
+				Type:       "CREATE",
+			}},
+			TxCreatedSC: []common.Address{testContract},
+			TxInclusion: &Inclusion{
+				Status:      InclusionIncluded,
+				BlockNumber: 101,
+				BlockHash:   common.Hash{0x03},
+				TxIndex:     5,
+				SimIndex:    &testSimIndex,
+				Diff: &OutcomeDiff{
+					SimulatedStatus:  1,
+					SimulatedGasUsed: 60000,
+					ActualGasUsed:    100000,
+					Traced:           true,
+					Mismatches:       []string{MismatchStatus, MismatchGasUsed},
+				},
+			},
+		},
+	}
+)
+
+func TestMemorySink(t *testing.T) {
+	sink, err := OpenSink(&Config{Sink: "memory://"}, "history")
+	if err != nil {
+		t.Fatalf("failed to open sink: %v", err)
+	}
+	for _, tx := range testRecords {
+		if err := sink.Write(tx); err != nil {
+			t.Fatalf("failed to write record: %v", err)
+		}
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatalf("failed to close sink: %v", err)
+	}
+	if have := sink.(*MemorySink).Records(); !reflect.DeepEqual(have, testRecords) {
+		t.Errorf("records mismatch: have %v, want %v", have, testRecords)
+	}
+}
+
+func TestJSONFileSink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "trace-sink")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	sink, err := OpenSink(&Config{Sink: "file://" + filepath.ToSlash(dir)}, "pending")
+	if err != nil {
+		t.Fatalf("failed to open sink: %v", err)
+	}
+	for _, tx := range testRecords {
+		if err := sink.Write(tx); err != nil {
+			t.Fatalf("failed to write record: %v", err)
+		}
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatalf("failed to close sink: %v", err)
+	}
+	file, err := os.Open(filepath.Join(dir, "pending.jsonl"))
+	if err != nil {
+		t.Fatalf("failed to open output: %v", err)
+	}
+	defer file.Close()
+
+	var have []TransactionAll
+	for scanner := bufio.NewScanner(file); scanner.Scan(); {
+		tx, err := DecodeRecordJSON(scanner.Bytes())
+		if err != nil {
+			t.Fatalf("failed to decode line %d: %v", len(have), err)
+		}
+		have = append(have, *tx)
+	}
+	if len(have) != len(testRecords) {
+		t.Fatalf("record count mismatch: have %d, want %d", len(have), len(testRecords))
+	}
+	for i := range have {
+		if !sameRecord(&have[i], &testRecords[i]) {
+			t.Errorf("record %d mismatch: have %v, want %v", i, have[i], testRecords[i])
+		}
+	}
+}
+
+// sameRecord reports whether two records have the same canonical encoding,
+// which unlike reflect.DeepEqual ignores the internal layout of big integers.
+func sameRecord(a, b *TransactionAll) bool {
+	blobA, errA := EncodeRecord(a)
+	blobB, errB := EncodeRecord(b)
+	return errA == nil && errB == nil && bytes.Equal(blobA, blobB)
+}
+
+func TestLevelDBSink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "trace-sink")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	sink, err := OpenSink(&Config{Sink: "leveldb://" + filepath.ToSlash(dir)}, "history")
+	if err != nil {
+		t.Fatalf("failed to open sink: %v", err)
+	}
+	db := sink.(*DatabaseSink)
+	defer db.Close()
+
+	for _, tx := range testRecords {
+		if err := sink.Write(tx); err != nil {
+			t.Fatalf("failed to write record: %v", err)
+		}
+	}
+	if err := sink.Flush(); err != nil {
+		t.Fatalf("failed to flush sink: %v", err)
+	}
+	for i, want := range testRecords {
+		have, err := db.Get(want.TxHash)
+		if err != nil {
+			t.Fatalf("failed to retrieve record %x: %v", want.TxHash, err)
+		}
+		if !sameRecord(have, &testRecords[i]) {
+			t.Errorf("record %x mismatch: have %v, want %v", want.TxHash, *have, want)
+		}
+	}
+}
+
+func TestOpenSinkUnsupported(t *testing.T) {
+	if _, err := OpenSink(&Config{Sink: "ftp://localhost"}, "history"); err == nil {
+		t.Fatal("expected error for unsupported scheme")
+	}
+}
@@ -0,0 +1,149 @@
+package trace
+
+import (
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Kinds of state accessed by a transaction, as recorded in StateAccess.Kind.
+const (
+	StateStorage = "storage"
+	StateBalance = "balance"
+	StateNonce   = "nonce"
+	StateCode    = "code"
+)
+
+// StateAccess is a single piece of state read or written by a transaction.
+// Storage slots hold their own value; balances and nonces are stored as big
+// endian 32 byte words and code as its hash. Slot is only set for storage.
+type StateAccess struct {
+	Address  common.Address `json:"address"`
+	Kind     string         `json:"kind"`
+	Slot     common.Hash    `json:"slot"`
+	Original common.Hash    `json:"original"` // value before the transaction
+	Value    common.Hash    `json:"value"`    // value after the transaction, equal to Original for reads
+}
+
+// StateAccessList holds the read and write sets of a transaction. Reads only
+// include state observed before the transaction modified it, so they are
+// exactly the state the transaction's outcome depends on. Writes only include
+// state whose value differs after the transaction, ignoring reverted changes.
+type StateAccessList struct {
+	Reads  []StateAccess `json:"reads"`
+	Writes []StateAccess `json:"writes"`
+}
+
+// StateReader is the part of the state database needed to look up the final
+// values of written state.
+type StateReader interface {
+	GetBalance(common.Address) *big.Int
+	GetNonce(common.Address) uint64
+	GetCodeHash(common.Address) common.Hash
+	GetState(common.Address, common.Hash) common.Hash
+}
+
+// stateKey identifies a single piece of state.
+type stateKey struct {
+	addr common.Address
+	kind string
+	slot common.Hash
+}
+
+// stateRecorder gathers the state accesses of a transaction.
+type stateRecorder struct {
+	reads   []StateAccess
+	writes  []StateAccess
+	read    map[stateKey]struct{}
+	written map[stateKey]struct{}
+}
+
+func newStateRecorder() *stateRecorder {
+	return &stateRecorder{
+		read:    make(map[stateKey]struct{}),
+		written: make(map[stateKey]struct{}),
+	}
+}
+
+// RecordStateAccess enables recording the read and write sets of the
+// transaction. It must be called before the transaction is executed.
+func (c *TraceCollector) RecordStateAccess() {
+	if c.state == nil {
+		c.state = newStateRecorder()
+	}
+}
+
+// RecordsStateAccess reports whether the collector records state accesses.
+func (c *TraceCollector) RecordsStateAccess() bool {
+	return c.state != nil
+}
+
+// ReadState records that the transaction observed the given value. Reads of
+// state the transaction already wrote are not recorded.
+func (c *TraceCollector) ReadState(addr common.Address, kind string, slot common.Hash, value common.Hash) {
+	if c.state == nil {
+		return
+	}
+	key := stateKey{addr, kind, slot}
+	if _, ok := c.state.written[key]; ok {
+		return
+	}
+	if _, ok := c.state.read[key]; ok {
+		return
+	}
+	c.state.read[key] = struct{}{}
+	c.state.reads = append(c.state.reads, StateAccess{Address: addr, Kind: kind, Slot: slot, Original: value, Value: value})
+}
+
+// WriteState records that the transaction is about to modify state which
+// currently holds the given value. Only the first write of a piece of state is
+// recorded, its final value is filled in by FinaliseState.
+func (c *TraceCollector) WriteState(addr common.Address, kind string, slot common.Hash, original common.Hash) {
+	if c.state == nil {
+		return
+	}
+	key := stateKey{addr, kind, slot}
+	if _, ok := c.state.written[key]; ok {
+		return
+	}
+	c.state.written[key] = struct{}{}
+	c.state.writes = append(c.state.writes, StateAccess{Address: addr, Kind: kind, Slot: slot, Original: original})
+}
+
+// FinaliseState looks up the values of all written state once the transaction
+// has finished, dropping the writes which were reverted or left the value
+// unchanged.
+func (c *TraceCollector) FinaliseState(state StateReader) {
+	if c.state == nil {
+		return
+	}
+	writes := c.state.writes[:0]
+	for _, w := range c.state.writes {
+		switch w.Kind {
+		case StateStorage:
+			w.Value = state.GetState(w.Address, w.Slot)
+		case StateBalance:
+			w.Value = common.BigToHash(state.GetBalance(w.Address))
+		case StateNonce:
+			w.Value = common.BigToHash(new(big.Int).SetUint64(state.GetNonce(w.Address)))
+		case StateCode:
+			w.Value = state.GetCodeHash(w.Address)
+		}
+		if w.Value != w.Original {
+			writes = append(writes, w)
+		}
+	}
+	c.state.writes = writes
+}
+
+// StateAccess returns the read and write sets of the transaction, or nil if
+// state accesses are not recorded.
+func (c *TraceCollector) StateAccess() *StateAccessList {
+	if c.state == nil {
+		return nil
+	}
+	return &StateAccessList{
+		Reads:  append([]StateAccess{}, c.state.reads...),
+		Writes: append([]StateAccess{}, c.state.writes...),
+	}
+}
@@ -0,0 +1,78 @@
+package trace
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// testState is a StateReader holding the post transaction state.
+type testState struct {
+	balances map[common.Address]int64
+	storage  map[common.Hash]common.Hash
+}
+
+func (s *testState) GetBalance(addr common.Address) *big.Int { return big.NewInt(s.balances[addr]) }
+func (s *testState) GetNonce(common.Address) uint64          { return 0 }
+func (s *testState) GetCodeHash(common.Address) common.Hash  { return common.Hash{} }
+func (s *testState) GetState(addr common.Address, slot common.Hash) common.Hash {
+	return s.storage[slot]
+}
+
+func TestStateAccess(t *testing.T) {
+	var (
+		alice    = common.Address{0xaa}
+		contract = common.Address{0xcc}
+		slot1    = common.Hash{0x01}
+		slot2    = common.Hash{0x02}
+	)
+	if NewTraceCollector().StateAccess() != nil {
+		t.Fatal("state access recorded without being enabled")
+	}
+	c := NewTraceCollector()
+	c.RecordStateAccess()
+
+	c.ReadState(alice, StateBalance, common.Hash{}, common.BigToHash(big.NewInt(100)))
+	c.WriteState(alice, StateBalance, common.Hash{}, common.BigToHash(big.NewInt(100)))
+	// reads of written state don't affect the outcome
+	c.ReadState(alice, StateBalance, common.Hash{}, common.BigToHash(big.NewInt(90)))
+
+	c.ReadState(contract, StateStorage, slot1, common.Hash{0x05})
+	c.ReadState(contract, StateStorage, slot1, common.Hash{0x05})
+	c.WriteState(contract, StateStorage, slot1, common.Hash{0x05})
+	c.WriteState(contract, StateStorage, slot1, common.Hash{0x06})
+	// a write that is reverted (or restored) leaves no trace
+	c.WriteState(contract, StateStorage, slot2, common.Hash{})
+
+	c.FinaliseState(&testState{
+		balances: map[common.Address]int64{alice: 90},
+		storage:  map[common.Hash]common.Hash{slot1: {0x07}},
+	})
+	access := c.StateAccess()
+
+	reads := []StateAccess{
+		{Address: alice, Kind: StateBalance, Original: common.BigToHash(big.NewInt(100)), Value: common.BigToHash(big.NewInt(100))},
+		{Address: contract, Kind: StateStorage, Slot: slot1, Original: common.Hash{0x05}, Value: common.Hash{0x05}},
+	}
+	writes := []StateAccess{
+		{Address: alice, Kind: StateBalance, Original: common.BigToHash(big.NewInt(100)), Value: common.BigToHash(big.NewInt(90))},
+		{Address: contract, Kind: StateStorage, Slot: slot1, Original: common.Hash{0x05}, Value: common.Hash{0x07}},
+	}
+	if len(access.Reads) != len(reads) {
+		t.Fatalf("read count mismatch: have %d, want %d", len(access.Reads), len(reads))
+	}
+	for i := range reads {
+		if access.Reads[i] != reads[i] {
+			t.Errorf("read %d mismatch: have %+v, want %+v", i, access.Reads[i], reads[i])
+		}
+	}
+	if len(access.Writes) != len(writes) {
+		t.Fatalf("write count mismatch: have %d, want %d", len(access.Writes), len(writes))
+	}
+	for i := range writes {
+		if access.Writes[i] != writes[i] {
+			t.Errorf("write %d mismatch: have %+v, want %+v", i, access.Writes[i], writes[i])
+		}
+	}
+}
@@ -1,127 +1,256 @@
 package trace
 
 import (
-	// "bytes"
-	// "os"
-	// "gopkg.in/mgo.v2"
 	"fmt"
-	// "github.com/ethereum/go-ethereum/common"
-	// "math"
+	"io"
 	"math/big"
-	// "github.com/ethereum/go-ethereum/common"
-	// "encoding/hex"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rlp"
 )
 
+// RecordVersion is the version of the trace record schema. It is bumped on
+// every incompatible change to the record types below.
+const RecordVersion = 1
+
+//go:generate gencodec -type TraceN -field-override traceNMarshaling -out gen_tracen_json.go
 
-type TraceN struct{
-	CallType string `json:"callType"`
-	FromAddr string `json:"fromAddr"`
-	ToAddr string `json:"toAddr"`
-	CreateAddr string `json:"createAddr"`
-	SuicideContract string `json:"suicideContract"`
-	Beneficiary string `json:"beneficiary"`
-	Input string `json:"input"`
-	Output string `json:"output"`
-	Value *big.Int `json:"value"`
-	CallDepth int `json:"callDepth"`
-	CallNum int `json:"callNum"`
-	TraceIndex uint64 `json:"traceIndex"`
-	Type string `json:"type"`
+// TraceN is a single call frame (message call, contract creation or self
+// destruct) executed by a transaction. A transaction's frames form a call tree
+// which is stored flattened in pre-order: TraceIndex is the position of the
+// frame in that order, and TraceAddress the path of child positions leading
+// to it from the root frame, e.g. [0 2 1] for the second call made by the
+// third call made by the first call made by the root frame.
+type TraceN struct {
+	CallType        string          `json:"callType"`
+	FromAddr        common.Address  `json:"fromAddr"`
+	ToAddr          *common.Address `json:"toAddr,omitempty" rlp:"nil"`
+	CreateAddr      *common.Address `json:"createAddr,omitempty" rlp:"nil"`
+	SuicideContract *common.Address `json:"suicideContract,omitempty" rlp:"nil"`
+	Beneficiary     *common.Address `json:"beneficiary,omitempty" rlp:"nil"`
+	Input           []byte          `json:"input"`
+	Output          []byte          `json:"output"`
+	Value           *big.Int        `json:"value"`
+	Gas             uint64          `json:"gas"`
+	GasUsed         uint64          `json:"gasUsed"`
+	Error           string          `json:"error,omitempty"`
+	Reverted        bool            `json:"reverted"` // set if the frame or one of its ancestors failed
+	RevertReason    string          `json:"revertReason,omitempty"`
+	CallDepth       uint64          `json:"callDepth"`
+	TraceIndex      uint64          `json:"traceIndex"`
+	ParentIndex     uint64          `json:"parentIndex"` // TraceIndex of the calling frame, zero for the root
+	TraceAddress    []uint64        `json:"traceAddress"`
+	Subtraces       uint64          `json:"subtraces"` // number of frames invoked directly by this one
+	Type            string          `json:"type"`
 }
 
+type traceNMarshaling struct {
+	Input   hexutil.Bytes
+	Output  hexutil.Bytes
+	Value   *hexutil.Big
+	Gas     hexutil.Uint64
+	GasUsed hexutil.Uint64
+}
 
-// Print dumps the content of the memory.
+// Print dumps the content of the trace.
 func (t *TraceN) Print() {
 	fmt.Printf("### Trace ###\n")
 	fmt.Printf("TraceIndex: %d\n", t.TraceIndex)
+	fmt.Printf("TraceAddress: %v\n", t.TraceAddress)
 	fmt.Printf("Call type: %s\n", t.CallType)
-	fmt.Printf("From: %s\n", t.FromAddr)
-	fmt.Printf("To: %s\n", t.ToAddr)
-	fmt.Printf("CreateAddr: %s\n", t.CreateAddr)
-	fmt.Printf("SuicideContract: %s\n", t.SuicideContract)
-	fmt.Printf("Beneficiary: %s\n", t.Beneficiary)
-	fmt.Printf("Input: %s\n", t.Input)
+	fmt.Printf("From: %s\n", t.FromAddr.Hex())
+	fmt.Printf("To: %s\n", printAddr(t.ToAddr))
+	fmt.Printf("CreateAddr: %s\n", printAddr(t.CreateAddr))
+	fmt.Printf("SuicideContract: %s\n", printAddr(t.SuicideContract))
+	fmt.Printf("Beneficiary: %s\n", printAddr(t.Beneficiary))
+	fmt.Printf("Input: %x\n", t.Input)
 	fmt.Printf("Value: %d\n", t.Value)
-	fmt.Printf("Type: %s\n", t.Type) 
-	fmt.Printf("Output: %s\n", t.Output) 
+	fmt.Printf("Type: %s\n", t.Type)
+	fmt.Printf("Output: %x\n", t.Output)
+	fmt.Printf("Gas: %d (used %d)\n", t.Gas, t.GasUsed)
+	if t.Error != "" {
+		fmt.Printf("Error: %s (reason %q)\n", t.Error, t.RevertReason)
+	}
+	fmt.Printf("Reverted: %t\n", t.Reverted)
 	fmt.Println("####################")
 }
 
+// Asset standards of the transfers recorded in AssetTransfer.Standard.
+const (
+	StandardETH     = "ETH"     // native ether moved by a call frame
+	StandardERC20   = "ERC20"   // fungible token Transfer event
+	StandardERC721  = "ERC721"  // non-fungible token Transfer event
+	StandardERC1155 = "ERC1155" // multi-token TransferSingle or TransferBatch event
+	StandardWETH    = "WETH"    // wrapped ether Deposit (mint) or Withdrawal (burn)
+)
+
+//go:generate gencodec -type AssetTransfer -field-override assetTransferMarshaling -out gen_assettransfer_json.go
 
-type TransferLog struct{
-	FromAddr string `json:"fromAddr"`
-	ToAddr string `json:"toAddr"`
-	Value string `json:"value"`
-	TokenAddr string `json:"tokenAddr"`
-	CallDepth int `json:"callDepth"`
-	CallNum int `json:"callNum"`
-	TraceIndex uint64 `json:"traceIndex"`
+// AssetTransfer is a movement of ether or tokens performed by a transaction,
+// either by a call frame carrying value or by an event decoded from the logs.
+// Mints and burns use the zero address as sender and recipient respectively.
+type AssetTransfer struct {
+	Standard   string         `json:"standard"`
+	Token      common.Address `json:"token"` // emitting contract, zero for ETH
+	From       common.Address `json:"from"`
+	To         common.Address `json:"to"`
+	ID         *big.Int       `json:"id,omitempty"` // token id, only meaningful for ERC721 and ERC1155
+	Amount     *big.Int       `json:"amount"`
+	Reverted   bool           `json:"reverted"` // set if the originating frame or one of its ancestors failed
+	CallDepth  uint64         `json:"callDepth"`
+	TraceIndex uint64         `json:"traceIndex"` // frame performing the transfer
 }
 
-func (l *TransferLog) Print() {
-	fmt.Printf("### ERC20TransferLog ###\n")
-	fmt.Printf("TraceIndex: %d\n", l.TraceIndex)
-	fmt.Printf("From: %s\n", l.FromAddr)
-	fmt.Printf("To: %s\n", l.ToAddr)
-	fmt.Printf("Value: %s\n", l.Value)
-	fmt.Printf("TokenAddr: %s\n", l.TokenAddr)
-	fmt.Println("####################")
+type assetTransferMarshaling struct {
+	ID     *hexutil.Big
+	Amount *hexutil.Big
 }
 
+// assetTransferRLP is the RLP encoding of an AssetTransfer.
+type assetTransferRLP struct {
+	Standard   string
+	Token      common.Address
+	From       common.Address
+	To         common.Address
+	ID         []*big.Int
+	Amount     *big.Int
+	Reverted   bool
+	CallDepth  uint64
+	TraceIndex uint64
+}
 
-type TxReceipt struct {
-	BlockNum string `json:"blockNum"`
-	FromAddr string `json:"fromAddr"`
-	ToAddr string `json:"toAddr"`
-	Gas string `json:"gas"`
-	GasUsed string `json:"gasUsed"`
-	GasPrice string `json:"gasPrice"`
-	// TxHash string `json:"txHash"`
-	TxIndex uint `json:"txIndex"`
-	Value string `json:"value"`
-	Input string `json:"input"`
-	Status  string `json:"status"`
-	Err string `json:"err"`
+// EncodeRLP implements rlp.Encoder.
+func (t *AssetTransfer) EncodeRLP(w io.Writer) error {
+	return rlp.Encode(w, assetTransferRLP{
+		Standard:   t.Standard,
+		Token:      t.Token,
+		From:       t.From,
+		To:         t.To,
+		ID:         encodeTokenID(t.ID),
+		Amount:     t.Amount,
+		Reverted:   t.Reverted,
+		CallDepth:  t.CallDepth,
+		TraceIndex: t.TraceIndex,
+	})
 }
 
-type TransactionAll struct{
-	TxHash string `json:"txHash"`
-	TxReceipt string `json:"txReceipt"`
-	TxTransferLogs string `json:"txTransferLogs"`
-	TxTraces string `json:"txTraces"`
-	TxCreatedSC string `json:"txCreatedSC"`
+// DecodeRLP implements rlp.Decoder.
+func (t *AssetTransfer) DecodeRLP(s *rlp.Stream) error {
+	var dec assetTransferRLP
+	if err := s.Decode(&dec); err != nil {
+		return err
+	}
+	id, err := decodeTokenID(dec.ID)
+	if err != nil {
+		return err
+	}
+	*t = AssetTransfer{
+		Standard:   dec.Standard,
+		Token:      dec.Token,
+		From:       dec.From,
+		To:         dec.To,
+		ID:         id,
+		Amount:     dec.Amount,
+		Reverted:   dec.Reverted,
+		CallDepth:  dec.CallDepth,
+		TraceIndex: dec.TraceIndex,
+	}
+	return nil
 }
 
+// encodeTokenID wraps an optional token id into a list for RLP encoding, as a
+// nil *big.Int would otherwise be encoded the same as token id 0.
+func encodeTokenID(id *big.Int) []*big.Int {
+	if id == nil {
+		return nil
+	}
+	return []*big.Int{id}
+}
 
-// Needed for the sync: apply transaction
-var Traces = []TraceN{}
-var CurrentTxIndex = 0
-var CurrentTraceIndex = uint64(0)
-var TransferLogs = []TransferLog{}
-var GTxReceipt = &TxReceipt{}
-var CreatedSC []string 
-var CallDepth = 0
-var CallNum = -1
-// var SyncFlag = false
+// decodeTokenID is the inverse of encodeTokenID.
+func decodeTokenID(list []*big.Int) (*big.Int, error) {
+	switch len(list) {
+	case 0:
+		return nil, nil
+	case 1:
+		return list[0], nil
+	default:
+		return nil, fmt.Errorf("invalid token id list of %d items", len(list))
+	}
+}
 
-// Needed for the simulation: apply transaction
-// var SimFlag = false
-var SimTraces = []TraceN{}
-var SimCurrentTxIndex = 0
-var SimCurrentTraceIndex = uint64(0)
-var SimTransferLogs = []TransferLog{}
-var SimGTxReceipt = &TxReceipt{}
-var SimCreatedSC []string 
-var SimCallDepth = 0
-var SimCallNum = -1
+// Print dumps the content of the transfer.
+func (t *AssetTransfer) Print() {
+	fmt.Printf("### AssetTransfer ###\n")
+	fmt.Printf("TraceIndex: %d\n", t.TraceIndex)
+	fmt.Printf("Standard: %s\n", t.Standard)
+	fmt.Printf("Token: %s\n", t.Token.Hex())
+	fmt.Printf("From: %s\n", t.From.Hex())
+	fmt.Printf("To: %s\n", t.To.Hex())
+	if t.ID != nil {
+		fmt.Printf("ID: %d\n", t.ID)
+	}
+	fmt.Printf("Amount: %d\n", t.Amount)
+	fmt.Println("####################")
+}
 
+//go:generate gencodec -type TxReceipt -field-override txReceiptMarshaling -out gen_txreceipt_json.go
 
-// Needed for realtime simulation
-var SyncedDone = false
+// TxReceipt summarises the execution outcome of a transaction.
+type TxReceipt struct {
+	BlockNum *big.Int        `json:"blockNum"`
+	FromAddr common.Address  `json:"fromAddr"`
+	ToAddr   *common.Address `json:"toAddr,omitempty" rlp:"nil"`
+	Gas      uint64          `json:"gas"`
+	GasUsed  uint64          `json:"gasUsed"`
+	GasPrice *big.Int        `json:"gasPrice"`
+	GasFee   *big.Int        `json:"gasFee"`   // GasUsed * GasPrice, paid by FromAddr
+	Coinbase common.Address  `json:"coinbase"` // recipient of the gas fee
+	TxIndex  uint64          `json:"txIndex"`
+	Value    *big.Int        `json:"value"`
+	Input    []byte          `json:"input"`
+	Status   uint64          `json:"status"`
+	Err      string          `json:"err,omitempty"`
+}
 
-// For test
-var TestIndex = 0
-var OnlyOneTopic = false
+type txReceiptMarshaling struct {
+	BlockNum *hexutil.Big
+	Gas      hexutil.Uint64
+	GasUsed  hexutil.Uint64
+	GasPrice *hexutil.Big
+	GasFee   *hexutil.Big
+	Value    *hexutil.Big
+	Input    hexutil.Bytes
+	Status   hexutil.Uint64
+}
 
+// TransactionAll is the trace record stored for a single transaction.
+type TransactionAll struct {
+	Version     uint64           `json:"version"`
+	TxHash      common.Hash      `json:"txHash"`
+	TxReceipt   *TxReceipt       `json:"txReceipt"`
+	TxTransfers []AssetTransfer  `json:"txTransfers"`
+	TxBalances  []BalanceDelta   `json:"txBalances"`
+	TxTraces    []TraceN         `json:"txTraces"`
+	TxCreatedSC []common.Address `json:"txCreatedSC"`
+	TxState     *StateAccessList `json:"txState,omitempty" rlp:"nil"`     // only recorded if enabled
+	TxReplaces  []common.Hash    `json:"txReplaces,omitempty"`            // pending transactions superseded by this one, oldest first
+	TxInclusion *Inclusion       `json:"txInclusion,omitempty" rlp:"nil"` // fate of a simulated transaction on chain, once known
+	TxContext   []string         `json:"txContext,omitempty"`             // block context fields the simulated outcome depends on, if probed
+}
 
+// Block context fields a simulated outcome may depend on, as recorded in
+// TransactionAll.TxContext.
+const (
+	ContextCoinbase  = "coinbase"
+	ContextTimestamp = "timestamp"
+)
 
+// printAddr formats an optional address, using "0x" for a missing one.
+func printAddr(addr *common.Address) string {
+	if addr == nil {
+		return "0x"
+	}
+	return addr.Hex()
+}